@@ -9,10 +9,13 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	// База часовых поясов встраивается в бинарник для параметра tz: в образе alpine ее нет
+	_ "time/tzdata"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/oziev02/CommentTree/internal/config"
 	httphandler "github.com/oziev02/CommentTree/internal/delivery/http"
+	"github.com/oziev02/CommentTree/internal/domain"
 	"github.com/oziev02/CommentTree/internal/infrastructure/database"
 	"github.com/oziev02/CommentTree/internal/usecase"
 )
@@ -24,8 +27,13 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Тела запросов пишутся на уровне debug, поэтому при их логировании уровень понижается
+	logLevel := slog.LevelInfo
+	if cfg.Server.DebugLogBodies {
+		logLevel = slog.LevelDebug
+	}
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+		Level: logLevel,
 	}))
 
 	pool, err := pgxpool.New(context.Background(), cfg.Database.DSN())
@@ -42,18 +50,112 @@ func main() {
 
 	logger.Info("database connection established")
 
-	repo := database.NewPostgresRepository(pool)
-	commentUseCase := usecase.NewCommentUseCase(repo)
+	repo := database.NewBreakerRepository(
+		database.NewPostgresRepository(pool),
+		uint32(cfg.Database.BreakerFailureThreshold),
+		cfg.Database.BreakerCooldown,
+	)
+	// Шифрование оборачивает circuit breaker: ошибки расшифровки не означают недоступность БД
+	var commentRepo domain.CommentRepository = repo
+	if cfg.Comments.ContentEncryptionKey != nil {
+		commentRepo, err = database.NewEncryptedRepository(repo, cfg.Comments.ContentEncryptionKey)
+		if err != nil {
+			logger.Error("failed to set up content encryption", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("content encryption enabled: search is disabled")
+	}
+
+	// Порядок шагов важен: длина проверяется уже после обрезки и схлопывания пробелов
+	var contentProcessors []usecase.ContentProcessor
+	if cfg.Comments.TrimContent {
+		contentProcessors = append(contentProcessors, usecase.TrimSpace())
+	}
+	if cfg.Comments.CollapseWhitespace {
+		contentProcessors = append(contentProcessors, usecase.CollapseWhitespace())
+	}
+	if cfg.Comments.MaxContentLength > 0 {
+		contentProcessors = append(contentProcessors, usecase.MaxLength(cfg.Comments.MaxContentLength))
+	}
+
+	events := usecase.NewEventBus(cfg.Comments.EventBufferSize, logger)
 
-	mux := httphandler.NewRouter(commentUseCase)
+	var views *usecase.ViewCounter
+	if cfg.Comments.ViewFlushInterval > 0 {
+		views = usecase.NewViewCounter(repo, cfg.Comments.ViewFlushInterval, logger)
+	}
+
+	commentUseCase := usecase.NewCommentUseCase(commentRepo, usecase.Config{
+		DedupWindow:         cfg.Comments.DedupWindow,
+		SimilarityThreshold: cfg.Comments.SimilarityThreshold,
+		SimilarityWindow:    cfg.Comments.SimilarityWindow,
+		ContentProcessors:   contentProcessors,
+		DefaultTTL:          cfg.Comments.DefaultTTL,
+		HotDecay:            cfg.Comments.HotDecay,
+		MaxSearchResults:    cfg.Comments.MaxSearchResults,
+		Events:              events,
+		Views:               views,
+	})
+
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	janitorDone := make(chan struct{})
+	if cfg.Comments.ExpirySweepInterval > 0 {
+		janitor := usecase.NewExpiryJanitor(repo, cfg.Comments.ExpirySweepInterval, cfg.Comments.DeletedIDsRetention, logger)
+		go func() {
+			defer close(janitorDone)
+			janitor.Run(janitorCtx)
+		}()
+	} else {
+		close(janitorDone)
+	}
 
-	fs := http.FileServer(http.Dir("./web"))
-	mux.Handle("GET /", fs)
+	orphansDone := make(chan struct{})
+	if cfg.Comments.OrphanSweepInterval > 0 {
+		orphanJanitor := usecase.NewOrphanJanitor(repo, cfg.Comments.OrphanSweepInterval, cfg.Comments.OrphanSweepFix, logger)
+		go func() {
+			defer close(orphansDone)
+			orphanJanitor.Run(janitorCtx)
+		}()
+	} else {
+		close(orphansDone)
+	}
+
+	viewsCtx, stopViews := context.WithCancel(context.Background())
+	viewsDone := make(chan struct{})
+	if views != nil {
+		go func() {
+			defer close(viewsDone)
+			views.Run(viewsCtx)
+		}()
+	} else {
+		close(viewsDone)
+	}
+
+	mux := httphandler.NewRouter(commentUseCase, logger, httphandler.Config{
+		MaxPageSize:      cfg.API.MaxPageSize,
+		MaxRecentLimit:   cfg.API.MaxRecentLimit,
+		MaxReplyCountIDs: cfg.API.MaxReplyCountIDs,
+		CacheMaxAge:      cfg.API.CacheMaxAge,
+		MaxSinceWindow:   cfg.API.MaxSinceWindow,
+
+		MaxRootsPerResponse: cfg.API.MaxRootsPerResponse,
+		IDsAsStrings:        cfg.API.IDsAsStrings,
+	})
+
+	mux.Handle("GET /healthz", httphandler.HealthHandler(repo.State))
+
+	mux.Handle("GET /", httphandler.StaticHandler(cfg.Server.WebDir, mux.HasRoute))
 	mux.Handle("GET /index.html", http.RedirectHandler("/", http.StatusMovedPermanently))
 
 	var handler http.Handler = mux
-	handler = httphandler.CORSMiddleware(handler)
-	handler = httphandler.LoggingMiddleware(logger, handler)
+	handler = httphandler.TimeoutMiddleware(cfg.Server.RequestTimeout, handler)
+	handler = httphandler.WriteAdmissionMiddleware(cfg.API.MaxConcurrentWrites, handler)
+	handler = httphandler.SearchRateLimitMiddleware(cfg.API.SearchRateLimitRPS, cfg.API.SearchRateLimitBurst, handler)
+	handler = httphandler.CORSMiddleware(mux.AllowedMethods, handler)
+	if cfg.Server.DebugLogBodies {
+		handler = httphandler.BodyLoggingMiddleware(logger, cfg.Server.DebugLogBodyLimit, handler)
+	}
+	handler = httphandler.LoggingMiddleware(logger, cfg.Server.AccessLogSampleRate, mux.Route, handler)
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port),
@@ -77,6 +179,10 @@ func main() {
 
 	logger.Info("shutting down server")
 
+	stopJanitor()
+	<-janitorDone
+	<-orphansDone
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -85,5 +191,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Просмотры останавливаются после сервера, чтобы записать и те, что учтены завершившимися запросами
+	stopViews()
+	<-viewsDone
+
+	events.Close()
+
 	logger.Info("server stopped")
 }
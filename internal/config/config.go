@@ -1,8 +1,12 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
+	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,12 +15,26 @@ import (
 type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
+	API      APIConfig
+	Comments CommentsConfig
 }
 
 // ServerConfig содержит настройки HTTP сервера
 type ServerConfig struct {
-	Host string
-	Port string
+	Host   string
+	Port   string
+	WebDir string
+
+	// AccessLogSampleRate доля успешных запросов, попадающих в access log (ошибки логируются всегда)
+	AccessLogSampleRate float64
+
+	// RequestTimeout максимальное время обработки запроса (0 - без ограничения)
+	RequestTimeout time.Duration
+
+	// DebugLogBodies включает логирование тел запросов и ответов на уровне debug
+	DebugLogBodies bool
+	// DebugLogBodyLimit максимальное число байт каждого тела, попадающих в лог
+	DebugLogBodyLimit int
 }
 
 // DatabaseConfig содержит настройки базы данных
@@ -27,6 +45,82 @@ type DatabaseConfig struct {
 	Password string
 	DBName   string
 	SSLMode  string
+	// Schema схема PostgreSQL, в которой находятся таблицы сервиса (задается через search_path)
+	Schema string
+
+	// BreakerFailureThreshold количество ошибок подряд, после которого circuit breaker размыкается
+	BreakerFailureThreshold int
+	// BreakerCooldown время, в течение которого запросы отклоняются до пробного обращения к БД
+	BreakerCooldown time.Duration
+}
+
+// APIConfig содержит ограничения HTTP API
+type APIConfig struct {
+	MaxPageSize    int
+	MaxRecentLimit int
+	// MaxReplyCountIDs максимальное число ID в одном запросе POST /comments/reply-counts
+	MaxReplyCountIDs int
+
+	// SearchRateLimitRPS ограничение поисковых запросов в секунду для одного IP (0 - без ограничения)
+	SearchRateLimitRPS   float64
+	SearchRateLimitBurst int
+
+	// MaxConcurrentWrites ограничение одновременных запросов на запись для всего сервиса (0 - без ограничения)
+	MaxConcurrentWrites int
+
+	// CacheMaxAge время кеширования ответов GET /comments клиентами и прокси
+	CacheMaxAge time.Duration
+
+	// MaxSinceWindow максимальное относительное окно в параметре since
+	MaxSinceWindow time.Duration
+
+	// MaxRootsPerResponse жесткое ограничение числа корневых веток в одном ответе GET /comments (0 - без ограничения)
+	MaxRootsPerResponse int
+
+	// IDsAsStrings сериализация ID комментариев в ответах JSON-строками для клиентов без int64
+	IDsAsStrings bool
+}
+
+// CommentsConfig содержит настройки бизнес-логики комментариев
+type CommentsConfig struct {
+	// DedupWindow окно отклонения повторной отправки того же комментария (0 - проверка отключена)
+	DedupWindow time.Duration
+	// SimilarityThreshold порог сходства для отклонения почти дубликатов (0 - проверка отключена)
+	SimilarityThreshold float64
+	// SimilarityWindow окно проверки почти дубликатов
+	SimilarityWindow time.Duration
+	// ContentEncryptionKey ключ AES для шифрования текста комментариев в БД (nil - шифрование отключено)
+	ContentEncryptionKey []byte
+
+	// TrimContent включает удаление пробельных символов по краям текста
+	TrimContent bool
+	// CollapseWhitespace включает замену последовательностей пробелов и табуляций внутри текста одним пробелом
+	CollapseWhitespace bool
+	// MaxContentLength максимальная длина текста в символах (0 - без ограничения)
+	MaxContentLength int
+
+	// DefaultTTL срок жизни комментария, если expires_at не указан (0 - бессрочно)
+	DefaultTTL time.Duration
+	// ExpirySweepInterval период удаления истекших комментариев (0 - удаление отключено)
+	ExpirySweepInterval time.Duration
+	// DeletedIDsRetention срок хранения ID удаленных комментариев в deleted_ids (0 - бессрочно)
+	DeletedIDsRetention time.Duration
+	// OrphanSweepInterval период поиска ответов без действующего родителя (0 - поиск отключен)
+	OrphanSweepInterval time.Duration
+	// OrphanSweepFix включает удаление найденных ответов без родителя вместо записи в лог
+	OrphanSweepFix bool
+
+	// HotDecay период затухания рейтинга сортировки sort_by=hot
+	HotDecay time.Duration
+
+	// MaxSearchResults максимальное число веток, рассматриваемых поиском (0 - без ограничения)
+	MaxSearchResults int
+
+	// EventBufferSize размер буфера событий на каждого подписчика шины событий
+	EventBufferSize int
+
+	// ViewFlushInterval период записи накопленных просмотров веток в БД (0 - просмотры не считаются)
+	ViewFlushInterval time.Duration
 }
 
 // Load загружает конфигурацию из переменных окружения
@@ -38,8 +132,14 @@ func Load() (*Config, error) {
 
 	cfg := &Config{
 		Server: ServerConfig{
-			Host: getEnv("SERVER_HOST", "localhost"),
-			Port: getEnv("SERVER_PORT", "8080"),
+			Host:   getEnv("SERVER_HOST", "localhost"),
+			Port:   getEnv("SERVER_PORT", "8080"),
+			WebDir: getEnv("WEB_DIR", "./web"),
+
+			AccessLogSampleRate: getEnvFloat("ACCESS_LOG_SAMPLE_RATE", 1),
+			RequestTimeout:      getEnvDuration("REQUEST_TIMEOUT", 10*time.Second),
+			DebugLogBodies:      getEnvBool("DEBUG_LOG_BODIES", false),
+			DebugLogBodyLimit:   getEnvInt("DEBUG_LOG_BODY_LIMIT", 4096),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -48,17 +148,82 @@ func Load() (*Config, error) {
 			Password: getEnv("DB_PASSWORD", "postgres"),
 			DBName:   getEnv("DB_NAME", "commenttree"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+			Schema:   getEnv("DB_SCHEMA", "public"),
+
+			BreakerFailureThreshold: getEnvInt("DB_BREAKER_FAILURE_THRESHOLD", 5),
+			BreakerCooldown:         getEnvDuration("DB_BREAKER_COOLDOWN", 30*time.Second),
+		},
+		API: APIConfig{
+			MaxPageSize:    getEnvInt("MAX_PAGE_SIZE", 200),
+			MaxRecentLimit: getEnvInt("MAX_RECENT_LIMIT", 100),
+
+			MaxReplyCountIDs: getEnvInt("MAX_REPLY_COUNT_IDS", 100),
+
+			SearchRateLimitRPS:   getEnvFloat("SEARCH_RATE_LIMIT_RPS", 2),
+			SearchRateLimitBurst: getEnvInt("SEARCH_RATE_LIMIT_BURST", 5),
+
+			MaxConcurrentWrites: getEnvInt("MAX_CONCURRENT_WRITES", 32),
+
+			CacheMaxAge:    getEnvDuration("CACHE_MAX_AGE", 0),
+			MaxSinceWindow: getEnvDuration("MAX_SINCE_WINDOW", 30*24*time.Hour),
+
+			MaxRootsPerResponse: getEnvInt("MAX_ROOTS_PER_RESPONSE", 0),
+
+			IDsAsStrings: getEnvBool("IDS_AS_STRINGS", false),
+		},
+		Comments: CommentsConfig{
+			DedupWindow:         getEnvDuration("DEDUP_WINDOW", 0),
+			SimilarityThreshold: getEnvFloat("SIMILARITY_THRESHOLD", 0),
+			SimilarityWindow:    getEnvDuration("SIMILARITY_WINDOW", 10*time.Minute),
+			TrimContent:         getEnvBool("CONTENT_TRIM", true),
+			CollapseWhitespace:  getEnvBool("COLLAPSE_WHITESPACE", false),
+			MaxContentLength:    getEnvInt("MAX_CONTENT_LENGTH", 10000),
+
+			DefaultTTL:          getEnvDuration("DEFAULT_TTL", 0),
+			ExpirySweepInterval: getEnvDuration("EXPIRY_SWEEP_INTERVAL", time.Minute),
+			DeletedIDsRetention: getEnvDuration("DELETED_IDS_RETENTION", 30*24*time.Hour),
+			OrphanSweepInterval: getEnvDuration("ORPHAN_SWEEP_INTERVAL", 0),
+			OrphanSweepFix:      getEnvBool("ORPHAN_SWEEP_FIX", false),
+
+			HotDecay: getEnvDuration("HOT_DECAY", 24*time.Hour),
+
+			MaxSearchResults: getEnvInt("MAX_SEARCH_RESULTS", 1000),
+
+			EventBufferSize: getEnvInt("EVENT_BUFFER_SIZE", 64),
+
+			ViewFlushInterval: getEnvDuration("VIEW_FLUSH_INTERVAL", 10*time.Second),
 		},
 	}
 
+	if !schemaNamePattern.MatchString(cfg.Database.Schema) {
+		return nil, fmt.Errorf("invalid DB_SCHEMA %q: must be an identifier of letters, digits and underscores up to 63 characters", cfg.Database.Schema)
+	}
+
+	if value := os.Getenv("CONTENT_ENCRYPTION_KEY"); value != "" {
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || (len(key) != 16 && len(key) != 24 && len(key) != 32) {
+			return nil, fmt.Errorf("invalid CONTENT_ENCRYPTION_KEY: must be 16, 24 or 32 bytes encoded in base64")
+		}
+		// Проверки дубликатов сравнивают текст в SQL, а шифротексты одинаковых текстов различаются
+		if cfg.Comments.DedupWindow > 0 || cfg.Comments.SimilarityThreshold > 0 {
+			return nil, fmt.Errorf("CONTENT_ENCRYPTION_KEY cannot be combined with DEDUP_WINDOW or SIMILARITY_THRESHOLD")
+		}
+		cfg.Comments.ContentEncryptionKey = key
+	}
+
 	return cfg, nil
 }
 
-// DSN возвращает строку подключения к PostgreSQL
+// schemaNamePattern допустимое имя схемы: идентификатор PostgreSQL без кавычек.
+// Имя подставляется в строку подключения, поэтому других символов не допускаем
+var schemaNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
+// DSN возвращает строку подключения к PostgreSQL. search_path передается как параметр
+// соединения, поэтому неквалифицированные имена таблиц разрешаются в схеме Schema
 func (c *DatabaseConfig) DSN() string {
 	return fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		c.Host, c.Port, c.User, c.Password, c.DBName, c.SSLMode,
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s search_path=%s",
+		c.Host, c.Port, c.User, c.Password, c.DBName, c.SSLMode, c.Schema,
 	)
 }
 
@@ -68,3 +233,39 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
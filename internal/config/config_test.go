@@ -0,0 +1,63 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestLoadSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", value: "", want: "public"},
+		{name: "tenant schema", value: "tenant_42", want: "tenant_42"},
+		{name: "leading underscore", value: "_staging", want: "_staging"},
+		{name: "63 characters", value: strings.Repeat("s", 63), want: strings.Repeat("s", 63)},
+		{name: "64 characters", value: strings.Repeat("s", 64), wantErr: true},
+		{name: "leading digit", value: "1tenant", wantErr: true},
+		{name: "hyphen", value: "tenant-1", wantErr: true},
+		{name: "second parameter", value: "public sslmode=disable", wantErr: true},
+		{name: "sql injection", value: "public; DROP TABLE comments", wantErr: true},
+		{name: "quoted", value: `"Tenant"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DB_SCHEMA", tt.value)
+
+			cfg, err := Load()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Load accepted DB_SCHEMA %q", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Database.Schema != tt.want {
+				t.Errorf("schema = %q, want %q", cfg.Database.Schema, tt.want)
+			}
+		})
+	}
+}
+
+func TestDSNSearchPath(t *testing.T) {
+	cfg := DatabaseConfig{Host: "db", Port: "5432", User: "app", Password: "secret", DBName: "comments", SSLMode: "disable", Schema: "tenant_42"}
+
+	parsed, err := pgx.ParseConfig(cfg.DSN())
+	if err != nil {
+		t.Fatalf("ParseConfig(%q): %v", cfg.DSN(), err)
+	}
+	if got := parsed.RuntimeParams["search_path"]; got != "tenant_42" {
+		t.Errorf("search_path = %q, want %q", got, "tenant_42")
+	}
+	if parsed.Host != "db" || parsed.Database != "comments" || parsed.User != "app" {
+		t.Errorf("parsed config = %s@%s/%s, want app@db/comments", parsed.User, parsed.Host, parsed.Database)
+	}
+}
@@ -0,0 +1,49 @@
+package http
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+)
+
+// maxRetryAfterJitter верхняя граница случайной добавки к Retry-After в секундах
+const maxRetryAfterJitter = 3
+
+// WriteAdmissionMiddleware ограничивает число одновременно выполняемых запросов на запись
+// (всех методов, кроме GET, HEAD и OPTIONS) в масштабе всего сервиса, независимо от IP клиента.
+// Запросы сверх лимита не ждут в очереди, а сразу получают 429 со случайным Retry-After,
+// чтобы повторные попытки клиентов не приходили одновременно. При maxConcurrent <= 0 ограничение отключено
+func WriteAdmissionMiddleware(maxConcurrent int, next http.Handler) http.Handler {
+	if maxConcurrent <= 0 {
+		return next
+	}
+
+	slots := make(chan struct{}, maxConcurrent)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isWriteRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			next.ServeHTTP(w, r)
+		default:
+			retryAfter := 1 + rand.Intn(maxRetryAfterJitter)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			http.Error(w, "too many concurrent writes", http.StatusTooManyRequests)
+		}
+	})
+}
+
+// isWriteRequest сообщает, изменяет ли запрос данные
+func isWriteRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
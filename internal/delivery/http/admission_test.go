@@ -0,0 +1,68 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestWriteAdmissionMiddleware(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := WriteAdmissionMiddleware(1, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("block") == "true" {
+			close(started)
+			<-release
+		}
+	}))
+
+	// Единственный слот занят запросом, который ждет release
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/comments?block=true", nil))
+		done <- rec.Code
+	}()
+	<-started
+
+	tests := []struct {
+		name       string
+		method     string
+		wantStatus int
+	}{
+		{name: "write rejected", method: http.MethodPost, wantStatus: http.StatusTooManyRequests},
+		{name: "delete rejected", method: http.MethodDelete, wantStatus: http.StatusTooManyRequests},
+		{name: "read admitted", method: http.MethodGet, wantStatus: http.StatusOK},
+		{name: "preflight admitted", method: http.MethodOptions, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, "/comments", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusTooManyRequests {
+				return
+			}
+			retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+			if err != nil || retryAfter < 1 || retryAfter > maxRetryAfterJitter {
+				t.Errorf("Retry-After = %q, want 1..%d seconds", rec.Header().Get("Retry-After"), maxRetryAfterJitter)
+			}
+		})
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("blocking write: status = %d, want 200", code)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/comments", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("write after the slot is freed: status = %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,82 @@
+package http
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+)
+
+// sensitiveFieldPattern находит в JSON строковые значения полей, которые нельзя писать в лог
+var sensitiveFieldPattern = regexp.MustCompile(`(?i)("(?:password|token|access_token|refresh_token|secret|api_key|authorization)"\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+
+// BodyLoggingMiddleware пишет в лог на уровне debug тела запроса и ответа для отладки интеграций.
+// Тела копируются по мере чтения и записи обработчиком, поэтому обработчик получает запрос целиком.
+// В лог попадают первые limit байт каждого тела; значения чувствительных полей заменяются на [REDACTED]
+func BodyLoggingMiddleware(logger *slog.Logger, limit int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestBody := &limitedBuffer{limit: limit}
+		if r.Body != nil {
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(r.Body, requestBody), r.Body}
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: w, body: &limitedBuffer{limit: limit}}
+		next.ServeHTTP(recorder, r)
+
+		logger.Debug(
+			"http bodies",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"request_body", redactBody(requestBody.buf),
+			"request_body_truncated", requestBody.truncated,
+			"response_body", redactBody(recorder.body.buf),
+			"response_body_truncated", recorder.body.truncated,
+		)
+	})
+}
+
+// redactBody заменяет значения чувствительных полей тела на [REDACTED]
+func redactBody(body []byte) string {
+	return sensitiveFieldPattern.ReplaceAllString(string(body), `$1"[REDACTED]"`)
+}
+
+// limitedBuffer сохраняет первые limit записанных байт, остальные отбрасывает
+type limitedBuffer struct {
+	buf       []byte
+	limit     int
+	truncated bool
+}
+
+// Write всегда сообщает о записи всех байт, чтобы не прерывать io.TeeReader
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - len(b.buf); room < len(p) {
+		if room > 0 {
+			b.buf = append(b.buf, p[:room]...)
+		}
+		b.truncated = true
+		return len(p), nil
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// bodyRecorder копирует тело ответа в буфер, передавая его клиенту без изменений
+type bodyRecorder struct {
+	http.ResponseWriter
+	body *limitedBuffer
+}
+
+// Write копирует тело ответа в буфер
+func (rec *bodyRecorder) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.body.Write(b[:n])
+	return n, err
+}
+
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController
+func (rec *bodyRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,119 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "no sensitive fields", body: `{"content":"hello","parent_id":1}`, want: `{"content":"hello","parent_id":1}`},
+		{name: "password", body: `{"password":"hunter2"}`, want: `{"password":"[REDACTED]"}`},
+		{name: "case and spacing", body: `{"Access_Token" : "abc"}`, want: `{"Access_Token" : "[REDACTED]"}`},
+		{name: "escaped quote in value", body: `{"secret":"a\"b","content":"ok"}`, want: `{"secret":"[REDACTED]","content":"ok"}`},
+		{name: "value cut by the limit", body: `{"token":"abcd`, want: `{"token":"[REDACTED]"`},
+		{name: "field name inside content", body: `{"content":"my password is x"}`, want: `{"content":"my password is x"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactBody([]byte(tt.body)); got != tt.want {
+				t.Errorf("redactBody(%s) = %s, want %s", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBodyLoggingMiddleware(t *testing.T) {
+	tests := []struct {
+		name              string
+		limit             int
+		requestBody       string
+		responseBody      string
+		wantRequestLog    string
+		wantResponseLog   string
+		wantRequestTrunc  bool
+		wantResponseTrunc bool
+	}{
+		{
+			name:            "bodies logged",
+			limit:           1024,
+			requestBody:     `{"content":"hello"}`,
+			responseBody:    `{"id":1}`,
+			wantRequestLog:  `{"content":"hello"}`,
+			wantResponseLog: `{"id":1}`,
+		},
+		{
+			name:            "sensitive fields redacted",
+			limit:           1024,
+			requestBody:     `{"content":"hi","password":"hunter2"}`,
+			responseBody:    `{"token":"t0k3n"}`,
+			wantRequestLog:  `{"content":"hi","password":"[REDACTED]"}`,
+			wantResponseLog: `{"token":"[REDACTED]"}`,
+		},
+		{
+			name:              "bodies over the limit truncated in the log only",
+			limit:             8,
+			requestBody:       `{"content":"a long comment"}`,
+			responseBody:      `{"id":12345}`,
+			wantRequestLog:    `{"conten`,
+			wantResponseLog:   `{"id":12`,
+			wantRequestTrunc:  true,
+			wantResponseTrunc: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+			var received string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("read body: %v", err)
+				}
+				received = string(body)
+				w.WriteHeader(http.StatusCreated)
+				io.WriteString(w, tt.responseBody)
+			})
+
+			rec := httptest.NewRecorder()
+			BodyLoggingMiddleware(logger, tt.limit, next).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/comments", strings.NewReader(tt.requestBody)))
+
+			if received != tt.requestBody {
+				t.Errorf("handler read %q, want the full body %q", received, tt.requestBody)
+			}
+			if rec.Code != http.StatusCreated || rec.Body.String() != tt.responseBody {
+				t.Errorf("client got %d %q, want %d %q", rec.Code, rec.Body, http.StatusCreated, tt.responseBody)
+			}
+
+			var entry struct {
+				RequestBody           string `json:"request_body"`
+				RequestBodyTruncated  bool   `json:"request_body_truncated"`
+				ResponseBody          string `json:"response_body"`
+				ResponseBodyTruncated bool   `json:"response_body_truncated"`
+			}
+			if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+				t.Fatalf("log %q is not one JSON entry: %v", logs.String(), err)
+			}
+			if entry.RequestBody != tt.wantRequestLog || entry.RequestBodyTruncated != tt.wantRequestTrunc {
+				t.Errorf("logged request %q (truncated %v), want %q (truncated %v)", entry.RequestBody, entry.RequestBodyTruncated, tt.wantRequestLog, tt.wantRequestTrunc)
+			}
+			if entry.ResponseBody != tt.wantResponseLog || entry.ResponseBodyTruncated != tt.wantResponseTrunc {
+				t.Errorf("logged response %q (truncated %v), want %q (truncated %v)", entry.ResponseBody, entry.ResponseBodyTruncated, tt.wantResponseLog, tt.wantResponseTrunc)
+			}
+		})
+	}
+}
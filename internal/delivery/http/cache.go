@@ -0,0 +1,114 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// setCacheControl выставляет Cache-Control для GET ответов.
+// При нулевом maxAge клиенты и прокси обязаны перепроверять ответ через If-None-Match или If-Modified-Since
+func setCacheControl(w http.ResponseWriter, maxAge time.Duration) {
+	if maxAge <= 0 {
+		w.Header().Set("Cache-Control", "no-cache")
+		return
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+}
+
+// writeCachedJSON кодирует response в JSON и отвечает им с ETag - хешем тела ответа - и Last-Modified,
+// если lastModified не нулевое. 304 Not Modified возвращается, если If-None-Match совпадает с ETag,
+// а без If-None-Match - если If-Modified-Since не раньше lastModified (RFC 9110, 13.2.2).
+// Удаление комментария не меняет ни одного updated_at в ответе, поэтому вызывающий включает
+// в lastModified время последнего удаления, а ETag меняется вместе с телом (total, состав страницы)
+func writeCachedJSON(w http.ResponseWriter, r *http.Request, response interface{}, lastModified time.Time) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(response); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(body.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+
+	// HTTP даты имеют точность до секунды, поэтому время сравнивается с отсечением долей секунды
+	lastModified = lastModified.UTC().Truncate(time.Second)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body.Bytes())
+}
+
+// notModified сообщает, можно ли ответить 304 на условный запрос. If-Modified-Since учитывается
+// только без If-None-Match и только при известном lastModified
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, etag)
+	}
+
+	if lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(since)
+}
+
+// lastModified возвращает время последнего изменения ответа: позднейшее из updated - максимума updated_at
+// комментариев ответа - и времени последнего удаления. Если время удаления получить не удалось,
+// возвращается нулевое время и ответ отдается без Last-Modified, чтобы не подтвердить устаревший кеш
+func (h *CommentHandler) lastModified(ctx context.Context, updated time.Time) time.Time {
+	deletedAt, err := h.useCase.LastDeletedAt(ctx)
+	if err != nil {
+		h.logger.Error("failed to get last deletion time", "error", err)
+		return time.Time{}
+	}
+	if deletedAt.After(updated) {
+		return deletedAt
+	}
+	return updated
+}
+
+// latestUpdate возвращает максимальный updated_at среди всех комментариев деревьев
+func latestUpdate(trees []domain.CommentTree) time.Time {
+	var latest time.Time
+	for _, tree := range trees {
+		if tree.Comment.UpdatedAt.After(latest) {
+			latest = tree.Comment.UpdatedAt
+		}
+		if childLatest := latestUpdate(tree.Children); childLatest.After(latest) {
+			latest = childLatest
+		}
+	}
+	return latest
+}
+
+// etagMatches сообщает, содержит ли If-None-Match тег etag или "*". Теги сравниваются слабо
+// (без учета префикса W/), как того требует RFC 9110 для If-None-Match
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
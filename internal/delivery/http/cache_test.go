@@ -0,0 +1,222 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+func TestEtagMatches(t *testing.T) {
+	const etag = `"abc"`
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        bool
+	}{
+		{name: "empty", ifNoneMatch: "", want: false},
+		{name: "same", ifNoneMatch: `"abc"`, want: true},
+		{name: "weak", ifNoneMatch: `W/"abc"`, want: true},
+		{name: "list", ifNoneMatch: `"xyz", "abc"`, want: true},
+		{name: "any", ifNoneMatch: "*", want: true},
+		{name: "other", ifNoneMatch: `"xyz"`, want: false},
+		{name: "unquoted", ifNoneMatch: "abc", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.ifNoneMatch, etag); got != tt.want {
+				t.Errorf("etagMatches(%q) = %v, want %v", tt.ifNoneMatch, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetTreeConditional(t *testing.T) {
+	updated := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tree := func(id int64) domain.CommentTree {
+		return domain.CommentTree{Comment: domain.Comment{ID: id, Content: "text", CreatedAt: updated, UpdatedAt: updated}}
+	}
+
+	// Удаление второй ветки не меняет ни одного updated_at, но меняет страницу и total
+	trees := []domain.CommentTree{tree(1), tree(2)}
+	repo := &stubRepository{
+		getTree: func(ctx context.Context, parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error) {
+			return trees, nil
+		},
+		count: func(ctx context.Context, filter domain.CommentFilter) (int, error) {
+			return len(trees), nil
+		},
+	}
+	h := newTestHandler(repo, Config{})
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/comments", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		h.GetTree(rec, req)
+		return rec
+	}
+
+	first := get("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first request: status %d, ETag %q", first.Code, etag)
+	}
+
+	if rec := get(etag); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("unchanged: status %d, body %q, want 304 without body", rec.Code, rec.Body)
+	}
+
+	trees = trees[:1]
+	rec := get(etag)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("after delete: status %d, want 200", rec.Code)
+	}
+	if rec.Header().Get("ETag") == etag {
+		t.Error("ETag must change after a delete")
+	}
+}
+
+func TestSummaryConditional(t *testing.T) {
+	activity := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	// Удаление ответа уменьшает comment_count, но оставляет last_activity_at прежним
+	count := 3
+	repo := &stubRepository{
+		getThreadSummary: func(ctx context.Context, id int64) (*domain.ThreadSummary, error) {
+			return &domain.ThreadSummary{
+				Root:           domain.Comment{ID: id, Content: "root", CreatedAt: activity, UpdatedAt: activity},
+				CommentCount:   count,
+				LastActivityAt: activity,
+			}, nil
+		},
+	}
+	h := newTestHandler(repo, Config{})
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/comments/1/summary", nil)
+		req.SetPathValue("id", "1")
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		h.Summary(rec, req)
+		return rec
+	}
+
+	first := get("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first request: status %d, ETag %q", first.Code, etag)
+	}
+	if first.Header().Get("Last-Modified") != "" {
+		t.Error("Last-Modified must not be sent: it ignores deleted replies")
+	}
+
+	if rec := get(etag); rec.Code != http.StatusNotModified {
+		t.Fatalf("unchanged: status %d, want 304", rec.Code)
+	}
+
+	count = 2
+	if rec := get(etag); rec.Code != http.StatusOK {
+		t.Fatalf("after reply delete: status %d, want 200", rec.Code)
+	}
+}
+
+func TestGetTreeLastModified(t *testing.T) {
+	root := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	reply := root.Add(time.Hour)
+	deleted := root.Add(2 * time.Hour)
+
+	tests := []struct {
+		name             string
+		lastDeletedAt    time.Time
+		deletedErr       error
+		ifModifiedSince  time.Time
+		ifNoneMatch      string
+		wantLastModified time.Time // нулевое - заголовка нет
+		wantStatus       int
+	}{
+		{name: "newest reply", wantLastModified: reply, wantStatus: http.StatusOK},
+		{name: "deletion after updates", lastDeletedAt: deleted, wantLastModified: deleted, wantStatus: http.StatusOK},
+		{name: "deletion before updates", lastDeletedAt: root, wantLastModified: reply, wantStatus: http.StatusOK},
+		{name: "not modified", ifModifiedSince: reply, wantLastModified: reply, wantStatus: http.StatusNotModified},
+		{name: "modified", ifModifiedSince: root, wantLastModified: reply, wantStatus: http.StatusOK},
+		{name: "modified by deletion", lastDeletedAt: deleted, ifModifiedSince: reply, wantLastModified: deleted, wantStatus: http.StatusOK},
+		{name: "if-none-match wins", ifModifiedSince: reply, ifNoneMatch: `"stale"`, wantLastModified: reply, wantStatus: http.StatusOK},
+		{name: "deletion time unknown", deletedErr: errors.New("boom"), ifModifiedSince: reply, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &stubRepository{
+				getTree: func(ctx context.Context, parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error) {
+					return []domain.CommentTree{{
+						Comment:  domain.Comment{ID: 1, CreatedAt: root, UpdatedAt: root},
+						Children: []domain.CommentTree{{Comment: domain.Comment{ID: 2, CreatedAt: reply, UpdatedAt: reply}}},
+					}}, nil
+				},
+				count: func(ctx context.Context, filter domain.CommentFilter) (int, error) {
+					return 1, nil
+				},
+				lastDeletedAt: func(ctx context.Context) (time.Time, error) {
+					return tt.lastDeletedAt, tt.deletedErr
+				},
+			}
+			h := newTestHandler(repo, Config{})
+
+			req := httptest.NewRequest(http.MethodGet, "/comments", nil)
+			if !tt.ifModifiedSince.IsZero() {
+				req.Header.Set("If-Modified-Since", tt.ifModifiedSince.Format(http.TimeFormat))
+			}
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			rec := httptest.NewRecorder()
+			h.GetTree(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			want := ""
+			if !tt.wantLastModified.IsZero() {
+				want = tt.wantLastModified.Format(http.TimeFormat)
+			}
+			if got := rec.Header().Get("Last-Modified"); got != want {
+				t.Errorf("Last-Modified = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestLatestUpdate(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tree := func(offset time.Duration, children ...domain.CommentTree) domain.CommentTree {
+		return domain.CommentTree{Comment: domain.Comment{UpdatedAt: base.Add(offset)}, Children: children}
+	}
+
+	tests := []struct {
+		name  string
+		trees []domain.CommentTree
+		want  time.Time
+	}{
+		{name: "empty", trees: nil},
+		{name: "roots", trees: []domain.CommentTree{tree(time.Hour), tree(2 * time.Hour)}, want: base.Add(2 * time.Hour)},
+		{name: "nested reply", trees: []domain.CommentTree{tree(time.Hour, tree(0, tree(3*time.Hour)))}, want: base.Add(3 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := latestUpdate(tt.trees); !got.Equal(tt.want) {
+				t.Errorf("latestUpdate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
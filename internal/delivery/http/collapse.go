@@ -0,0 +1,42 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// parseCollapseAfter разбирает параметр collapse_after: 0, если параметр не указан,
+// иначе положительное число ответов каждого комментария, которые остаются развернутыми
+func parseCollapseAfter(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("collapse_after")
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, &domain.ValidationError{
+			Field:   "collapse_after",
+			Message: fmt.Sprintf("collapse_after must be a positive integer, got %q", value),
+		}
+	}
+	return n, nil
+}
+
+// applyCollapse отмечает как свернутые ответы каждого комментария, начиная с (n+1)-го.
+// Свернутые ответы остаются в дереве, это лишь подсказка клиенту для "показать еще".
+// При n == 0 деревья не меняются
+func applyCollapse(trees []CommentTreeResponse, n int) {
+	if n == 0 {
+		return
+	}
+	for i := range trees {
+		for j := range trees[i].Children {
+			trees[i].Children[j].Collapsed = j >= n
+		}
+		applyCollapse(trees[i].Children, n)
+	}
+}
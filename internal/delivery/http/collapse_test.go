@@ -0,0 +1,103 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseCollapseAfter(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{name: "absent", query: "", want: 0},
+		{name: "positive", query: "?collapse_after=3", want: 3},
+		{name: "zero", query: "?collapse_after=0", wantErr: true},
+		{name: "not a number", query: "?collapse_after=all", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCollapseAfter(httptest.NewRequest(http.MethodGet, "/comments"+tt.query, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("collapse_after = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// collapsedIDs возвращает идентификаторы свернутых комментариев деревьев в порядке обхода
+func collapsedIDs(trees []CommentTreeResponse) []int64 {
+	ids := []int64{}
+	for _, tree := range trees {
+		if tree.Collapsed {
+			ids = append(ids, tree.Comment.ID.value)
+		}
+		ids = append(ids, collapsedIDs(tree.Children)...)
+	}
+	return ids
+}
+
+func TestApplyCollapse(t *testing.T) {
+	tests := []struct {
+		name  string
+		trees []CommentTreeResponse
+		n     int
+		want  []int64
+	}{
+		{
+			name:  "disabled",
+			trees: []CommentTreeResponse{treeResponse(1, treeResponse(2), treeResponse(3))},
+			n:     0,
+			want:  []int64{},
+		},
+		{
+			name:  "within limit",
+			trees: []CommentTreeResponse{treeResponse(1, treeResponse(2), treeResponse(3))},
+			n:     2,
+			want:  []int64{},
+		},
+		{
+			name:  "replies over limit",
+			trees: []CommentTreeResponse{treeResponse(1, treeResponse(2), treeResponse(3), treeResponse(4))},
+			n:     1,
+			want:  []int64{3, 4},
+		},
+		{
+			name: "roots never collapsed",
+			trees: []CommentTreeResponse{
+				treeResponse(1),
+				treeResponse(2),
+			},
+			n:    1,
+			want: []int64{},
+		},
+		{
+			name: "every level",
+			trees: []CommentTreeResponse{
+				treeResponse(1,
+					treeResponse(2, treeResponse(4), treeResponse(5)),
+					treeResponse(3, treeResponse(6)),
+				),
+			},
+			n:    1,
+			want: []int64{5, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applyCollapse(tt.trees, tt.n)
+			if got := collapsedIDs(tt.trees); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("collapsed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// Context обрабатывает GET /comments/{id}/context: комментарий, его родитель, соседи и прямые ответы
+// одним запросом для показа ответа в контексте беседы. Соседи и ответы листаются независимо
+// параметрами siblings_page и children_page с общим page_size
+func (h *CommentHandler) Context(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid comment id", http.StatusBadRequest)
+		return
+	}
+
+	siblingsPage, err := parsePageParam(r, "siblings_page")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	childrenPage, err := parsePageParam(r, "children_page")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pageSize := defaultPageSize
+	if value := r.URL.Query().Get("page_size"); value != "" {
+		pageSize, err = parsePageSize(value, h.cfg.MaxPageSize)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	format, err := h.responseFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	commentContext, err := h.useCase.GetContext(r.Context(), id, siblingsPage, childrenPage, pageSize)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrCommentNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, domain.ErrCommentDeleted):
+			http.Error(w, err.Error(), http.StatusGone)
+		default:
+			writeServerError(w, err)
+		}
+		return
+	}
+
+	response := CommentContextResponse{
+		Comment:       toCommentResponse(&commentContext.Comment, format),
+		Siblings:      toCommentResponseList(commentContext.Siblings, format),
+		SiblingsTotal: commentContext.SiblingsTotal,
+		SiblingsPage:  siblingsPage,
+		Children:      toCommentResponseList(commentContext.Children, format),
+		ChildrenTotal: commentContext.ChildrenTotal,
+		ChildrenPage:  childrenPage,
+		PageSize:      pageSize,
+	}
+	if commentContext.Parent != nil {
+		parent := toCommentResponse(commentContext.Parent, format)
+		response.Parent = &parent
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// parsePageParam разбирает номер страницы из параметра name; по умолчанию первая страница
+func parsePageParam(r *http.Request, name string) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 1, nil
+	}
+
+	page, err := strconv.Atoi(value)
+	if err != nil || page < 1 {
+		return 0, &domain.ValidationError{
+			Field:   name,
+			Message: fmt.Sprintf("%s must be a positive integer, got %q", name, value),
+		}
+	}
+	return page, nil
+}
+
+// toCommentResponseList преобразует список комментариев; пустой список выводится как []
+func toCommentResponseList(comments []domain.Comment, format responseFormat) []CommentResponse {
+	response := make([]CommentResponse, 0, len(comments))
+	for i := range comments {
+		response = append(response, toCommentResponse(&comments[i], format))
+	}
+	return response
+}
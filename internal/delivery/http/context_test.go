@@ -0,0 +1,119 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+func TestContext(t *testing.T) {
+	one := int64(1)
+	comments := map[int64]domain.Comment{
+		1: {ID: 1, Content: "root"},
+		2: {ID: 2, Content: "other root"},
+		3: {ID: 3, ParentID: &one, Content: "reply"},
+	}
+
+	tests := []struct {
+		name         string
+		id           string
+		query        string
+		wantStatus   int
+		wantParent   bool
+		wantSiblings []int64
+		wantChildren []int64
+		wantCalls    []string
+	}{
+		{
+			name: "root", id: "1", wantStatus: http.StatusOK,
+			wantSiblings: []int64{1, 2}, wantChildren: []int64{3},
+			wantCalls: []string{"roots 50+0", "1 50+0"},
+		},
+		{
+			name: "reply", id: "3", query: "?siblings_page=2&children_page=3&page_size=5", wantStatus: http.StatusOK,
+			wantParent: true, wantSiblings: []int64{3}, wantChildren: []int64{},
+			wantCalls: []string{"1 5+5", "3 5+10"},
+		},
+		{name: "invalid page", id: "1", query: "?siblings_page=0", wantStatus: http.StatusBadRequest},
+		{name: "missing", id: "42", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			repo := &stubRepository{
+				getByID: func(ctx context.Context, id int64) (*domain.Comment, error) {
+					c, ok := comments[id]
+					if !ok {
+						return nil, domain.ErrCommentNotFound
+					}
+					return &c, nil
+				},
+				// Соседи и ответы читаются одним запросом прямых ответов, без построения деревьев
+				getReplies: func(ctx context.Context, parentID *int64, limit, offset int) ([]domain.Comment, error) {
+					parent := "roots"
+					if parentID != nil {
+						parent = fmt.Sprint(*parentID)
+					}
+					calls = append(calls, fmt.Sprintf("%s %d+%d", parent, limit, offset))
+
+					replies := []domain.Comment{}
+					for id := int64(1); id <= 3; id++ {
+						c := comments[id]
+						if (parentID == nil) == (c.ParentID == nil) && (parentID == nil || *parentID == *c.ParentID) {
+							replies = append(replies, c)
+						}
+					}
+					return replies, nil
+				},
+				count: func(ctx context.Context, filter domain.CommentFilter) (int, error) {
+					return 0, nil
+				},
+			}
+			h := newTestHandler(repo, Config{})
+
+			req := httptest.NewRequest(http.MethodGet, "/comments/"+tt.id+"/context"+tt.query, nil)
+			req.SetPathValue("id", tt.id)
+			rec := httptest.NewRecorder()
+			h.Context(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("GetReplies calls = %v, want %v", calls, tt.wantCalls)
+			}
+
+			var got CommentContextResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body is not JSON: %v", err)
+			}
+			if (got.Parent != nil) != tt.wantParent {
+				t.Errorf("parent = %v, want present %v", got.Parent, tt.wantParent)
+			}
+			if ids := responseIDs(got.Siblings); !reflect.DeepEqual(ids, tt.wantSiblings) {
+				t.Errorf("siblings = %v, want %v", ids, tt.wantSiblings)
+			}
+			if ids := responseIDs(got.Children); !reflect.DeepEqual(ids, tt.wantChildren) {
+				t.Errorf("children = %v, want %v", ids, tt.wantChildren)
+			}
+		})
+	}
+}
+
+func responseIDs(comments []CommentResponse) []int64 {
+	ids := make([]int64, len(comments))
+	for i := range comments {
+		ids[i] = comments[i].ID.value
+	}
+	return ids
+}
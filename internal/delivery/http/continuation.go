@@ -0,0 +1,75 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// parseMaxRenderDepth разбирает параметр max_render_depth: 0, если параметр не указан,
+// иначе положительная глубина, глубже которой ветки выносятся в продолжения
+func parseMaxRenderDepth(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("max_render_depth")
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, &domain.ValidationError{
+			Field:   "max_render_depth",
+			Message: fmt.Sprintf("max_render_depth must be a positive integer, got %q", value),
+		}
+	}
+	return n, nil
+}
+
+// splitContinuations отрезает от деревьев ответы глубже maxDepth (корень на глубине 0) и возвращает их
+// отдельными деревьями-продолжениями: у узла на глубине maxDepth выставляется Continued, а каждый его
+// ответ становится корнем продолжения с ContinuedFrom, равным ID этого узла. Продолжения сами
+// разбиваются так же, поэтому ни одно возвращаемое дерево не глубже maxDepth. При maxDepth == 0
+// деревья не меняются
+func splitContinuations(trees []CommentTreeResponse, maxDepth int) []CommentTreeResponse {
+	if maxDepth == 0 {
+		return nil
+	}
+
+	var continuations []CommentTreeResponse
+	for i := range trees {
+		cutDeep(&trees[i], 0, maxDepth, &continuations)
+	}
+	// Продолжения добавляются в конец списка по ходу обхода, поэтому вложенные продолжения тоже разбиваются
+	for i := 0; i < len(continuations); i++ {
+		cutDeep(&continuations[i], 0, maxDepth, &continuations)
+	}
+
+	for i := range continuations {
+		continuations[i].SiblingIndex = i
+		continuations[i].SiblingCount = len(continuations)
+	}
+	return continuations
+}
+
+// cutDeep переносит в continuations ответы узлов дерева tree, находящихся на глубине maxDepth
+func cutDeep(tree *CommentTreeResponse, depth, maxDepth int, continuations *[]CommentTreeResponse) {
+	if depth < maxDepth {
+		for i := range tree.Children {
+			cutDeep(&tree.Children[i], depth+1, maxDepth, continuations)
+		}
+		return
+	}
+	if len(tree.Children) == 0 {
+		return
+	}
+
+	parentID := tree.Comment.ID
+	for _, child := range tree.Children {
+		child.ContinuedFrom = &parentID
+		child.Collapsed = false
+		*continuations = append(*continuations, child)
+	}
+	tree.Children = []CommentTreeResponse{}
+	tree.Continued = true
+}
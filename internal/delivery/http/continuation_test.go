@@ -0,0 +1,163 @@
+package http
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseMaxRenderDepth(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{query: "", want: 0},
+		{query: "max_render_depth=1", want: 1},
+		{query: "max_render_depth=8", want: 8},
+		{query: "max_render_depth=0", wantErr: true},
+		{query: "max_render_depth=-2", wantErr: true},
+		{query: "max_render_depth=deep", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := parseMaxRenderDepth(httptest.NewRequest("GET", "/comments?"+tt.query, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseMaxRenderDepth = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// treeIDs возвращает ID комментариев дерева в порядке обхода в глубину
+func treeIDs(tree CommentTreeResponse) []int64 {
+	ids := []int64{tree.Comment.ID.value}
+	for _, child := range tree.Children {
+		ids = append(ids, treeIDs(child)...)
+	}
+	return ids
+}
+
+func TestSplitContinuations(t *testing.T) {
+	tests := []struct {
+		name     string
+		trees    func() []CommentTreeResponse
+		maxDepth int
+		// wantTrees и wantContinuations - ID в порядке обхода для каждого дерева
+		wantTrees         [][]int64
+		wantContinuations [][]int64
+		wantFrom          []int64
+	}{
+		{
+			name: "disabled",
+			trees: func() []CommentTreeResponse {
+				return []CommentTreeResponse{treeResponse(1, treeResponse(2, treeResponse(3)))}
+			},
+			maxDepth:  0,
+			wantTrees: [][]int64{{1, 2, 3}},
+		},
+		{
+			name: "shallow",
+			trees: func() []CommentTreeResponse {
+				return []CommentTreeResponse{treeResponse(1, treeResponse(2))}
+			},
+			maxDepth:  2,
+			wantTrees: [][]int64{{1, 2}},
+		},
+		{
+			name: "cut at depth",
+			trees: func() []CommentTreeResponse {
+				return []CommentTreeResponse{treeResponse(1, treeResponse(2, treeResponse(3), treeResponse(4)))}
+			},
+			maxDepth:          1,
+			wantTrees:         [][]int64{{1, 2}},
+			wantContinuations: [][]int64{{3}, {4}},
+			wantFrom:          []int64{2, 2},
+		},
+		{
+			name: "continuations are split too",
+			trees: func() []CommentTreeResponse {
+				return []CommentTreeResponse{treeResponse(1, treeResponse(2, treeResponse(3, treeResponse(4, treeResponse(5)))))}
+			},
+			maxDepth:          1,
+			wantTrees:         [][]int64{{1, 2}},
+			wantContinuations: [][]int64{{3, 4}, {5}},
+			wantFrom:          []int64{2, 4},
+		},
+		{
+			name: "several roots",
+			trees: func() []CommentTreeResponse {
+				return []CommentTreeResponse{
+					treeResponse(1, treeResponse(2, treeResponse(3))),
+					treeResponse(4, treeResponse(5, treeResponse(6))),
+				}
+			},
+			maxDepth:          1,
+			wantTrees:         [][]int64{{1, 2}, {4, 5}},
+			wantContinuations: [][]int64{{3}, {6}},
+			wantFrom:          []int64{2, 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trees := tt.trees()
+			continuations := splitContinuations(trees, tt.maxDepth)
+
+			var gotTrees [][]int64
+			for _, tree := range trees {
+				gotTrees = append(gotTrees, treeIDs(tree))
+			}
+			if !reflect.DeepEqual(gotTrees, tt.wantTrees) {
+				t.Errorf("trees = %v, want %v", gotTrees, tt.wantTrees)
+			}
+
+			var gotContinuations [][]int64
+			var gotFrom []int64
+			for i, continuation := range continuations {
+				gotContinuations = append(gotContinuations, treeIDs(continuation))
+				if continuation.ContinuedFrom != nil {
+					gotFrom = append(gotFrom, continuation.ContinuedFrom.value)
+				}
+				if continuation.SiblingIndex != i || continuation.SiblingCount != len(continuations) {
+					t.Errorf("continuation %d sibling %d of %d", i, continuation.SiblingIndex, continuation.SiblingCount)
+				}
+			}
+			if !reflect.DeepEqual(gotContinuations, tt.wantContinuations) {
+				t.Errorf("continuations = %v, want %v", gotContinuations, tt.wantContinuations)
+			}
+			if !reflect.DeepEqual(gotFrom, tt.wantFrom) {
+				t.Errorf("continued_from = %v, want %v", gotFrom, tt.wantFrom)
+			}
+
+			if tt.maxDepth == 0 {
+				return
+			}
+			for _, tree := range append(trees, continuations...) {
+				if depth := treeDepth(&tree); depth > tt.maxDepth {
+					t.Errorf("tree %d has depth %d, want at most %d", tree.Comment.ID.value, depth, tt.maxDepth)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitContinuationsMarksCutNodes(t *testing.T) {
+	collapsed := treeResponse(3)
+	collapsed.Collapsed = true
+	trees := []CommentTreeResponse{treeResponse(1, treeResponse(2, collapsed))}
+
+	continuations := splitContinuations(trees, 1)
+
+	cut := trees[0].Children[0]
+	if !cut.Continued || len(cut.Children) != 0 || cut.Children == nil {
+		t.Errorf("cut node = %+v, want continued with an empty children list", cut)
+	}
+	if len(continuations) != 1 || continuations[0].Collapsed {
+		t.Errorf("continuations = %+v, want one expanded continuation", continuations)
+	}
+}
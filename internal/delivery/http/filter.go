@@ -0,0 +1,162 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// defaultPageSize размер страницы, если page_size не указан
+const defaultPageSize = 50
+
+// parseCommentFilter собирает domain.CommentFilter из параметров запроса GET /comments.
+// Здесь сосредоточены разбор, проверка и значения по умолчанию для всех параметров;
+// при некорректном значении возвращается *domain.ValidationError
+func parseCommentFilter(r *http.Request, cfg Config) (domain.CommentFilter, error) {
+	query := r.URL.Query()
+
+	filter := domain.CommentFilter{
+		Search:   query.Get("search"),
+		Page:     1,
+		PageSize: defaultPageSize,
+		SortBy:   "created_at",
+		Order:    "desc",
+		View:     domain.ViewTree,
+	}
+
+	switch view := query.Get("view"); view {
+	case "", domain.ViewTree:
+	case domain.ViewTimeline, domain.ViewRoots:
+		filter.View = view
+	default:
+		return domain.CommentFilter{}, &domain.ValidationError{
+			Field:   "view",
+			Message: fmt.Sprintf("view must be %q, %q or %q, got %q", domain.ViewTree, domain.ViewTimeline, domain.ViewRoots, view),
+		}
+	}
+
+	if parentIDStr := query.Get("parent"); parentIDStr != "" {
+		parentID, err := strconv.ParseInt(parentIDStr, 10, 64)
+		if err != nil {
+			return domain.CommentFilter{}, &domain.ValidationError{
+				Field:   "parent",
+				Message: "invalid parent_id",
+			}
+		}
+		filter.ParentID = &parentID
+	}
+
+	if pageStr := query.Get("page"); pageStr != "" {
+		page, err := parsePage(pageStr)
+		if err != nil {
+			return domain.CommentFilter{}, err
+		}
+		filter.Page = page
+	}
+
+	if pageSizeStr := query.Get("page_size"); pageSizeStr != "" {
+		pageSize, err := parsePageSize(pageSizeStr, cfg.MaxPageSize)
+		if err != nil {
+			return domain.CommentFilter{}, err
+		}
+		filter.PageSize = pageSize
+	}
+
+	if sinceStr := query.Get("since"); sinceStr != "" {
+		since, err := parseSince(sinceStr, cfg.MaxSinceWindow)
+		if err != nil {
+			return domain.CommentFilter{}, err
+		}
+		createdAfter := time.Now().Add(-since)
+		filter.CreatedAfter = &createdAfter
+	}
+
+	// Неизвестные значения сортировки игнорируются, используется сортировка по умолчанию
+	if sortBy := query.Get("sort_by"); sortBy == "created_at" || sortBy == "updated_at" || sortBy == domain.SortHot {
+		filter.SortBy = sortBy
+	}
+
+	if order := query.Get("order"); order == "asc" || order == "desc" {
+		filter.Order = order
+	}
+
+	return filter, nil
+}
+
+// parsePagination разбирает параметры page и page_size для списков вне GET /comments.
+// Отсутствующие параметры заменяются на первую страницу и defaultPageSize
+func parsePagination(r *http.Request, maxPageSize int) (int, int, error) {
+	page, pageSize := 1, defaultPageSize
+	if value := r.URL.Query().Get("page"); value != "" {
+		parsed, err := parsePage(value)
+		if err != nil {
+			return 0, 0, err
+		}
+		page = parsed
+	}
+	if value := r.URL.Query().Get("page_size"); value != "" {
+		parsed, err := parsePageSize(value, maxPageSize)
+		if err != nil {
+			return 0, 0, err
+		}
+		pageSize = parsed
+	}
+	return page, pageSize, nil
+}
+
+// parsePage разбирает номер страницы, который должен быть >= 1
+func parsePage(value string) (int, error) {
+	page, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &domain.ValidationError{
+			Field:   "page",
+			Message: fmt.Sprintf("page must be an integer, got %q", value),
+		}
+	}
+	if page < 1 {
+		return 0, &domain.ValidationError{
+			Field:   "page",
+			Message: fmt.Sprintf("page must be >= 1, got %d", page),
+		}
+	}
+	return page, nil
+}
+
+// parsePageSize разбирает размер страницы, который должен быть в диапазоне [1, maxPageSize]
+func parsePageSize(value string, maxPageSize int) (int, error) {
+	pageSize, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &domain.ValidationError{
+			Field:   "page_size",
+			Message: fmt.Sprintf("page_size must be an integer, got %q", value),
+		}
+	}
+	if pageSize < 1 || pageSize > maxPageSize {
+		return 0, &domain.ValidationError{
+			Field:   "page_size",
+			Message: fmt.Sprintf("page_size must be between 1 and %d, got %d", maxPageSize, pageSize),
+		}
+	}
+	return pageSize, nil
+}
+
+// parseSince разбирает относительное окно вида "24h", которое должно быть положительным и не больше maxWindow
+func parseSince(value string, maxWindow time.Duration) (time.Duration, error) {
+	since, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, &domain.ValidationError{
+			Field:   "since",
+			Message: fmt.Sprintf("since must be a duration like 1h or 30m, got %q", value),
+		}
+	}
+	if since <= 0 || since > maxWindow {
+		return 0, &domain.ValidationError{
+			Field:   "since",
+			Message: fmt.Sprintf("since must be between 0 and %s, got %s", maxWindow, since),
+		}
+	}
+	return since, nil
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+func TestParseCommentFilter(t *testing.T) {
+	cfg := Config{MaxPageSize: 100, MaxSinceWindow: 24 * time.Hour}
+	parentID := int64(5)
+
+	tests := []struct {
+		name      string
+		query     string
+		want      domain.CommentFilter
+		wantField string // поле *domain.ValidationError, "" - ошибки нет
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want:  domain.CommentFilter{Page: 1, PageSize: defaultPageSize, SortBy: "created_at", Order: "desc", View: domain.ViewTree},
+		},
+		{
+			name:  "all parameters",
+			query: "?search=go&parent=5&page=3&page_size=20&sort_by=updated_at&order=asc&view=timeline",
+			want:  domain.CommentFilter{Search: "go", ParentID: &parentID, Page: 3, PageSize: 20, SortBy: "updated_at", Order: "asc", View: domain.ViewTimeline},
+		},
+		{
+			name:  "hot sort",
+			query: "?sort_by=hot&view=roots",
+			want:  domain.CommentFilter{Page: 1, PageSize: defaultPageSize, SortBy: domain.SortHot, Order: "desc", View: domain.ViewRoots},
+		},
+		{
+			name:  "unknown sort and order ignored",
+			query: "?sort_by=content&order=sideways",
+			want:  domain.CommentFilter{Page: 1, PageSize: defaultPageSize, SortBy: "created_at", Order: "desc", View: domain.ViewTree},
+		},
+		{name: "unknown view", query: "?view=grid", wantField: "view"},
+		{name: "invalid parent", query: "?parent=abc", wantField: "parent"},
+		{name: "page not a number", query: "?page=x", wantField: "page"},
+		{name: "page zero", query: "?page=0", wantField: "page"},
+		{name: "page size zero", query: "?page_size=0", wantField: "page_size"},
+		{name: "page size above max", query: "?page_size=101", wantField: "page_size"},
+		{name: "since not a duration", query: "?since=yesterday", wantField: "since"},
+		{name: "since negative", query: "?since=-1h", wantField: "since"},
+		{name: "since above max", query: "?since=25h", wantField: "since"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCommentFilter(httptest.NewRequest(http.MethodGet, "/comments"+tt.query, nil), cfg)
+
+			if tt.wantField != "" {
+				var validation *domain.ValidationError
+				if !errors.As(err, &validation) || validation.Field != tt.wantField {
+					t.Fatalf("error = %v, want validation error for %q", err, tt.wantField)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCommentFilter: %v", err)
+			}
+			if (got.ParentID == nil) != (tt.want.ParentID == nil) || got.ParentID != nil && *got.ParentID != *tt.want.ParentID {
+				t.Errorf("parent = %v, want %v", got.ParentID, tt.want.ParentID)
+			}
+			got.ParentID, tt.want.ParentID = nil, nil
+			if got != tt.want {
+				t.Errorf("filter = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCommentFilterSince(t *testing.T) {
+	one := int64(1)
+	tests := []struct {
+		name       string
+		query      string
+		wantParent *int64
+	}{
+		{name: "roots", query: "?since=2h"},
+		{name: "with parent", query: "?parent=1&since=2h", wantParent: &one},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now()
+			filter, err := parseCommentFilter(httptest.NewRequest(http.MethodGet, "/comments"+tt.query, nil), Config{MaxPageSize: 100, MaxSinceWindow: 24 * time.Hour})
+			if err != nil {
+				t.Fatalf("parseCommentFilter: %v", err)
+			}
+			if filter.CreatedAfter == nil {
+				t.Fatal("created_after is not set")
+			}
+			if want := before.Add(-2 * time.Hour); filter.CreatedAfter.Before(want) || filter.CreatedAfter.After(time.Now().Add(-2*time.Hour)) {
+				t.Errorf("created_after = %v, want about %v", filter.CreatedAfter, want)
+			}
+			if !reflect.DeepEqual(filter.ParentID, tt.wantParent) {
+				t.Errorf("parent = %v, want %v", filter.ParentID, tt.wantParent)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package http
+
+import (
+	"net/http"
+	"time"
+)
+
+// responseFormat настройки представления комментариев в ответе на конкретный запрос:
+// часовой пояс меток времени (параметр tz) и сериализация ID строками (IDS_AS_STRINGS)
+type responseFormat struct {
+	loc          *time.Location
+	idsAsStrings bool
+}
+
+// responseFormat возвращает формат ответа на запрос r с настройками обработчика
+func (h *CommentHandler) responseFormat(r *http.Request) (responseFormat, error) {
+	loc, err := parseTimezone(r)
+	if err != nil {
+		return responseFormat{}, err
+	}
+	return responseFormat{loc: loc, idsAsStrings: h.cfg.IDsAsStrings}, nil
+}
+
+// time форматирует метку времени в часовом поясе ответа
+func (f responseFormat) time(t time.Time) string {
+	return formatTime(t, f.loc)
+}
+
+// id преобразует ID из домена в DTO
+func (f responseFormat) id(id int64) CommentID {
+	return newCommentID(id, f.idsAsStrings)
+}
+
+// idPtr преобразует необязательный ID из домена в DTO
+func (f responseFormat) idPtr(id *int64) *CommentID {
+	if id == nil {
+		return nil
+	}
+	converted := f.id(*id)
+	return &converted
+}
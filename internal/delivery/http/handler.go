@@ -2,144 +2,748 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/oziev02/CommentTree/internal/domain"
 	"github.com/oziev02/CommentTree/internal/usecase"
 )
 
+// Config содержит ограничения, применяемые обработчиками к входным параметрам
+type Config struct {
+	MaxPageSize    int
+	MaxRecentLimit int
+	// MaxReplyCountIDs максимальное число ID в запросе POST /comments/reply-counts
+	MaxReplyCountIDs int
+	CacheMaxAge      time.Duration
+	MaxSinceWindow   time.Duration
+	// MaxRootsPerResponse ограничение page_size для списков корневых веток (0 - без ограничения)
+	MaxRootsPerResponse int
+	// IDsAsStrings сериализация ID комментариев JSON-строками вместо чисел
+	IDsAsStrings bool
+}
+
 // CommentHandler обрабатывает HTTP запросы для комментариев
 type CommentHandler struct {
 	useCase *usecase.CommentUseCase
+	logger  *slog.Logger
+	cfg     Config
 }
 
 // NewCommentHandler создает новый экземпляр CommentHandler
-func NewCommentHandler(useCase *usecase.CommentUseCase) *CommentHandler {
-	return &CommentHandler{useCase: useCase}
+func NewCommentHandler(useCase *usecase.CommentUseCase, logger *slog.Logger, cfg Config) *CommentHandler {
+	return &CommentHandler{useCase: useCase, logger: logger, cfg: cfg}
 }
 
 // CreateCommentRequest DTO для создания комментария
 type CreateCommentRequest struct {
-	ParentID *int64 `json:"parent_id"`
-	Content  string `json:"content"`
+	ParentID  *CommentID `json:"parent_id"`
+	Content   string     `json:"content"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	ClientRef string     `json:"client_ref"`
 }
 
 // CommentResponse DTO для ответа с комментарием
 type CommentResponse struct {
-	ID        int64  `json:"id"`
-	ParentID  *int64 `json:"parent_id,omitempty"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
+	ID        CommentID  `json:"id"`
+	ParentID  *CommentID `json:"parent_id,omitempty"`
+	Content   string     `json:"content"`
+	CreatedAt string     `json:"created_at"`
+	UpdatedAt string     `json:"updated_at"`
+	IsEdited  bool       `json:"is_edited"`
+	EditedAt  *string    `json:"edited_at,omitempty"`
+	Accepted  bool       `json:"accepted"`
+	ExpiresAt *string    `json:"expires_at,omitempty"`
+	Slug      string     `json:"slug"`
+	ClientRef string     `json:"client_ref,omitempty"`
+	// ContentHash хеш нормализованного текста, по нему ищутся копии через GET /content-hashes/{hash}
+	ContentHash string `json:"content_hash"`
+	ViewCount   int64  `json:"view_count"`
+	// ChildrenCollapsed подсказка показывать ответы свернутыми по умолчанию (см. POST /comments/{id}/collapse-children)
+	ChildrenCollapsed bool `json:"children_collapsed"`
+	// Truncated выставляется, если текст обрезан параметром snippet_length
+	Truncated bool `json:"truncated,omitempty"`
 }
 
-// CommentTreeResponse DTO для ответа с деревом комментариев
+// CommentTreeResponse DTO для ответа с деревом комментариев.
+// Поле children выводится всегда, для листьев - как пустой массив.
+// Collapsed выставляется у ответов сверх collapse_after.
+// SiblingIndex - позиция узла (с нуля) среди соседей в ответе, SiblingCount - число соседей вместе с ним.
+// MaxDepth заполняется только у корня ответа: глубина самого глубокого потомка (0, если ответов нет).
+// DirectReplyCount заполняется только в режиме view=roots, где children всегда пуст.
+// Continued выставляется у узла, ответы которого вынесены в продолжения (max_render_depth),
+// ContinuedFrom - у корня продолжения: ID узла, от которого отрезана ветка.
+// Matched выставляется в результатах поиска у комментариев, совпавших с запросом
 type CommentTreeResponse struct {
-	Comment  CommentResponse       `json:"comment"`
-	Children []CommentTreeResponse `json:"children,omitempty"`
+	Comment          CommentResponse       `json:"comment"`
+	Children         []CommentTreeResponse `json:"children"`
+	Collapsed        bool                  `json:"collapsed,omitempty"`
+	SiblingIndex     int                   `json:"sibling_index"`
+	SiblingCount     int                   `json:"sibling_count"`
+	MaxDepth         *int                  `json:"max_depth,omitempty"`
+	DirectReplyCount *int                  `json:"direct_reply_count,omitempty"`
+	Continued        bool                  `json:"continued,omitempty"`
+	ContinuedFrom    *CommentID            `json:"continued_from,omitempty"`
+	Matched          bool                  `json:"matched,omitempty"`
 }
 
-// CommentsListResponse DTO для списка комментариев с пагинацией
+// CommentsListResponse DTO для списка комментариев с пагинацией.
+// Total равен -1, если общее количество получить не удалось.
+// Truncated выставляется, если поиск нашел больше веток, чем MAX_SEARCH_RESULTS.
+// Continuations - ветки глубже max_render_depth, вынесенные из Comments
 type CommentsListResponse struct {
-	Comments []CommentTreeResponse `json:"comments"`
-	Total    int                   `json:"total"`
-	Page     int                   `json:"page"`
-	PageSize int                   `json:"page_size"`
+	Comments      []CommentTreeResponse `json:"comments"`
+	Total         int                   `json:"total"`
+	Page          int                   `json:"page"`
+	PageSize      int                   `json:"page_size"`
+	Truncated     bool                  `json:"truncated,omitempty"`
+	Continuations []CommentTreeResponse `json:"continuations,omitempty"`
+}
+
+// TimelineCommentResponse DTO для комментария плоской ленты
+type TimelineCommentResponse struct {
+	CommentResponse
+	Depth       int  `json:"depth"`
+	HasChildren bool `json:"has_children"`
+}
+
+// TimelineResponse DTO для плоской ленты комментариев с пагинацией по комментариям
+type TimelineResponse struct {
+	Comments []TimelineCommentResponse `json:"comments"`
+	Total    int                       `json:"total"`
+	Page     int                       `json:"page"`
+	PageSize int                       `json:"page_size"`
+}
+
+// CreatedCommentContextResponse DTO для созданного комментария с его положением в дереве
+type CreatedCommentContextResponse struct {
+	CommentResponse
+	Depth     int               `json:"depth"`
+	RootID    CommentID         `json:"root_id"`
+	Ancestors []CommentResponse `json:"ancestors"`
+}
+
+// CreatedCommentWithPreviousResponse DTO для созданного комментария с предшествующим ему
+// комментарием того же родителя; previous равен null, если созданный комментарий первый
+type CreatedCommentWithPreviousResponse struct {
+	CommentResponse
+	Previous *CommentResponse `json:"previous"`
+}
+
+// RecentCommentResponse DTO для комментария из ленты последних
+type RecentCommentResponse struct {
+	CommentResponse
+	RootID CommentID `json:"root_id"`
+}
+
+// RecentCommentsResponse DTO для ленты последних комментариев
+type RecentCommentsResponse struct {
+	Comments []RecentCommentResponse `json:"comments"`
+}
+
+// MentionsResponse DTO для списка комментариев, упоминающих пользователя
+type MentionsResponse struct {
+	Comments []CommentResponse `json:"comments"`
+	Page     int               `json:"page"`
+	PageSize int               `json:"page_size"`
+}
+
+// ContentHashResponse DTO для списка комментариев с одинаковым хешем текста
+type ContentHashResponse struct {
+	Comments []CommentResponse `json:"comments"`
+	Page     int               `json:"page"`
+	PageSize int               `json:"page_size"`
+}
+
+// LocateResponse DTO для положения ветки комментария в списке корневых комментариев
+type LocateResponse struct {
+	RootID CommentID `json:"root_id"`
+	Page   int       `json:"page"`
+	Index  int       `json:"index"`
+}
+
+// ThreadSummaryResponse DTO для краткой сводки ветки
+type ThreadSummaryResponse struct {
+	ID             CommentID `json:"id"`
+	Content        string    `json:"content"`
+	Truncated      bool      `json:"truncated,omitempty"`
+	Slug           string    `json:"slug"`
+	CommentCount   int       `json:"comment_count"`
+	LastActivityAt string    `json:"last_activity_at"`
+}
+
+// CommentContextResponse DTO для комментария в контексте беседы
+type CommentContextResponse struct {
+	Comment       CommentResponse   `json:"comment"`
+	Parent        *CommentResponse  `json:"parent"`
+	Siblings      []CommentResponse `json:"siblings"`
+	SiblingsTotal int               `json:"siblings_total"`
+	SiblingsPage  int               `json:"siblings_page"`
+	Children      []CommentResponse `json:"children"`
+	ChildrenTotal int               `json:"children_total"`
+	ChildrenPage  int               `json:"children_page"`
+	PageSize      int               `json:"page_size"`
+}
+
+// ValidateCommentResponse DTO для проверки комментария без создания (validate_only).
+// NormalizedContent - текст, который был бы сохранен; заполняется, только если проверка пройдена
+type ValidateCommentResponse struct {
+	Valid             bool     `json:"valid"`
+	NormalizedContent string   `json:"normalized_content,omitempty"`
+	Errors            []string `json:"errors"`
 }
 
+// ErrorResponse DTO для ошибки в формате JSON
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// ContentErrorResponse DTO для ответа 422 на недопустимый текст комментария.
+// Limit и Actual выводятся только для ограничений длины
+type ContentErrorResponse struct {
+	Error      string `json:"error"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion"`
+	Limit      int    `json:"limit,omitempty"`
+	Actual     int    `json:"actual,omitempty"`
+}
+
+// ReplyCountsRequest DTO для запроса числа ответов
+type ReplyCountsRequest struct {
+	IDs []CommentID `json:"ids"`
+}
+
+// UpdateCommentRequest DTO для изменения текста комментария
+type UpdateCommentRequest struct {
+	Content string `json:"content"`
+}
+
+// CollapseChildrenRequest DTO для POST /comments/{id}/collapse-children
+type CollapseChildrenRequest struct {
+	Collapsed *bool `json:"collapsed"`
+}
+
+// defaultRecentLimit количество последних комментариев, если limit не указан
+const defaultRecentLimit = 20
+
 // Create обрабатывает POST /comments
 func (h *CommentHandler) Create(w http.ResponseWriter, r *http.Request) {
+	// Тело "null" декодируется в пустой запрос и отклоняется ниже как ErrEmptyContent
 	var req CreateCommentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if errors.Is(err, io.EOF) {
+			http.Error(w, "request body is required", http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	comment, err := h.useCase.Create(r.Context(), req.ParentID, req.Content)
+	format, err := h.responseFormat(r)
 	if err != nil {
-		switch err {
-		case domain.ErrEmptyContent:
-			http.Error(w, err.Error(), http.StatusBadRequest)
-		case domain.ErrInvalidParent:
-			http.Error(w, err.Error(), http.StatusBadRequest)
-		default:
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("validate_only") == "true" || r.Header.Get("X-Validate-Only") == "true" {
+		h.validateCreate(w, r, req)
+		return
+	}
+
+	returnMode := r.URL.Query().Get("return")
+	if returnMode != "" && returnMode != "subtree" {
+		http.Error(w, fmt.Sprintf("return must be %q, got %q", "subtree", returnMode), http.StatusBadRequest)
+		return
+	}
+
+	withPrevious := r.URL.Query().Get("with_previous") == "true"
+	if withPrevious && (returnMode == "subtree" || r.URL.Query().Get("include_context") == "true") {
+		http.Error(w, "with_previous cannot be combined with return=subtree or include_context", http.StatusBadRequest)
+		return
+	}
+
+	var comment *domain.Comment
+	var thread *domain.CommentTree
+	if returnMode == "subtree" {
+		comment, thread, err = h.useCase.CreateWithThread(r.Context(), fromCommentIDPtr(req.ParentID), req.Content, req.ExpiresAt, req.ClientRef)
+	} else {
+		comment, err = h.useCase.Create(r.Context(), fromCommentIDPtr(req.ParentID), req.Content, req.ExpiresAt, req.ClientRef)
+	}
+	if err != nil {
+		var invalid domain.ValidationErrors
+		if contentErr, ok := asContentError(err); ok && !errors.As(err, &invalid) {
+			writeContentError(w, contentErr)
+			return
 		}
+		if status := createErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		writeServerError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+
+	if thread != nil {
+		response := toCommentTreeResponse(*thread, format)
+		setMaxDepth(&response)
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if r.URL.Query().Get("include_context") == "true" {
+		// Комментарий уже создан, поэтому при ошибке получения контекста отдаем его без контекста
+		ancestors, err := h.useCase.GetAncestors(r.Context(), comment.ID)
+		if err == nil {
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(toCreatedCommentContextResponse(comment, ancestors, format))
+			return
+		}
+		h.logger.Error("failed to get comment ancestors", "id", comment.ID, "error", err)
+	}
+
+	if withPrevious {
+		// Как и с include_context: комментарий уже создан, при ошибке отдаем его без previous
+		previous, err := h.useCase.GetPrevious(r.Context(), comment.ID)
+		if err == nil {
+			response := CreatedCommentWithPreviousResponse{CommentResponse: toCommentResponse(comment, format)}
+			if previous != nil {
+				previousResponse := toCommentResponse(previous, format)
+				response.Previous = &previousResponse
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		h.logger.Error("failed to get previous comment", "id", comment.ID, "error", err)
+	}
+
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(toCommentResponse(comment))
+	json.NewEncoder(w).Encode(toCommentResponse(comment, format))
+}
+
+// validateCreate обрабатывает POST /comments?validate_only=true: выполняет ту же обработку
+// и проверки, что и создание, но ничего не сохраняет. Ошибки проверки возвращаются в теле с кодом 200
+func (h *CommentHandler) validateCreate(w http.ResponseWriter, r *http.Request, req CreateCommentRequest) {
+	comment, err := h.useCase.Validate(r.Context(), fromCommentIDPtr(req.ParentID), req.Content, req.ExpiresAt, req.ClientRef)
+	if err != nil && createErrorStatus(err) == 0 {
+		writeServerError(w, err)
+		return
+	}
+
+	response := ValidateCommentResponse{
+		Valid:  err == nil,
+		Errors: make([]string, 0),
+	}
+	var invalid domain.ValidationErrors
+	if errors.As(err, &invalid) {
+		for _, e := range invalid {
+			response.Errors = append(response.Errors, e.Error())
+		}
+	} else if err != nil {
+		response.Errors = append(response.Errors, err.Error())
+	} else {
+		response.NormalizedContent = comment.Content
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// asContentError извлекает из err ошибку текста, которая отдается ответом 422.
+// Пустой текст, как и раньше, отклоняется обычным ответом 400
+func asContentError(err error) (*domain.ContentError, bool) {
+	var contentErr *domain.ContentError
+	if !errors.As(err, &contentErr) || errors.Is(err, domain.ErrEmptyContent) {
+		return nil, false
+	}
+	return contentErr, true
+}
+
+// writeContentError отвечает 422 с кодом ошибки текста и подсказкой, как его исправить
+func writeContentError(w http.ResponseWriter, err *domain.ContentError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(ContentErrorResponse{
+		Error:      err.Code,
+		Message:    err.Error(),
+		Suggestion: err.Suggestion,
+		Limit:      err.Limit,
+		Actual:     err.Actual,
+	})
+}
+
+// createErrorStatus возвращает код ответа для ошибки проверки при создании комментария
+// или 0, если ошибка не связана с данными запроса
+func createErrorStatus(err error) int {
+	var validationErr *domain.ValidationError
+	var contentErr *domain.ContentError
+	var invalid domain.ValidationErrors
+	switch {
+	case errors.As(err, &invalid):
+		// Несколько ошибок разных видов отдаются одним ответом 400
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrEmptyContent):
+		// Проверяется раньше ContentError: пустой текст отклоняется с кодом 400, а не 422
+		return http.StatusBadRequest
+	case errors.As(err, &contentErr):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &validationErr):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrContentTooLong):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrInvalidParent):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrInvalidExpiry):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrDuplicateComment), errors.Is(err, domain.ErrProbableDuplicate), errors.Is(err, domain.ErrParentDeleted):
+		return http.StatusConflict
+	default:
+		return 0
+	}
 }
 
 // GetTree обрабатывает GET /comments
 func (h *CommentHandler) GetTree(w http.ResponseWriter, r *http.Request) {
-	filter := domain.CommentFilter{}
+	filter, err := parseCommentFilter(r, h.cfg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if parentIDStr := r.URL.Query().Get("parent"); parentIDStr != "" {
-		parentID, err := strconv.ParseInt(parentIDStr, 10, 64)
-		if err != nil {
-			http.Error(w, "invalid parent_id", http.StatusBadRequest)
-			return
-		}
-		filter.ParentID = &parentID
+	snippetLength, err := parseSnippetLength(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	if search := r.URL.Query().Get("search"); search != "" {
-		filter.Search = search
+	collapseAfter, err := parseCollapseAfter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		page, err := strconv.Atoi(pageStr)
-		if err == nil && page > 0 {
-			filter.Page = page
-		}
+	short, err := parseShortFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	if pageSizeStr := r.URL.Query().Get("page_size"); pageSizeStr != "" {
-		pageSize, err := strconv.Atoi(pageSizeStr)
-		if err == nil && pageSize > 0 {
-			filter.PageSize = pageSize
-		}
+	maxRenderDepth, err := parseMaxRenderDepth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	if sortBy := r.URL.Query().Get("sort_by"); sortBy != "" {
-		if sortBy == "created_at" || sortBy == "updated_at" {
-			filter.SortBy = sortBy
-		}
+	filter = h.capRoots(filter)
+
+	format, err := h.responseFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if filter.View == domain.ViewTimeline {
+		h.getTimeline(w, r, filter, snippetLength, format)
+		return
+	}
+
+	if filter.Search != "" && filter.View == domain.ViewTree && wantsNDJSON(r) {
+		h.streamSearch(w, r, filter, snippetLength, collapseAfter, maxRenderDepth, short, format)
+		return
 	}
 
-	if order := r.URL.Query().Get("order"); order != "" {
-		if order == "asc" || order == "desc" {
-			filter.Order = order
+	trees, truncated, err := h.useCase.GetTree(r.Context(), filter)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+
+	// Общее количество не критично для ответа: при ошибке отдаем деревья без него
+	total, err := h.useCase.GetTotalCount(r.Context(), filter)
+	if err != nil {
+		h.logger.Error("failed to count comments", "error", err)
+		total = -1
+	}
+	setPaginationHeaders(w, r, filter.Page, filter.PageSize, total)
+
+	response := CommentsListResponse{
+		Comments:  toCommentTreeResponseList(pruneShort(trees, short), format),
+		Total:     total,
+		Page:      filter.Page,
+		PageSize:  filter.PageSize,
+		Truncated: truncated,
+	}
+	applySnippetTrees(response.Comments, snippetLength)
+	if filter.View == domain.ViewRoots {
+		if err := h.collapseToRoots(r.Context(), response.Comments); err != nil {
+			writeServerError(w, err)
+			return
+		}
+	} else {
+		applyCollapse(response.Comments, collapseAfter)
+		response.Continuations = splitContinuations(response.Comments, maxRenderDepth)
+		for i := range response.Comments {
+			setMaxDepth(&response.Comments[i])
+		}
+		for i := range response.Continuations {
+			setMaxDepth(&response.Continuations[i])
 		}
 	}
 
-	trees, err := h.useCase.GetTree(r.Context(), filter)
+	setCacheControl(w, h.cfg.CacheMaxAge)
+	writeCachedJSON(w, r, response, h.lastModified(r.Context(), latestUpdate(trees)))
+}
+
+// capRoots ограничивает размер страницы списка корневых веток значением MaxRootsPerResponse независимо
+// от page_size: вместе с глубокими ветками большая страница дает слишком большой ответ.
+// Лента (view=timeline) не содержит деревьев и не ограничивается
+func (h *CommentHandler) capRoots(filter domain.CommentFilter) domain.CommentFilter {
+	if filter.View == domain.ViewTimeline || h.cfg.MaxRootsPerResponse <= 0 || filter.PageSize <= h.cfg.MaxRootsPerResponse {
+		return filter
+	}
+
+	h.logger.Info("page size capped", "requested", filter.PageSize, "cap", h.cfg.MaxRootsPerResponse)
+	filter.PageSize = h.cfg.MaxRootsPerResponse
+	return filter
+}
+
+// getTimeline обрабатывает GET /comments?view=timeline
+func (h *CommentHandler) getTimeline(w http.ResponseWriter, r *http.Request, filter domain.CommentFilter, snippetLength int, format responseFormat) {
+	timeline, err := h.useCase.GetTimeline(r.Context(), filter)
 	if err != nil {
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		writeServerError(w, err)
 		return
 	}
 
-	total, err := h.useCase.GetTotalCount(r.Context(), filter.ParentID, filter.Search)
+	total, err := h.useCase.GetTotalCount(r.Context(), filter)
 	if err != nil {
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		h.logger.Error("failed to count comments", "error", err)
+		total = -1
+	}
+	setPaginationHeaders(w, r, filter.Page, filter.PageSize, total)
+
+	// Лента плоская, поэтому клиенту нужно знать, есть ли у комментария ответы, чтобы показать кнопку раскрытия
+	ids := make([]int64, len(timeline))
+	for i := range timeline {
+		ids[i] = timeline[i].Comment.ID
+	}
+	hasChildren, err := h.useCase.HasChildren(r.Context(), ids)
+	if err != nil {
+		writeServerError(w, err)
 		return
 	}
 
-	response := CommentsListResponse{
-		Comments: toCommentTreeResponseList(trees),
+	response := TimelineResponse{
+		Comments: make([]TimelineCommentResponse, 0, len(timeline)),
 		Total:    total,
 		Page:     filter.Page,
 		PageSize: filter.PageSize,
 	}
+	var updated time.Time
+	for _, item := range timeline {
+		if item.Comment.UpdatedAt.After(updated) {
+			updated = item.Comment.UpdatedAt
+		}
+		comment := toCommentResponse(&item.Comment, format)
+		applySnippet(&comment, snippetLength)
+		response.Comments = append(response.Comments, TimelineCommentResponse{
+			CommentResponse: comment,
+			Depth:           item.Depth,
+			HasChildren:     hasChildren[item.Comment.ID],
+		})
+	}
+
+	setCacheControl(w, h.cfg.CacheMaxAge)
+	writeCachedJSON(w, r, response, h.lastModified(r.Context(), updated))
+}
+
+// GetRecent обрабатывает GET /comments/recent
+func (h *CommentHandler) GetRecent(w http.ResponseWriter, r *http.Request) {
+	limit := defaultRecentLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 {
+			http.Error(w, fmt.Sprintf("limit must be a positive integer, got %q", limitStr), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	if limit > h.cfg.MaxRecentLimit {
+		limit = h.cfg.MaxRecentLimit
+	}
+
+	snippetLength, err := parseSnippetLength(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format, err := h.responseFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recent, err := h.useCase.GetRecent(r.Context(), limit)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+
+	response := RecentCommentsResponse{
+		Comments: make([]RecentCommentResponse, 0, len(recent)),
+	}
+	for _, item := range recent {
+		comment := toCommentResponse(&item.Comment, format)
+		applySnippet(&comment, snippetLength)
+		response.Comments = append(response.Comments, RecentCommentResponse{
+			CommentResponse: comment,
+			RootID:          format.id(item.RootID),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetMentions обрабатывает GET /mentions/{username}
+func (h *CommentHandler) GetMentions(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+
+	page, pageSize, err := parsePagination(r, h.cfg.MaxPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snippetLength, err := parseSnippetLength(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format, err := h.responseFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comments, err := h.useCase.GetByMention(r.Context(), username, page, pageSize)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+
+	response := MentionsResponse{
+		Comments: make([]CommentResponse, 0, len(comments)),
+		Page:     page,
+		PageSize: pageSize,
+	}
+	for i := range comments {
+		comment := toCommentResponse(&comments[i], format)
+		applySnippet(&comment, snippetLength)
+		response.Comments = append(response.Comments, comment)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetByContentHash обрабатывает GET /content-hashes/{hash}
+func (h *CommentHandler) GetByContentHash(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, err := parsePagination(r, h.cfg.MaxPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format, err := h.responseFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comments, err := h.useCase.GetByContentHash(r.Context(), r.PathValue("hash"), page, pageSize)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidHash):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			writeServerError(w, err)
+		}
+		return
+	}
+
+	response := ContentHashResponse{
+		Comments: make([]CommentResponse, 0, len(comments)),
+		Page:     page,
+		PageSize: pageSize,
+	}
+	for i := range comments {
+		response.Comments = append(response.Comments, toCommentResponse(&comments[i], format))
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// ReplyCounts обрабатывает POST /comments/reply-counts.
+// Возвращает объект {id: число ответов}; несуществующие комментарии в него не попадают
+func (h *CommentHandler) ReplyCounts(w http.ResponseWriter, r *http.Request) {
+	var req ReplyCountsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if errors.Is(err, io.EOF) {
+			http.Error(w, "request body is required", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > h.cfg.MaxReplyCountIDs {
+		http.Error(w, fmt.Sprintf("ids must contain at most %d items, got %d", h.cfg.MaxReplyCountIDs, len(req.IDs)), http.StatusBadRequest)
+		return
+	}
+	ids := fromCommentIDs(req.IDs)
+	if err := assertUniqueIDs("ids", ids); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	counts, err := h.useCase.CountReplies(r.Context(), ids)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
+
+// assertUniqueIDs проверяет, что в списке ID из поля field нет повторов, до обращения к БД.
+// Повтор в пакетном запросе почти всегда ошибка клиента, и его результат был бы неочевиден
+func assertUniqueIDs(field string, ids []int64) error {
+	seen := make(map[int64]struct{}, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			return &domain.ValidationError{
+				Field:   field,
+				Message: fmt.Sprintf("%s must not contain duplicates, got %d more than once", field, id),
+			}
+		}
+		seen[id] = struct{}{}
+	}
+	return nil
+}
+
 // Delete обрабатывает DELETE /comments/{id}
 func (h *CommentHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
@@ -149,12 +753,24 @@ func (h *CommentHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.useCase.Delete(r.Context(), id); err != nil {
-		switch err {
-		case domain.ErrCommentNotFound:
+	strategy := r.URL.Query().Get("strategy")
+	switch strategy {
+	case "":
+		strategy = domain.DeleteCascade
+	case domain.DeleteCascade, domain.DeleteReparent:
+	default:
+		http.Error(w, fmt.Sprintf("strategy must be %q or %q, got %q", domain.DeleteCascade, domain.DeleteReparent, strategy), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.useCase.Delete(r.Context(), id, strategy); err != nil {
+		switch {
+		case errors.Is(err, domain.ErrCommentNotFound):
 			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, domain.ErrCommentDeleted):
+			http.Error(w, err.Error(), http.StatusGone)
 		default:
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+			writeServerError(w, err)
 		}
 		return
 	}
@@ -162,36 +778,355 @@ func (h *CommentHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// Accept обрабатывает POST /comments/{id}/accept
+func (h *CommentHandler) Accept(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid comment id", http.StatusBadRequest)
+		return
+	}
+
+	format, err := h.responseFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comment, err := h.useCase.Accept(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrCommentNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, domain.ErrCommentDeleted):
+			http.Error(w, err.Error(), http.StatusGone)
+		case errors.Is(err, domain.ErrCannotAcceptRoot):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			writeServerError(w, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toCommentResponse(comment, format))
+}
+
+// Update обрабатывает PATCH /comments/{id}
+func (h *CommentHandler) Update(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid comment id", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if errors.Is(err, io.EOF) {
+			http.Error(w, "request body is required", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	format, err := h.responseFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comment, err := h.useCase.Update(r.Context(), id, req.Content)
+	if err != nil {
+		if contentErr, ok := asContentError(err); ok {
+			writeContentError(w, contentErr)
+			return
+		}
+		switch {
+		case errors.Is(err, domain.ErrEmptyContent):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, domain.ErrCommentNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, domain.ErrCommentDeleted):
+			http.Error(w, err.Error(), http.StatusGone)
+		default:
+			writeServerError(w, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toCommentResponse(comment, format))
+}
+
+// CollapseChildren обрабатывает POST /comments/{id}/collapse-children.
+// Тело {"collapsed": false} снимает флаг; без тела или без поля флаг выставляется
+func (h *CommentHandler) CollapseChildren(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid comment id", http.StatusBadRequest)
+		return
+	}
+
+	var req CollapseChildrenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	collapsed := req.Collapsed == nil || *req.Collapsed
+
+	format, err := h.responseFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comment, err := h.useCase.SetChildrenCollapsed(r.Context(), id, collapsed)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrCommentNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, domain.ErrCommentDeleted):
+			http.Error(w, err.Error(), http.StatusGone)
+		default:
+			writeServerError(w, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toCommentResponse(comment, format))
+}
+
+// GetBySlug обрабатывает GET /permalinks/{slug}
+func (h *CommentHandler) GetBySlug(w http.ResponseWriter, r *http.Request) {
+	format, err := h.responseFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comment, err := h.useCase.GetBySlug(r.Context(), r.PathValue("slug"))
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrCommentNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			writeServerError(w, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toCommentResponse(comment, format))
+}
+
+// Locate обрабатывает GET /comments/{id}/locate
+func (h *CommentHandler) Locate(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid comment id", http.StatusBadRequest)
+		return
+	}
+
+	// Страница вычисляется для тех же параметров, что и список GET /comments
+	filter, err := parseCommentFilter(r, h.cfg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Рейтинг hot зависит от времени запроса и меняется между запросами, поэтому
+	// вычисленная по нему страница не совпала бы со страницей следующего GET /comments
+	if filter.SortBy == domain.SortHot {
+		http.Error(w, "sort_by=hot is not supported by locate", http.StatusBadRequest)
+		return
+	}
+
+	location, err := h.useCase.Locate(r.Context(), id, h.capRoots(filter))
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrCommentNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, domain.ErrCommentDeleted):
+			http.Error(w, err.Error(), http.StatusGone)
+		default:
+			writeServerError(w, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LocateResponse{
+		RootID: newCommentID(location.RootID, h.cfg.IDsAsStrings),
+		Page:   location.Page,
+		Index:  location.Index,
+	})
+}
+
+// defaultSummaryLength длина текста корневого комментария в сводке ветки, если snippet_length не указан
+const defaultSummaryLength = 200
+
+// Summary обрабатывает GET /comments/{id}/summary
+func (h *CommentHandler) Summary(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid comment id", http.StatusBadRequest)
+		return
+	}
+
+	snippetLength, err := parseSnippetLength(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if snippetLength == 0 {
+		snippetLength = defaultSummaryLength
+	}
+
+	format, err := h.responseFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	summary, err := h.useCase.GetThreadSummary(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrCommentNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, domain.ErrCommentDeleted):
+			http.Error(w, err.Error(), http.StatusGone)
+		default:
+			writeServerError(w, err)
+		}
+		return
+	}
+
+	root := toCommentResponse(&summary.Root, format)
+	applySnippet(&root, snippetLength)
+
+	// last_activity_at не меняется при удалении ответа, а comment_count меняется,
+	// поэтому валидатором служит ETag тела, а не Last-Modified
+	setCacheControl(w, h.cfg.CacheMaxAge)
+	writeCachedJSON(w, r, ThreadSummaryResponse{
+		ID:             root.ID,
+		Content:        root.Content,
+		Truncated:      root.Truncated,
+		Slug:           root.Slug,
+		CommentCount:   summary.CommentCount,
+		LastActivityAt: format.time(summary.LastActivityAt),
+	}, time.Time{})
+}
+
+// writeServerError отвечает 503, если хранилище временно недоступно, 501, если поиск отключен
+// шифрованием текста, и 500 в остальных случаях
+func writeServerError(w http.ResponseWriter, err error) {
+	if errors.Is(err, domain.ErrServiceUnavailable) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, domain.ErrSearchDisabled) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	http.Error(w, "internal server error", http.StatusInternalServerError)
+}
+
+// editTolerance минимальная разница между UpdatedAt и CreatedAt, при которой комментарий считается отредактированным.
+// Create записывает обе метки одним значением, допуск защищает от расхождений точности при хранении
+const editTolerance = time.Second
+
 // toCommentResponse преобразует domain.Comment в CommentResponse
-func toCommentResponse(c *domain.Comment) CommentResponse {
-	return CommentResponse{
-		ID:        c.ID,
-		ParentID:  c.ParentID,
-		Content:   c.Content,
-		CreatedAt: c.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt: c.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+func toCommentResponse(c *domain.Comment, format responseFormat) CommentResponse {
+	response := CommentResponse{
+		ID:                format.id(c.ID),
+		ParentID:          format.idPtr(c.ParentID),
+		Content:           c.Content,
+		CreatedAt:         format.time(c.CreatedAt),
+		UpdatedAt:         format.time(c.UpdatedAt),
+		Accepted:          c.Accepted,
+		Slug:              c.Slug,
+		ClientRef:         c.ClientRef,
+		ContentHash:       c.ContentHash,
+		ViewCount:         c.ViewCount,
+		ChildrenCollapsed: c.ChildrenCollapsed,
+	}
+
+	if c.UpdatedAt.Sub(c.CreatedAt) >= editTolerance {
+		response.IsEdited = true
+		response.EditedAt = &response.UpdatedAt
+	}
+
+	if c.ExpiresAt != nil {
+		expiresAt := format.time(*c.ExpiresAt)
+		response.ExpiresAt = &expiresAt
 	}
+
+	return response
 }
 
-// toCommentTreeResponse преобразует domain.CommentTree в CommentTreeResponse
-func toCommentTreeResponse(tree domain.CommentTree) CommentTreeResponse {
-	response := CommentTreeResponse{
-		Comment:  toCommentResponse(&tree.Comment),
-		Children: make([]CommentTreeResponse, 0, len(tree.Children)),
+// toCreatedCommentContextResponse дополняет созданный комментарий глубиной, корнем и предками
+func toCreatedCommentContextResponse(c *domain.Comment, ancestors []domain.Comment, format responseFormat) CreatedCommentContextResponse {
+	response := CreatedCommentContextResponse{
+		CommentResponse: toCommentResponse(c, format),
+		Depth:           len(ancestors),
+		RootID:          format.id(c.ID),
+		Ancestors:       make([]CommentResponse, 0, len(ancestors)),
 	}
 
-	for _, child := range tree.Children {
-		response.Children = append(response.Children, toCommentTreeResponse(child))
+	if len(ancestors) > 0 {
+		response.RootID = format.id(ancestors[0].ID)
+	}
+	for i := range ancestors {
+		response.Ancestors = append(response.Ancestors, toCommentResponse(&ancestors[i], format))
 	}
 
 	return response
 }
 
-// toCommentTreeResponseList преобразует список domain.CommentTree в список CommentTreeResponse
-func toCommentTreeResponseList(trees []domain.CommentTree) []CommentTreeResponse {
+// toCommentTreeResponse преобразует domain.CommentTree в CommentTreeResponse
+// Отдельное дерево считается единственным в своем списке; позиции ответов задаются по их порядку
+func toCommentTreeResponse(tree domain.CommentTree, format responseFormat) CommentTreeResponse {
+	response := CommentTreeResponse{
+		Comment:      toCommentResponse(&tree.Comment, format),
+		Children:     toCommentTreeResponseList(tree.Children, format),
+		SiblingCount: 1,
+		Matched:      tree.Matched,
+	}
+
+	return response
+}
+
+// toCommentTreeResponseList преобразует список domain.CommentTree в список CommentTreeResponse,
+// проставляя каждому дереву его позицию в списке
+func toCommentTreeResponseList(trees []domain.CommentTree, format responseFormat) []CommentTreeResponse {
 	responses := make([]CommentTreeResponse, 0, len(trees))
-	for _, tree := range trees {
-		responses = append(responses, toCommentTreeResponse(tree))
+	for i, tree := range trees {
+		response := toCommentTreeResponse(tree, format)
+		response.SiblingIndex = i
+		response.SiblingCount = len(trees)
+		responses = append(responses, response)
 	}
 	return responses
 }
+
+// setMaxDepth заполняет MaxDepth корня дерева
+func setMaxDepth(tree *CommentTreeResponse) {
+	depth := treeDepth(tree)
+	tree.MaxDepth = &depth
+}
+
+// treeDepth возвращает глубину самого глубокого потомка относительно корня дерева
+func treeDepth(tree *CommentTreeResponse) int {
+	maxDepth := 0
+	for i := range tree.Children {
+		if depth := treeDepth(&tree.Children[i]) + 1; depth > maxDepth {
+			maxDepth = depth
+		}
+	}
+	return maxDepth
+}
@@ -0,0 +1,1257 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+	"github.com/oziev02/CommentTree/internal/usecase"
+)
+
+func TestAssertUniqueIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		ids     []int64
+		wantErr string
+	}{
+		{name: "empty", ids: nil},
+		{name: "single", ids: []int64{1}},
+		{name: "unique", ids: []int64{3, 1, 2}},
+		{name: "duplicate", ids: []int64{1, 2, 1}, wantErr: "ids must not contain duplicates, got 1 more than once"},
+		{name: "first duplicate reported", ids: []int64{5, 7, 7, 5}, wantErr: "got 7 more than once"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := assertUniqueIDs("ids", tt.ids)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("error = %v, want nil", err)
+				}
+				return
+			}
+
+			var validation *domain.ValidationError
+			if !errors.As(err, &validation) || validation.Field != "ids" {
+				t.Fatalf("error = %v, want ValidationError for ids", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReplyCounts(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "counts", body: `{"ids": [1, "2"]}`, wantStatus: http.StatusOK, wantBody: `{"1":4,"2":0}`},
+		{name: "duplicate", body: `{"ids": [1, 2, 1]}`, wantStatus: http.StatusBadRequest, wantBody: "duplicates"},
+		{name: "duplicate as string and number", body: `{"ids": [1, "1"]}`, wantStatus: http.StatusBadRequest, wantBody: "duplicates"},
+		{name: "too many", body: `{"ids": [1, 2, 3, 4]}`, wantStatus: http.StatusBadRequest, wantBody: "at most 3"},
+		{name: "missing body", body: ``, wantStatus: http.StatusBadRequest, wantBody: "request body is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			repo := &stubRepository{
+				countReplies: func(ctx context.Context, ids []int64) (map[int64]int, error) {
+					called = true
+					counts := make(map[int64]int, len(ids))
+					for _, id := range ids {
+						counts[id] = 0
+					}
+					counts[1] = 4
+					return counts, nil
+				},
+			}
+			h := newTestHandler(repo, Config{MaxReplyCountIDs: 3})
+
+			req := httptest.NewRequest(http.MethodPost, "/comments/reply-counts", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			h.ReplyCounts(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body, tt.wantBody)
+			}
+			if tt.wantStatus != http.StatusOK && called {
+				t.Error("rejected request must not reach the repository")
+			}
+		})
+	}
+}
+
+func TestCreateContentError(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		want       ContentErrorResponse
+	}{
+		{
+			name:       "too long",
+			body:       `{"content": "hello world"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			want:       ContentErrorResponse{Error: domain.ContentTooLong, Message: domain.ErrContentTooLong.Error(), Suggestion: "remove 6 characters", Limit: 5, Actual: 11},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Текст отклоняется до обращения к БД, поэтому репозиторий не нужен
+			h := newTestHandlerWithUseCase(&stubRepository{}, Config{}, usecase.Config{
+				ContentProcessors: []usecase.ContentProcessor{usecase.TrimSpace(), usecase.MaxLength(5)},
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/comments", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			h.Create(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			var got ContentErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+			}
+			if got != tt.want {
+				t.Errorf("body = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapRoots(t *testing.T) {
+	tests := []struct {
+		name     string
+		cap      int
+		view     string
+		pageSize int
+		want     int
+	}{
+		{name: "no cap", cap: 0, view: domain.ViewTree, pageSize: 500, want: 500},
+		{name: "below cap", cap: 100, view: domain.ViewTree, pageSize: 20, want: 20},
+		{name: "at cap", cap: 100, view: domain.ViewTree, pageSize: 100, want: 100},
+		{name: "above cap", cap: 100, view: domain.ViewTree, pageSize: 500, want: 100},
+		{name: "roots view", cap: 100, view: domain.ViewRoots, pageSize: 500, want: 100},
+		{name: "timeline is not capped", cap: 100, view: domain.ViewTimeline, pageSize: 500, want: 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(&stubRepository{}, Config{MaxRootsPerResponse: tt.cap})
+
+			got := h.capRoots(domain.CommentFilter{View: tt.view, PageSize: tt.pageSize})
+			if got.PageSize != tt.want {
+				t.Errorf("page size = %d, want %d", got.PageSize, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetTreeReportsCappedPageSize(t *testing.T) {
+	var requested int
+	repo := &stubRepository{
+		getTree: func(ctx context.Context, parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error) {
+			requested = filter.PageSize
+			return []domain.CommentTree{}, nil
+		},
+		count: func(ctx context.Context, filter domain.CommentFilter) (int, error) {
+			return 0, nil
+		},
+	}
+	h := newTestHandler(repo, Config{MaxRootsPerResponse: 10})
+
+	rec := httptest.NewRecorder()
+	h.GetTree(rec, httptest.NewRequest(http.MethodGet, "/comments?page_size=50", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var response CommentsListResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if requested != 10 || response.PageSize != 10 {
+		t.Errorf("requested page size %d, reported %d, want 10", requested, response.PageSize)
+	}
+}
+
+func TestToCommentTreeResponseMatched(t *testing.T) {
+	tree := domain.CommentTree{
+		Comment: domain.Comment{ID: 1},
+		Children: []domain.CommentTree{
+			{Comment: domain.Comment{ID: 2}, Matched: true},
+		},
+	}
+
+	response := toCommentTreeResponse(tree, responseFormat{loc: time.UTC})
+
+	if response.Matched || !response.Children[0].Matched {
+		t.Errorf("matched root = %v, reply = %v, want false, true", response.Matched, response.Children[0].Matched)
+	}
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	// Вне поиска флаг не выводится, поэтому у несовпавших узлов поля нет
+	if strings.Count(string(body), `"matched":true`) != 1 || strings.Contains(string(body), `"matched":false`) {
+		t.Errorf("body = %s, want matched only on the reply", body)
+	}
+}
+
+func TestCreateWithPrevious(t *testing.T) {
+	previous := &domain.Comment{ID: 6, Content: "earlier", CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name         string
+		query        string
+		previous     *domain.Comment
+		previousErr  error
+		wantStatus   int
+		wantPrevious string // "" - поля previous нет в ответе
+	}{
+		{name: "previous", query: "?with_previous=true", previous: previous, wantStatus: http.StatusCreated, wantPrevious: `{"id":6`},
+		{name: "first comment", query: "?with_previous=true", wantStatus: http.StatusCreated, wantPrevious: "null"},
+		{name: "lookup fails", query: "?with_previous=true", previousErr: errors.New("boom"), wantStatus: http.StatusCreated},
+		{name: "without flag", query: "", wantStatus: http.StatusCreated},
+		{name: "with subtree", query: "?with_previous=true&return=subtree", wantStatus: http.StatusBadRequest},
+		{name: "with context", query: "?with_previous=true&include_context=true", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &stubRepository{
+				create: func(ctx context.Context, comment *domain.Comment) error {
+					comment.ID = 7
+					return nil
+				},
+				getPrevious: func(ctx context.Context, id int64) (*domain.Comment, error) {
+					if id != 7 {
+						t.Errorf("GetPrevious(%d), want the created comment 7", id)
+					}
+					return tt.previous, tt.previousErr
+				},
+			}
+			h := newTestHandler(repo, Config{})
+
+			req := httptest.NewRequest(http.MethodPost, "/comments"+tt.query, strings.NewReader(`{"content": "hello"}`))
+			rec := httptest.NewRecorder()
+			h.Create(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var got map[string]json.RawMessage
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+			}
+			if string(got["id"]) != "7" {
+				t.Errorf("id = %s, want 7", got["id"])
+			}
+			raw, ok := got["previous"]
+			switch {
+			case tt.wantPrevious == "" && ok:
+				t.Errorf("previous = %s, want no previous field", raw)
+			case tt.wantPrevious != "" && !strings.HasPrefix(string(raw), tt.wantPrevious):
+				t.Errorf("previous = %s, want prefix %s", raw, tt.wantPrevious)
+			}
+		})
+	}
+}
+
+func TestGetTimelineHasChildren(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeline    []domain.TimelineComment
+		hasChildren map[int64]bool
+		err         error
+		wantStatus  int
+		want        map[int64]bool
+	}{
+		{
+			name: "flags",
+			timeline: []domain.TimelineComment{
+				{Comment: domain.Comment{ID: 1}},
+				{Comment: domain.Comment{ID: 2}, Depth: 1},
+				{Comment: domain.Comment{ID: 3}},
+			},
+			hasChildren: map[int64]bool{1: true},
+			wantStatus:  http.StatusOK,
+			want:        map[int64]bool{1: true, 2: false, 3: false},
+		},
+		{name: "empty page", timeline: []domain.TimelineComment{}, wantStatus: http.StatusOK, want: map[int64]bool{}},
+		{
+			name:       "lookup fails",
+			timeline:   []domain.TimelineComment{{Comment: domain.Comment{ID: 1}}},
+			err:        errors.New("boom"),
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &stubRepository{
+				getTimeline: func(ctx context.Context, filter domain.CommentFilter) ([]domain.TimelineComment, error) {
+					return tt.timeline, nil
+				},
+				count: func(ctx context.Context, filter domain.CommentFilter) (int, error) {
+					return len(tt.timeline), nil
+				},
+				hasChildren: func(ctx context.Context, ids []int64) (map[int64]bool, error) {
+					if len(ids) != len(tt.timeline) {
+						t.Errorf("HasChildren(%v), want one id per timeline comment", ids)
+					}
+					return tt.hasChildren, tt.err
+				},
+			}
+			h := newTestHandler(repo, Config{})
+
+			rec := httptest.NewRecorder()
+			h.GetTree(rec, httptest.NewRequest(http.MethodGet, "/comments?view=timeline", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response TimelineResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("body is not JSON: %v", err)
+			}
+			got := make(map[int64]bool, len(response.Comments))
+			for _, comment := range response.Comments {
+				got[comment.ID.value] = comment.HasChildren
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("has_children = %v, want %v", got, tt.want)
+			}
+			for id, want := range tt.want {
+				if got[id] != want {
+					t.Errorf("comment %d has_children = %v, want %v", id, got[id], want)
+				}
+			}
+		})
+	}
+}
+
+func TestAccept(t *testing.T) {
+	tests := []struct {
+		name       string
+		id         string
+		err        error
+		wantStatus int
+	}{
+		{name: "accepted", id: "7", wantStatus: http.StatusOK},
+		{name: "invalid id", id: "abc", wantStatus: http.StatusBadRequest},
+		{name: "root", id: "7", err: domain.ErrCannotAcceptRoot, wantStatus: http.StatusBadRequest},
+		{name: "not found", id: "7", err: domain.ErrCommentNotFound, wantStatus: http.StatusNotFound},
+		{name: "deleted", id: "7", err: domain.ErrCommentDeleted, wantStatus: http.StatusGone},
+		{name: "unavailable", id: "7", err: domain.ErrServiceUnavailable, wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parentID := int64(1)
+			repo := &stubRepository{
+				accept: func(ctx context.Context, id int64) (*domain.Comment, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &domain.Comment{ID: id, ParentID: &parentID, Accepted: true}, nil
+				},
+			}
+			h := newTestHandler(repo, Config{})
+
+			req := httptest.NewRequest(http.MethodPost, "/comments/"+tt.id+"/accept", nil)
+			req.SetPathValue("id", tt.id)
+			rec := httptest.NewRecorder()
+			h.Accept(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got CommentResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+			}
+			if got.ID.value != 7 || !got.Accepted {
+				t.Errorf("response = %+v, want accepted comment 7", got)
+			}
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name       string
+		id         string
+		query      string
+		err        error
+		wantStatus int
+		wantCalled string
+	}{
+		{name: "cascade by default", id: "7", wantStatus: http.StatusNoContent, wantCalled: domain.DeleteCascade},
+		{name: "cascade", id: "7", query: "?strategy=cascade", wantStatus: http.StatusNoContent, wantCalled: domain.DeleteCascade},
+		{name: "reparent", id: "7", query: "?strategy=reparent", wantStatus: http.StatusNoContent, wantCalled: domain.DeleteReparent},
+		{name: "unknown strategy", id: "7", query: "?strategy=orphan", wantStatus: http.StatusBadRequest},
+		{name: "invalid id", id: "abc", wantStatus: http.StatusBadRequest},
+		{name: "not found", id: "7", err: domain.ErrCommentNotFound, wantStatus: http.StatusNotFound},
+		{name: "already deleted", id: "7", query: "?strategy=reparent", err: domain.ErrCommentDeleted, wantStatus: http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called string
+			repo := &stubRepository{
+				getByID: func(ctx context.Context, id int64) (*domain.Comment, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &domain.Comment{ID: id}, nil
+				},
+				delete: func(ctx context.Context, id int64) error {
+					called = domain.DeleteCascade
+					return nil
+				},
+				deleteReparent: func(ctx context.Context, id int64) error {
+					called = domain.DeleteReparent
+					return nil
+				},
+			}
+			h := newTestHandler(repo, Config{})
+
+			req := httptest.NewRequest(http.MethodDelete, "/comments/"+tt.id+tt.query, nil)
+			req.SetPathValue("id", tt.id)
+			rec := httptest.NewRecorder()
+			h.Delete(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if called != tt.wantCalled {
+				t.Errorf("deleted with %q, want %q", called, tt.wantCalled)
+			}
+		})
+	}
+}
+
+func TestSiblingPositions(t *testing.T) {
+	reply := func(id int64, content string, children ...domain.CommentTree) domain.CommentTree {
+		return domain.CommentTree{Comment: domain.Comment{ID: id, Content: content}, Children: children}
+	}
+	// Ответ 3 короче min_length=3: при reparent его ответы 6 и 7 встают на его место среди 2 и 4,
+	// при drop ветка 3 пропадает целиком
+	roots := []domain.CommentTree{
+		reply(1, "first root",
+			reply(2, "reply two"),
+			reply(3, "no", reply(6, "nested six"), reply(7, "nested seven")),
+			reply(4, "reply four", reply(8, "nested eight")),
+		),
+		reply(5, "second root"),
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantLevels map[int64][]int64
+	}{
+		{name: "full tree", query: "", wantLevels: map[int64][]int64{0: {1, 5}, 1: {2, 3, 4}, 3: {6, 7}, 4: {8}}},
+		{name: "short reply reparented", query: "?min_length=3", wantLevels: map[int64][]int64{0: {1, 5}, 1: {2, 6, 7, 4}, 4: {8}}},
+		{name: "short reply dropped", query: "?min_length=3&min_length_strategy=drop", wantLevels: map[int64][]int64{0: {1, 5}, 1: {2, 4}, 4: {8}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &stubRepository{
+				getTree: func(ctx context.Context, parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error) {
+					return roots, nil
+				},
+				count: func(ctx context.Context, filter domain.CommentFilter) (int, error) {
+					return len(roots), nil
+				},
+			}
+			h := newTestHandler(repo, Config{})
+
+			rec := httptest.NewRecorder()
+			h.GetTree(rec, httptest.NewRequest(http.MethodGet, "/comments"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var response CommentsListResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("body is not JSON: %v", err)
+			}
+
+			// Каждый список соседей проверяется отдельно: позиции с нуля подряд, счетчик равен длине списка
+			levels := make(map[int64][]int64)
+			var walk func(parent int64, trees []CommentTreeResponse)
+			walk = func(parent int64, trees []CommentTreeResponse) {
+				for i, tree := range trees {
+					if tree.SiblingIndex != i || tree.SiblingCount != len(trees) {
+						t.Errorf("comment %d: sibling %d of %d, want %d of %d", tree.Comment.ID.value, tree.SiblingIndex, tree.SiblingCount, i, len(trees))
+					}
+					levels[parent] = append(levels[parent], tree.Comment.ID.value)
+					walk(tree.Comment.ID.value, tree.Children)
+				}
+			}
+			walk(0, response.Comments)
+
+			if !reflect.DeepEqual(levels, tt.wantLevels) {
+				t.Errorf("sibling lists = %v, want %v", levels, tt.wantLevels)
+			}
+		})
+	}
+}
+
+func TestCreateValidateOnly(t *testing.T) {
+	tests := []struct {
+		name           string
+		target         string
+		header         bool
+		body           string
+		wantStatus     int
+		wantValid      bool
+		wantNormalized string
+		wantErrors     int
+	}{
+		{name: "valid", target: "/comments?validate_only=true", body: `{"content":"  hello  "}`, wantStatus: http.StatusOK, wantValid: true, wantNormalized: "hello"},
+		{name: "valid by header", target: "/comments", header: true, body: `{"content":"hello"}`, wantStatus: http.StatusOK, wantValid: true, wantNormalized: "hello"},
+		{name: "empty content", target: "/comments?validate_only=true", body: `{"content":"   "}`, wantStatus: http.StatusOK, wantErrors: 1},
+		{name: "too long", target: "/comments?validate_only=true", body: `{"content":"` + strings.Repeat("x", 21) + `"}`, wantStatus: http.StatusOK, wantErrors: 1},
+		{name: "several errors", target: "/comments?validate_only=true", body: `{"content":"","client_ref":"` + strings.Repeat("r", 200) + `"}`, wantStatus: http.StatusOK, wantErrors: 2},
+		{name: "missing parent", target: "/comments?validate_only=true", body: `{"content":"hello","parent_id":404}`, wantStatus: http.StatusOK, wantErrors: 1},
+		{name: "malformed body", target: "/comments?validate_only=true", body: `{"content":`, wantStatus: http.StatusBadRequest},
+		{name: "invalid tz", target: "/comments?validate_only=true&tz=Nowhere", body: `{"content":"hello"}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created := false
+			repo := &stubRepository{
+				getByID: func(ctx context.Context, id int64) (*domain.Comment, error) {
+					return nil, domain.ErrCommentNotFound
+				},
+				create: func(ctx context.Context, comment *domain.Comment) error {
+					created = true
+					comment.ID = 1
+					return nil
+				},
+			}
+			h := newTestHandlerWithUseCase(repo, Config{}, usecase.Config{
+				ContentProcessors: []usecase.ContentProcessor{usecase.TrimSpace(), usecase.MaxLength(20)},
+			})
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			if tt.header {
+				req.Header.Set("X-Validate-Only", "true")
+			}
+			rec := httptest.NewRecorder()
+			h.Create(rec, req)
+
+			if created {
+				t.Error("validate_only created a comment")
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got ValidateCommentResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+			}
+			if got.Valid != tt.wantValid || got.NormalizedContent != tt.wantNormalized || len(got.Errors) != tt.wantErrors {
+				t.Fatalf("response = %+v, want valid=%v normalized=%q with %d errors", got, tt.wantValid, tt.wantNormalized, tt.wantErrors)
+			}
+			if tt.wantValid {
+				return
+			}
+
+			// Те же данные без validate_only должны отклоняться с тем же текстом ошибки
+			rec = httptest.NewRecorder()
+			h.Create(rec, httptest.NewRequest(http.MethodPost, "/comments", strings.NewReader(tt.body)))
+			if created {
+				t.Fatal("create accepted data that validate_only rejected")
+			}
+			message := strings.TrimSpace(rec.Body.String())
+			if rec.Header().Get("Content-Type") == "application/json" {
+				var contentErr ContentErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &contentErr); err != nil {
+					t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+				}
+				message = contentErr.Message
+			}
+			if want := strings.Join(got.Errors, "; "); message != want {
+				t.Errorf("create error %q, validate_only errors %q", message, want)
+			}
+		})
+	}
+}
+
+func TestGetTreeCountFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		countErr   error
+		treeErr    error
+		wantStatus int
+		wantTotal  int
+	}{
+		{name: "count succeeds", wantStatus: http.StatusOK, wantTotal: 2},
+		{name: "count fails", countErr: errors.New("count timed out"), wantStatus: http.StatusOK, wantTotal: -1},
+		{name: "tree fails", treeErr: errors.New("db down"), wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &stubRepository{
+				getTree: func(ctx context.Context, parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error) {
+					if tt.treeErr != nil {
+						return nil, tt.treeErr
+					}
+					return []domain.CommentTree{{Comment: domain.Comment{ID: 1}}, {Comment: domain.Comment{ID: 2}}}, nil
+				},
+				count: func(ctx context.Context, filter domain.CommentFilter) (int, error) {
+					return 2, tt.countErr
+				},
+			}
+			h := newTestHandler(repo, Config{})
+
+			rec := httptest.NewRecorder()
+			h.GetTree(rec, httptest.NewRequest(http.MethodGet, "/comments", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response CommentsListResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("body is not JSON: %v", err)
+			}
+			if len(response.Comments) != 2 || response.Total != tt.wantTotal {
+				t.Errorf("got %d comments with total %d, want 2 with total %d", len(response.Comments), response.Total, tt.wantTotal)
+			}
+			if _, ok := rec.Header()["X-Total-Count"]; ok != (tt.wantTotal >= 0) {
+				t.Errorf("X-Total-Count present = %v, want %v", ok, tt.wantTotal >= 0)
+			}
+		})
+	}
+}
+
+func TestGetRecentLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantLimit  int
+	}{
+		{name: "default", wantStatus: http.StatusOK, wantLimit: defaultRecentLimit},
+		{name: "explicit", query: "?limit=5", wantStatus: http.StatusOK, wantLimit: 5},
+		{name: "at cap", query: "?limit=50", wantStatus: http.StatusOK, wantLimit: 50},
+		{name: "above cap", query: "?limit=500", wantStatus: http.StatusOK, wantLimit: 50},
+		{name: "zero", query: "?limit=0", wantStatus: http.StatusBadRequest},
+		{name: "not a number", query: "?limit=many", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requested int
+			one := int64(1)
+			repo := &stubRepository{
+				getRecent: func(ctx context.Context, limit int) ([]domain.RecentComment, error) {
+					requested = limit
+					return []domain.RecentComment{
+						{Comment: domain.Comment{ID: 3, ParentID: &one}, RootID: 1},
+						{Comment: domain.Comment{ID: 2}, RootID: 2},
+					}, nil
+				},
+			}
+			h := newTestHandler(repo, Config{MaxRecentLimit: 50})
+
+			rec := httptest.NewRecorder()
+			h.GetRecent(rec, httptest.NewRequest(http.MethodGet, "/comments/recent"+tt.query, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if requested != tt.wantLimit {
+				t.Errorf("repository limit = %d, want %d", requested, tt.wantLimit)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response RecentCommentsResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("body is not JSON: %v", err)
+			}
+			if len(response.Comments) != 2 || response.Comments[0].ID.value != 3 || response.Comments[0].RootID.value != 1 {
+				t.Errorf("response = %+v, want comments 3 (root 1) and 2 in repository order", response.Comments)
+			}
+		})
+	}
+}
+
+func TestCreateIncludeContext(t *testing.T) {
+	one := int64(1)
+	ancestors := []domain.Comment{{ID: 1, Content: "root"}, {ID: 2, ParentID: &one, Content: "reply"}}
+
+	tests := []struct {
+		name          string
+		body          string
+		ancestors     []domain.Comment
+		ancestorsErr  error
+		wantDepth     int
+		wantRoot      int64
+		wantAncestors []int64
+		wantContext   bool
+	}{
+		{name: "nested reply", body: `{"content":"nested","parent_id":2}`, ancestors: ancestors, wantDepth: 2, wantRoot: 1, wantAncestors: []int64{1, 2}, wantContext: true},
+		{name: "root comment", body: `{"content":"new root"}`, ancestors: []domain.Comment{}, wantDepth: 0, wantRoot: 7, wantAncestors: []int64{}, wantContext: true},
+		{name: "ancestors lookup fails", body: `{"content":"nested","parent_id":2}`, ancestorsErr: errors.New("boom")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &stubRepository{
+				getByID: func(ctx context.Context, id int64) (*domain.Comment, error) {
+					return &domain.Comment{ID: id, ParentID: &one}, nil
+				},
+				create: func(ctx context.Context, comment *domain.Comment) error {
+					comment.ID = 7
+					return nil
+				},
+				getAncestors: func(ctx context.Context, id int64) ([]domain.Comment, error) {
+					if id != 7 {
+						t.Errorf("GetAncestors(%d), want the created comment 7", id)
+					}
+					return tt.ancestors, tt.ancestorsErr
+				},
+			}
+			h := newTestHandler(repo, Config{})
+
+			rec := httptest.NewRecorder()
+			h.Create(rec, httptest.NewRequest(http.MethodPost, "/comments?include_context=true", strings.NewReader(tt.body)))
+
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+			}
+			var raw map[string]json.RawMessage
+			if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+				t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+			}
+			if _, ok := raw["ancestors"]; ok != tt.wantContext {
+				t.Fatalf("context present = %v, want %v: %s", ok, tt.wantContext, rec.Body)
+			}
+			if !tt.wantContext {
+				return
+			}
+
+			var got CreatedCommentContextResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+			}
+			ids := make([]int64, 0, len(got.Ancestors))
+			for _, ancestor := range got.Ancestors {
+				ids = append(ids, ancestor.ID.value)
+			}
+			if got.ID.value != 7 || got.Depth != tt.wantDepth || got.RootID.value != tt.wantRoot || !reflect.DeepEqual(ids, tt.wantAncestors) {
+				t.Errorf("response id=%d depth=%d root=%d ancestors=%v, want id=7 depth=%d root=%d ancestors=%v",
+					got.ID.value, got.Depth, got.RootID.value, ids, tt.wantDepth, tt.wantRoot, tt.wantAncestors)
+			}
+		})
+	}
+}
+
+func TestToCommentResponseEdited(t *testing.T) {
+	created := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		updated      time.Time
+		wantEdited   bool
+		wantEditedAt string
+	}{
+		{name: "never edited", updated: created},
+		{name: "timestamps differ by microseconds", updated: created.Add(3 * time.Microsecond)},
+		{name: "just below tolerance", updated: created.Add(editTolerance - time.Nanosecond)},
+		{name: "at tolerance", updated: created.Add(editTolerance), wantEdited: true, wantEditedAt: "2026-03-01T10:00:01Z"},
+		{name: "edited later", updated: created.Add(2 * time.Hour), wantEdited: true, wantEditedAt: "2026-03-01T12:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comment := &domain.Comment{ID: 1, CreatedAt: created, UpdatedAt: tt.updated}
+			got := toCommentResponse(comment, responseFormat{loc: time.UTC})
+
+			if got.IsEdited != tt.wantEdited {
+				t.Errorf("is_edited = %v, want %v", got.IsEdited, tt.wantEdited)
+			}
+			body, err := json.Marshal(got)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			var raw map[string]json.RawMessage
+			if err := json.Unmarshal(body, &raw); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			editedAt, ok := raw["edited_at"]
+			switch {
+			case tt.wantEditedAt == "" && ok:
+				t.Errorf("edited_at = %s, want the field omitted", editedAt)
+			case tt.wantEditedAt != "" && string(editedAt) != `"`+tt.wantEditedAt+`"`:
+				t.Errorf("edited_at = %s, want %q", editedAt, tt.wantEditedAt)
+			}
+		})
+	}
+}
+
+func TestCreateEmptyBody(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "no body", body: "", wantStatus: http.StatusBadRequest, wantBody: "request body is required"},
+		{name: "whitespace body", body: " \n\t ", wantStatus: http.StatusBadRequest, wantBody: "request body is required"},
+		// Пустой текст отклоняется обычным ответом 400, а не 422 с подсказкой
+		{name: "null body", body: "null", wantStatus: http.StatusBadRequest, wantBody: domain.ErrEmptyContent.Error()},
+		{name: "whitespace content", body: `{"content": " \n "}`, wantStatus: http.StatusBadRequest, wantBody: domain.ErrEmptyContent.Error()},
+		{name: "empty content", body: `{"content": ""}`, wantStatus: http.StatusBadRequest, wantBody: domain.ErrEmptyContent.Error()},
+		{name: "malformed body", body: `{"content":`, wantStatus: http.StatusBadRequest, wantBody: "invalid request body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlerWithUseCase(&stubRepository{}, Config{}, usecase.Config{
+				ContentProcessors: []usecase.ContentProcessor{usecase.TrimSpace()},
+			})
+
+			rec := httptest.NewRecorder()
+			h.Create(rec, httptest.NewRequest(http.MethodPost, "/comments", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body, tt.wantBody)
+			}
+			if contentType := rec.Header().Get("Content-Type"); strings.HasPrefix(contentType, "application/json") {
+				t.Errorf("Content-Type = %q, want a plain-text error", contentType)
+			}
+		})
+	}
+}
+
+func TestGetTreeSubtreePage(t *testing.T) {
+	five := int64(5)
+	var treeFilter, countFilter domain.CommentFilter
+	var treeParent *int64
+	repo := &stubRepository{
+		getTree: func(ctx context.Context, parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error) {
+			treeParent, treeFilter = parentID, filter
+			return []domain.CommentTree{{Comment: domain.Comment{ID: 5}, Children: []domain.CommentTree{
+				{Comment: domain.Comment{ID: 8, ParentID: &five}},
+				{Comment: domain.Comment{ID: 9, ParentID: &five}},
+			}}}, nil
+		},
+		count: func(ctx context.Context, filter domain.CommentFilter) (int, error) {
+			countFilter = filter
+			return 7, nil
+		},
+	}
+	h := newTestHandler(repo, Config{})
+
+	rec := httptest.NewRecorder()
+	h.GetTree(rec, httptest.NewRequest(http.MethodGet, "/comments?parent=5&page=2&page_size=2", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if treeParent == nil || *treeParent != 5 || treeFilter.Page != 2 || treeFilter.PageSize != 2 {
+		t.Errorf("GetTree(parent %v, page %d, size %d), want parent 5, page 2, size 2", treeParent, treeFilter.Page, treeFilter.PageSize)
+	}
+	if countFilter.ParentID == nil || *countFilter.ParentID != 5 {
+		t.Errorf("Count parent = %v, want 5 to count its direct replies", countFilter.ParentID)
+	}
+	var response CommentsListResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if response.Total != 7 || response.Page != 2 || len(response.Comments) != 1 || len(response.Comments[0].Children) != 2 {
+		t.Errorf("response = %+v, want parent 5 with 2 of 7 direct replies on page 2", response)
+	}
+	if link := rec.Header().Get("Link"); !strings.Contains(link, `page=4&page_size=2&parent=5>; rel="last"`) {
+		t.Errorf("Link = %s, want last page 4 of the direct replies", link)
+	}
+}
+
+func TestCreateReturnSubtree(t *testing.T) {
+	one, two := int64(1), int64(2)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantThread bool
+	}{
+		{name: "subtree", query: "?return=subtree", wantStatus: http.StatusCreated, wantThread: true},
+		{name: "comment only", query: "", wantStatus: http.StatusCreated},
+		{name: "unknown mode", query: "?return=thread", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &stubRepository{
+				getByID: func(ctx context.Context, id int64) (*domain.Comment, error) {
+					return &domain.Comment{ID: id, ParentID: &one}, nil
+				},
+				create: func(ctx context.Context, comment *domain.Comment) error {
+					if tt.wantThread {
+						t.Error("Create called, want CreateWithThread")
+					}
+					comment.ID = 7
+					return nil
+				},
+				createWithThread: func(ctx context.Context, comment *domain.Comment) (*domain.CommentTree, error) {
+					comment.ID = 7
+					// Ветка корня 1 уже содержит новый ответ 7 под комментарием 2
+					return &domain.CommentTree{Comment: domain.Comment{ID: 1}, Children: []domain.CommentTree{
+						{Comment: domain.Comment{ID: 2, ParentID: &one}, Children: []domain.CommentTree{
+							{Comment: domain.Comment{ID: 7, ParentID: &two, Content: comment.Content}},
+						}},
+					}}, nil
+				},
+			}
+			h := newTestHandler(repo, Config{})
+
+			rec := httptest.NewRecorder()
+			h.Create(rec, httptest.NewRequest(http.MethodPost, "/comments"+tt.query, strings.NewReader(`{"content":"nested","parent_id":2}`)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+			if !tt.wantThread {
+				var got CommentResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.ID.value != 7 {
+					t.Errorf("body = %s, want the created comment 7", rec.Body)
+				}
+				return
+			}
+
+			var got CommentTreeResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+			}
+			if got.Comment.ID.value != 1 || got.MaxDepth == nil || *got.MaxDepth != 2 {
+				t.Fatalf("response root %d with max_depth %v, want root 1 with max_depth 2", got.Comment.ID.value, got.MaxDepth)
+			}
+			created := got.Children[0].Children[0]
+			if created.Comment.ID.value != 7 || created.Comment.Content != "nested" {
+				t.Errorf("nested reply = %+v, want the created comment 7", created.Comment)
+			}
+		})
+	}
+}
+
+func TestGetTreeMaxDepth(t *testing.T) {
+	node := func(id int64, children ...domain.CommentTree) domain.CommentTree {
+		return domain.CommentTree{Comment: domain.Comment{ID: id, Content: "text"}, Children: children}
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  map[int64]int
+	}{
+		{name: "full trees", want: map[int64]int{1: 0, 2: 1, 4: 3}},
+		// max_render_depth выносит глубокие ветки в продолжения; глубина корня считается по оставшейся части
+		{name: "with continuations", query: "?max_render_depth=1", want: map[int64]int{1: 0, 2: 1, 4: 1, 7: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &stubRepository{
+				getTree: func(ctx context.Context, parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error) {
+					return []domain.CommentTree{
+						node(1),
+						node(2, node(3)),
+						node(4, node(5), node(6, node(7, node(8)))),
+					}, nil
+				},
+				count: func(ctx context.Context, filter domain.CommentFilter) (int, error) {
+					return 3, nil
+				},
+			}
+			h := newTestHandler(repo, Config{})
+
+			rec := httptest.NewRecorder()
+			h.GetTree(rec, httptest.NewRequest(http.MethodGet, "/comments"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var response CommentsListResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("body is not JSON: %v", err)
+			}
+
+			got := make(map[int64]int)
+			for _, root := range append(response.Comments, response.Continuations...) {
+				if root.MaxDepth == nil {
+					t.Errorf("root %d has no max_depth", root.Comment.ID.value)
+					continue
+				}
+				got[root.Comment.ID.value] = *root.MaxDepth
+				for _, child := range root.Children {
+					if child.MaxDepth != nil {
+						t.Errorf("reply %d has max_depth, want it only on roots", child.Comment.ID.value)
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("max_depth by root = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollapseChildren(t *testing.T) {
+	tests := []struct {
+		name          string
+		id            string
+		body          string
+		err           error
+		wantStatus    int
+		wantCollapsed bool
+	}{
+		{name: "no body collapses", id: "7", wantStatus: http.StatusOK, wantCollapsed: true},
+		{name: "empty object collapses", id: "7", body: `{}`, wantStatus: http.StatusOK, wantCollapsed: true},
+		{name: "collapse", id: "7", body: `{"collapsed": true}`, wantStatus: http.StatusOK, wantCollapsed: true},
+		{name: "expand", id: "7", body: `{"collapsed": false}`, wantStatus: http.StatusOK},
+		{name: "invalid body", id: "7", body: `{"collapsed": "yes"}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid id", id: "abc", wantStatus: http.StatusBadRequest},
+		{name: "not found", id: "7", err: domain.ErrCommentNotFound, wantStatus: http.StatusNotFound},
+		{name: "deleted", id: "7", err: domain.ErrCommentDeleted, wantStatus: http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &stubRepository{
+				setCollapsed: func(ctx context.Context, id int64, collapsed bool) (*domain.Comment, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					if collapsed != tt.wantCollapsed {
+						t.Errorf("SetChildrenCollapsed(%v), want %v", collapsed, tt.wantCollapsed)
+					}
+					return &domain.Comment{ID: id, ChildrenCollapsed: collapsed}, nil
+				},
+			}
+			h := newTestHandler(repo, Config{})
+
+			req := httptest.NewRequest(http.MethodPost, "/comments/"+tt.id+"/collapse-children", strings.NewReader(tt.body))
+			req.SetPathValue("id", tt.id)
+			rec := httptest.NewRecorder()
+			h.CollapseChildren(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got CommentResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+			}
+			if got.ID.value != 7 || got.ChildrenCollapsed != tt.wantCollapsed {
+				t.Errorf("response = %+v, want comment 7 with children_collapsed %v", got, tt.wantCollapsed)
+			}
+		})
+	}
+}
+
+func TestChildrenCollapsedKeepsTree(t *testing.T) {
+	one := int64(1)
+	repo := &stubRepository{
+		getTree: func(ctx context.Context, parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error) {
+			return []domain.CommentTree{{
+				Comment: domain.Comment{ID: 1, Content: "faq", ChildrenCollapsed: true},
+				Children: []domain.CommentTree{
+					{Comment: domain.Comment{ID: 2, ParentID: &one, Content: "long answer"}},
+					{Comment: domain.Comment{ID: 3, ParentID: &one, Content: "another answer"}},
+				},
+			}}, nil
+		},
+		count: func(ctx context.Context, filter domain.CommentFilter) (int, error) {
+			return 1, nil
+		},
+	}
+	h := newTestHandler(repo, Config{})
+
+	rec := httptest.NewRecorder()
+	h.GetTree(rec, httptest.NewRequest(http.MethodGet, "/comments", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var response CommentsListResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+
+	root := response.Comments[0]
+	if !root.Comment.ChildrenCollapsed {
+		t.Error("children_collapsed lost in the tree response")
+	}
+	if len(root.Children) != 2 || root.Collapsed {
+		t.Errorf("root has %d children (collapsed %v), want both replies returned", len(root.Children), root.Collapsed)
+	}
+	for _, child := range root.Children {
+		if child.Comment.ChildrenCollapsed || child.Collapsed {
+			t.Errorf("reply %d inherited the flag", child.Comment.ID.value)
+		}
+	}
+}
+
+func TestCreateUnderParent(t *testing.T) {
+	tests := []struct {
+		name       string
+		parentErr  error
+		wantStatus int
+	}{
+		{name: "live parent", wantStatus: http.StatusCreated},
+		{name: "deleted parent", parentErr: domain.ErrCommentDeleted, wantStatus: http.StatusConflict},
+		{name: "missing parent", parentErr: domain.ErrCommentNotFound, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created := false
+			repo := &stubRepository{
+				getByID: func(ctx context.Context, id int64) (*domain.Comment, error) {
+					if tt.parentErr != nil {
+						return nil, tt.parentErr
+					}
+					return &domain.Comment{ID: id, Content: "parent"}, nil
+				},
+				create: func(ctx context.Context, comment *domain.Comment) error {
+					created = true
+					comment.ID = 2
+					return nil
+				},
+			}
+			h := newTestHandler(repo, Config{})
+
+			req := httptest.NewRequest(http.MethodPost, "/comments", strings.NewReader(`{"parent_id": 1, "content": "reply"}`))
+			rec := httptest.NewRecorder()
+			h.Create(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if created != (tt.wantStatus == http.StatusCreated) {
+				t.Errorf("reply stored = %v", created)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	created := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		id          string
+		body        string
+		err         error
+		wantStatus  int
+		wantContent string
+	}{
+		{name: "edited", id: "7", body: `{"content": "  fixed typo  "}`, wantStatus: http.StatusOK, wantContent: "fixed typo"},
+		{name: "too long", id: "7", body: `{"content": "this edit is far too long"}`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "empty", id: "7", body: `{"content": "   "}`, wantStatus: http.StatusBadRequest},
+		{name: "not found", id: "7", body: `{"content": "fixed typo"}`, err: domain.ErrCommentNotFound, wantStatus: http.StatusNotFound},
+		{name: "deleted", id: "7", body: `{"content": "fixed typo"}`, err: domain.ErrCommentDeleted, wantStatus: http.StatusGone},
+		{name: "invalid id", id: "abc", body: `{"content": "fixed typo"}`, wantStatus: http.StatusBadRequest},
+		{name: "no body", id: "7", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated := false
+			repo := &stubRepository{
+				// Репозиторий возвращает сохраненные created_at и новое updated_at
+				update: func(ctx context.Context, comment *domain.Comment) error {
+					if tt.err != nil {
+						return tt.err
+					}
+					updated = true
+					comment.CreatedAt = created
+					comment.UpdatedAt = created.Add(time.Hour)
+					return nil
+				},
+			}
+			h := newTestHandlerWithUseCase(repo, Config{}, usecase.Config{
+				ContentProcessors: []usecase.ContentProcessor{usecase.TrimSpace(), usecase.MaxLength(20)},
+			})
+
+			req := httptest.NewRequest(http.MethodPatch, "/comments/"+tt.id, strings.NewReader(tt.body))
+			req.SetPathValue("id", tt.id)
+			rec := httptest.NewRecorder()
+			h.Update(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if updated != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("comment updated = %v", updated)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got CommentResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+			}
+			if got.Content != tt.wantContent {
+				t.Errorf("content = %q, want %q", got.Content, tt.wantContent)
+			}
+			if !got.IsEdited || got.EditedAt == nil {
+				t.Errorf("is_edited = %v, edited_at = %v, want the edit reported", got.IsEdited, got.EditedAt)
+			}
+			if got.CreatedAt == got.UpdatedAt {
+				t.Errorf("updated_at = %s did not move past created_at", got.UpdatedAt)
+			}
+		})
+	}
+}
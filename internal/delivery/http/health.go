@@ -0,0 +1,33 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HealthResponse DTO для ответа проверки состояния сервиса
+type HealthResponse struct {
+	Status   string `json:"status"`
+	Database string `json:"database"`
+}
+
+// HealthHandler обрабатывает GET /healthz.
+// databaseState возвращает состояние circuit breaker базы данных; при open сервис считается недоступным
+func HealthHandler(databaseState func() string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := HealthResponse{
+			Status:   "ok",
+			Database: databaseState(),
+		}
+
+		status := http.StatusOK
+		if response.Database == "open" {
+			response.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(response)
+	})
+}
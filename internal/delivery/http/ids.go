@@ -0,0 +1,66 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// CommentID ID комментария в JSON. По умолчанию сериализуется числом, а при IDS_AS_STRINGS -
+// строкой, чтобы JavaScript-клиенты не теряли точность на значениях больше 2^53.
+// Способ сериализации хранится в самом значении и задается при преобразовании в DTO
+// (см. responseFormat). При разборе принимаются обе формы независимо от настройки
+type CommentID struct {
+	value    int64
+	asString bool
+}
+
+// newCommentID создает ID для ответа, сериализуемый строкой при asString
+func newCommentID(value int64, asString bool) CommentID {
+	return CommentID{value: value, asString: asString}
+}
+
+// MarshalJSON сериализует ID числом или строкой
+func (id CommentID) MarshalJSON() ([]byte, error) {
+	if id.asString {
+		return []byte(`"` + strconv.FormatInt(id.value, 10) + `"`), nil
+	}
+	return []byte(strconv.FormatInt(id.value, 10)), nil
+}
+
+// UnmarshalJSON разбирает ID из числа или строки с десятичным числом
+func (id *CommentID) UnmarshalJSON(data []byte) error {
+	raw := data
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		raw = []byte(s)
+	}
+
+	value, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid comment id %s", data)
+	}
+	*id = CommentID{value: value}
+	return nil
+}
+
+// fromCommentIDPtr преобразует необязательный ID из DTO в домен
+func fromCommentIDPtr(id *CommentID) *int64 {
+	if id == nil {
+		return nil
+	}
+	converted := id.value
+	return &converted
+}
+
+// fromCommentIDs преобразует список ID из DTO в домен
+func fromCommentIDs(ids []CommentID) []int64 {
+	converted := make([]int64, len(ids))
+	for i, id := range ids {
+		converted[i] = id.value
+	}
+	return converted
+}
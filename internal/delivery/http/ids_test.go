@@ -0,0 +1,147 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// beyondFloat64 первое целое, которое float64 (и число JavaScript) не представляет точно
+const beyondFloat64 = int64(9007199254740993)
+
+func TestCommentIDMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    int64
+		asString bool
+		want     string
+	}{
+		{name: "number", value: 42, want: `42`},
+		{name: "string", value: 42, asString: true, want: `"42"`},
+		{name: "number beyond 2^53", value: beyondFloat64, want: `9007199254740993`},
+		{name: "string beyond 2^53", value: beyondFloat64, asString: true, want: `"9007199254740993"`},
+		{name: "negative string", value: -1, asString: true, want: `"-1"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(newCommentID(tt.value, tt.asString))
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Marshal = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommentIDUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    int64
+		wantErr bool
+	}{
+		{name: "number", data: `42`, want: 42},
+		{name: "string", data: `"42"`, want: 42},
+		{name: "number beyond 2^53", data: `9007199254740993`, want: beyondFloat64},
+		{name: "string beyond 2^53", data: `"9007199254740993"`, want: beyondFloat64},
+		{name: "fraction", data: `4.2`, wantErr: true},
+		{name: "exponent", data: `1e3`, wantErr: true},
+		{name: "empty string", data: `""`, wantErr: true},
+		{name: "padded string", data: `" 42"`, wantErr: true},
+		{name: "word", data: `"abc"`, wantErr: true},
+		{name: "overflow", data: `"9223372036854775808"`, wantErr: true},
+		{name: "bool", data: `true`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var id CommentID
+			err := json.Unmarshal([]byte(tt.data), &id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal(%s) error = %v, wantErr %v", tt.data, err, tt.wantErr)
+			}
+			if !tt.wantErr && id.value != tt.want {
+				t.Errorf("Unmarshal(%s) = %d, want %d", tt.data, id.value, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommentIDNull(t *testing.T) {
+	var req CreateCommentRequest
+	if err := json.Unmarshal([]byte(`{"parent_id": null, "content": "text"}`), &req); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if fromCommentIDPtr(req.ParentID) != nil {
+		t.Errorf("parent_id = %v, want nil", *req.ParentID)
+	}
+}
+
+func TestFromCommentIDs(t *testing.T) {
+	var req ReplyCountsRequest
+	if err := json.Unmarshal([]byte(`{"ids": [1, "2", "9007199254740993"]}`), &req); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	got := fromCommentIDs(req.IDs)
+	want := []int64{1, 2, beyondFloat64}
+	if len(got) != len(want) {
+		t.Fatalf("ids = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ids[%d] = %d, want %d", i, got[i], want[i])
+		}
+	}
+}
+
+// Настройка относится к обработчику, а не к пакету: обработчики с разными настройками не влияют друг на друга
+func TestIDsAsStringsPerHandler(t *testing.T) {
+	parentID := int64(1)
+	repo := &stubRepository{
+		getTree: func(ctx context.Context, parentIDArg *int64, filter domain.CommentFilter) ([]domain.CommentTree, error) {
+			return []domain.CommentTree{{Comment: domain.Comment{ID: beyondFloat64}, Children: []domain.CommentTree{
+				{Comment: domain.Comment{ID: 2, ParentID: &parentID}},
+			}}}, nil
+		},
+		count: func(ctx context.Context, filter domain.CommentFilter) (int, error) {
+			return 1, nil
+		},
+	}
+
+	asStrings := newTestHandler(repo, Config{IDsAsStrings: true})
+	asNumbers := newTestHandler(repo, Config{})
+
+	tests := []struct {
+		name    string
+		handler *CommentHandler
+		want    []string
+	}{
+		{name: "strings", handler: asStrings, want: []string{`"id":"9007199254740993"`, `"parent_id":"1"`}},
+		{name: "numbers", handler: asNumbers, want: []string{`"id":9007199254740993`, `"parent_id":1`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler.GetTree(rec, httptest.NewRequest(http.MethodGet, "/comments", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("body %s does not contain %s", rec.Body, want)
+				}
+			}
+		})
+	}
+}
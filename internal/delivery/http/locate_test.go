@@ -0,0 +1,54 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+func TestLocateSortBy(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantSortBy string
+	}{
+		{name: "default", query: "", wantStatus: http.StatusOK, wantSortBy: "created_at"},
+		{name: "updated_at", query: "?sort_by=updated_at", wantStatus: http.StatusOK, wantSortBy: "updated_at"},
+		{name: "hot", query: "?sort_by=hot", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var located *domain.CommentFilter
+			repo := &stubRepository{
+				locate: func(ctx context.Context, id int64, filter domain.CommentFilter) (*domain.CommentLocation, error) {
+					located = &filter
+					return &domain.CommentLocation{RootID: id, Index: 0}, nil
+				},
+			}
+			h := newTestHandler(repo, Config{})
+
+			req := httptest.NewRequest(http.MethodGet, "/comments/5/locate"+tt.query, nil)
+			req.SetPathValue("id", "5")
+			rec := httptest.NewRecorder()
+			h.Locate(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if located != nil {
+					t.Error("rejected request must not reach the repository")
+				}
+				return
+			}
+			if located == nil || located.SortBy != tt.wantSortBy {
+				t.Errorf("located with %+v, want sort_by %s", located, tt.wantSortBy)
+			}
+		})
+	}
+}
@@ -2,34 +2,99 @@ package http
 
 import (
 	"log/slog"
+	"math/rand"
 	"net/http"
 	"time"
 )
 
-// LoggingMiddleware логирует HTTP запросы
-func LoggingMiddleware(logger *slog.Logger, next http.Handler) http.Handler {
+// LoggingMiddleware пишет структурированный access log.
+// route возвращает шаблон маршрута, которому соответствует запрос. Успешные ответы (статус < 400)
+// логируются с вероятностью sampleRate, ошибки клиента и сервера - всегда
+func LoggingMiddleware(logger *slog.Logger, sampleRate float64, route func(r *http.Request) string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
-		next.ServeHTTP(w, r)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status < http.StatusBadRequest && sampleRate < 1 && rand.Float64() >= sampleRate {
+			return
+		}
 
+		duration := time.Since(start)
 		logger.Info(
 			"http request",
 			"method", r.Method,
 			"path", r.URL.Path,
-			"duration", time.Since(start),
+			"route", route(r),
+			"status", recorder.status,
+			"duration", duration,
+			"latency_bucket", latencyBucket(duration),
+			"request_bytes", r.ContentLength,
+			"response_bytes", recorder.bytes,
+			"user_agent", r.UserAgent(),
+			"referer", r.Referer(),
 		)
 	})
 }
 
-// CORSMiddleware добавляет CORS заголовки
-func CORSMiddleware(next http.Handler) http.Handler {
+// statusRecorder запоминает код ответа и количество записанных байт тела
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+// WriteHeader запоминает код ответа
+func (rec *statusRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Write подсчитывает записанные байты тела
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// latencyBucket относит длительность запроса к одному из интервалов для группировки в логах
+func latencyBucket(d time.Duration) string {
+	switch {
+	case d < 10*time.Millisecond:
+		return "<10ms"
+	case d < 100*time.Millisecond:
+		return "10ms-100ms"
+	case d < time.Second:
+		return "100ms-1s"
+	default:
+		return ">=1s"
+	}
+}
+
+// CORSMiddleware добавляет CORS заголовки.
+// Список разрешенных методов берется из allowedMethods для конкретного пути запроса
+func CORSMiddleware(allowedMethods func(r *http.Request) []string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Expose-Headers", "Link, X-Total-Count, X-Page, X-Page-Size")
 
-		if r.Method == "OPTIONS" {
+		if r.Method == http.MethodOptions {
+			if methods := allowedMethods(r); len(methods) > 0 {
+				w.Header().Set("Access-Control-Allow-Methods", allowHeader(methods))
+				w.Header().Set("Allow", allowHeader(methods))
+			}
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
@@ -0,0 +1,106 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		sampleRate float64
+		status     int
+		wantLogged bool
+	}{
+		{name: "success sampled", sampleRate: 1, status: http.StatusOK, wantLogged: true},
+		{name: "success unsampled", sampleRate: 0, status: http.StatusOK},
+		{name: "redirect unsampled", sampleRate: 0, status: http.StatusNotModified},
+		{name: "client error always logged", sampleRate: 0, status: http.StatusNotFound, wantLogged: true},
+		{name: "server error always logged", sampleRate: 0, status: http.StatusInternalServerError, wantLogged: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&logs, nil))
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(io.Discard, r.Body)
+				w.WriteHeader(tt.status)
+				io.WriteString(w, "hello")
+			})
+			route := func(r *http.Request) string { return "POST /comments/{id}/accept" }
+
+			req := httptest.NewRequest(http.MethodPost, "/comments/7/accept", strings.NewReader(`{"x":1}`))
+			req.Header.Set("User-Agent", "test-agent")
+			req.Header.Set("Referer", "https://example.com/thread/7")
+			rec := httptest.NewRecorder()
+			LoggingMiddleware(logger, tt.sampleRate, route, next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("client got status %d, want %d", rec.Code, tt.status)
+			}
+			if !tt.wantLogged {
+				if logs.Len() != 0 {
+					t.Errorf("unsampled request logged: %s", logs.String())
+				}
+				return
+			}
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+				t.Fatalf("log %q is not one JSON entry: %v", logs.String(), err)
+			}
+			want := map[string]interface{}{
+				"msg":            "http request",
+				"method":         "POST",
+				"path":           "/comments/7/accept",
+				"route":          "POST /comments/{id}/accept",
+				"status":         float64(tt.status),
+				"request_bytes":  float64(len(`{"x":1}`)),
+				"response_bytes": float64(len("hello")),
+				"user_agent":     "test-agent",
+				"referer":        "https://example.com/thread/7",
+			}
+			for key, value := range want {
+				if entry[key] != value {
+					t.Errorf("%s = %v, want %v", key, entry[key], value)
+				}
+			}
+			duration, ok := entry["duration"].(float64)
+			if !ok {
+				t.Fatalf("duration = %v, want nanoseconds", entry["duration"])
+			}
+			if bucket := latencyBucket(time.Duration(duration)); entry["latency_bucket"] != bucket {
+				t.Errorf("latency_bucket = %v, want %q for duration %v", entry["latency_bucket"], bucket, time.Duration(duration))
+			}
+		})
+	}
+}
+
+func TestLatencyBucket(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		want     string
+	}{
+		{duration: 0, want: "<10ms"},
+		{duration: 9 * time.Millisecond, want: "<10ms"},
+		{duration: 10 * time.Millisecond, want: "10ms-100ms"},
+		{duration: 99 * time.Millisecond, want: "10ms-100ms"},
+		{duration: 100 * time.Millisecond, want: "100ms-1s"},
+		{duration: time.Second, want: ">=1s"},
+		{duration: time.Minute, want: ">=1s"},
+	}
+
+	for _, tt := range tests {
+		if got := latencyBucket(tt.duration); got != tt.want {
+			t.Errorf("latencyBucket(%v) = %q, want %q", tt.duration, got, tt.want)
+		}
+	}
+}
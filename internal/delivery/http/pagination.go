@@ -0,0 +1,47 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// setPaginationHeaders дублирует пагинацию ответа в заголовках X-Page, X-Page-Size, X-Total-Count
+// и Link (rel="first", "prev", "next", "last") для прокси и клиентов, которые не читают тело.
+// При неизвестном total (< 0) X-Total-Count и rel="last" не выставляются, а rel="next" выставляется
+// всегда, так как конец списка неизвестен
+func setPaginationHeaders(w http.ResponseWriter, r *http.Request, page, pageSize, total int) {
+	w.Header().Set("X-Page", strconv.Itoa(page))
+	w.Header().Set("X-Page-Size", strconv.Itoa(pageSize))
+
+	lastPage := 0
+	if total >= 0 {
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		lastPage = (total + pageSize - 1) / pageSize
+		if lastPage < 1 {
+			lastPage = 1
+		}
+	}
+
+	links := []string{pageLink(r, 1, "first")}
+	if page > 1 {
+		links = append(links, pageLink(r, page-1, "prev"))
+	}
+	if lastPage == 0 || page < lastPage {
+		links = append(links, pageLink(r, page+1, "next"))
+	}
+	if lastPage > 0 {
+		links = append(links, pageLink(r, lastPage, "last"))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
+// pageLink формирует элемент заголовка Link: URL текущего запроса с замененным параметром page
+func pageLink(r *http.Request, page int, rel string) string {
+	u := *r.URL
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	u.RawQuery = query.Encode()
+	return fmt.Sprintf("<%s>; rel=%q", u.RequestURI(), rel)
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSetPaginationHeaders(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		page      int
+		pageSize  int
+		total     int
+		wantTotal string
+		wantLinks []string
+	}{
+		{
+			name:      "first page",
+			target:    "/comments?page=1&page_size=10",
+			page:      1,
+			pageSize:  10,
+			total:     25,
+			wantTotal: "25",
+			wantLinks: []string{
+				`</comments?page=1&page_size=10>; rel="first"`,
+				`</comments?page=2&page_size=10>; rel="next"`,
+				`</comments?page=3&page_size=10>; rel="last"`,
+			},
+		},
+		{
+			name:      "middle page keeps other parameters",
+			target:    "/comments?page=2&page_size=10&sort_by=hot",
+			page:      2,
+			pageSize:  10,
+			total:     25,
+			wantTotal: "25",
+			wantLinks: []string{
+				`</comments?page=1&page_size=10&sort_by=hot>; rel="first"`,
+				`</comments?page=1&page_size=10&sort_by=hot>; rel="prev"`,
+				`</comments?page=3&page_size=10&sort_by=hot>; rel="next"`,
+				`</comments?page=3&page_size=10&sort_by=hot>; rel="last"`,
+			},
+		},
+		{
+			name:      "last page",
+			target:    "/comments?page=3&page_size=10",
+			page:      3,
+			pageSize:  10,
+			total:     25,
+			wantTotal: "25",
+			wantLinks: []string{
+				`</comments?page=1&page_size=10>; rel="first"`,
+				`</comments?page=2&page_size=10>; rel="prev"`,
+				`</comments?page=3&page_size=10>; rel="last"`,
+			},
+		},
+		{
+			name:      "no comments",
+			target:    "/comments",
+			page:      1,
+			pageSize:  50,
+			total:     0,
+			wantTotal: "0",
+			wantLinks: []string{
+				`</comments?page=1>; rel="first"`,
+				`</comments?page=1>; rel="last"`,
+			},
+		},
+		{
+			name:     "unknown total",
+			target:   "/comments?page=2",
+			page:     2,
+			pageSize: 50,
+			total:    -1,
+			wantLinks: []string{
+				`</comments?page=1>; rel="first"`,
+				`</comments?page=1>; rel="prev"`,
+				`</comments?page=3>; rel="next"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			setPaginationHeaders(rec, httptest.NewRequest(http.MethodGet, tt.target, nil), tt.page, tt.pageSize, tt.total)
+
+			if got := rec.Header().Get("Link"); got != strings.Join(tt.wantLinks, ", ") {
+				t.Errorf("Link = %s\nwant %s", got, strings.Join(tt.wantLinks, ", "))
+			}
+			if got := rec.Header().Get("X-Total-Count"); got != tt.wantTotal {
+				t.Errorf("X-Total-Count = %q, want %q", got, tt.wantTotal)
+			}
+			if _, ok := rec.Header()["X-Total-Count"]; ok != (tt.total >= 0) {
+				t.Errorf("X-Total-Count present = %v, want %v", ok, tt.total >= 0)
+			}
+			if got, want := rec.Header().Get("X-Page"), strconv.Itoa(tt.page); got != want {
+				t.Errorf("X-Page = %q, want %q", got, want)
+			}
+			if got, want := rec.Header().Get("X-Page-Size"), strconv.Itoa(tt.pageSize); got != want {
+				t.Errorf("X-Page-Size = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// Стратегии обработки ответов на слишком короткие комментарии
+const (
+	pruneReparent = "reparent" // ответы поднимаются к ближайшему оставшемуся предку
+	pruneDrop     = "drop"     // короткий комментарий скрывается вместе со всей веткой
+)
+
+// shortFilter описывает параметры скрытия коротких комментариев
+type shortFilter struct {
+	MinLength int
+	Strategy  string
+}
+
+// parseShortFilter разбирает параметры min_length и min_length_strategy.
+// MinLength == 0 означает, что комментарии не скрываются
+func parseShortFilter(r *http.Request) (shortFilter, error) {
+	query := r.URL.Query()
+	filter := shortFilter{Strategy: pruneReparent}
+
+	if value := query.Get("min_length"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return shortFilter{}, &domain.ValidationError{
+				Field:   "min_length",
+				Message: fmt.Sprintf("min_length must be a positive integer, got %q", value),
+			}
+		}
+		filter.MinLength = n
+	}
+
+	switch strategy := query.Get("min_length_strategy"); strategy {
+	case "":
+	case pruneReparent, pruneDrop:
+		filter.Strategy = strategy
+	default:
+		return shortFilter{}, &domain.ValidationError{
+			Field:   "min_length_strategy",
+			Message: fmt.Sprintf("min_length_strategy must be %q or %q, got %q", pruneReparent, pruneDrop, strategy),
+		}
+	}
+
+	return filter, nil
+}
+
+// pruneShort скрывает комментарии любого уровня, текст которых короче MinLength символов.
+// При стратегии pruneReparent ответы скрытого комментария занимают его место среди соседей,
+// при pruneDrop скрывается вся ветка
+func pruneShort(trees []domain.CommentTree, filter shortFilter) []domain.CommentTree {
+	if filter.MinLength == 0 {
+		return trees
+	}
+
+	result := make([]domain.CommentTree, 0, len(trees))
+	for _, tree := range trees {
+		children := pruneShort(tree.Children, filter)
+		if utf8.RuneCountInString(tree.Comment.Content) >= filter.MinLength {
+			tree.Children = children
+			result = append(result, tree)
+			continue
+		}
+		if filter.Strategy == pruneReparent {
+			result = append(result, children...)
+		}
+	}
+	return result
+}
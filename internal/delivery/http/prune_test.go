@@ -0,0 +1,85 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+func TestParseShortFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    shortFilter
+		wantErr bool
+	}{
+		{name: "absent", query: "", want: shortFilter{Strategy: pruneReparent}},
+		{name: "min length", query: "?min_length=3", want: shortFilter{MinLength: 3, Strategy: pruneReparent}},
+		{name: "drop", query: "?min_length=3&min_length_strategy=drop", want: shortFilter{MinLength: 3, Strategy: pruneDrop}},
+		{name: "zero", query: "?min_length=0", wantErr: true},
+		{name: "not a number", query: "?min_length=few", wantErr: true},
+		{name: "unknown strategy", query: "?min_length=3&min_length_strategy=hide", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseShortFilter(httptest.NewRequest(http.MethodGet, "/comments"+tt.query, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("filter = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// commentTree строит дерево domain.CommentTree с текстом content
+func commentTree(id int64, content string, children ...domain.CommentTree) domain.CommentTree {
+	return domain.CommentTree{Comment: domain.Comment{ID: id, Content: content}, Children: children}
+}
+
+// prunedIDs возвращает идентификаторы деревьев в порядке обхода, вложенные ответы - в скобках
+func prunedIDs(trees []domain.CommentTree) []any {
+	ids := []any{}
+	for _, tree := range trees {
+		ids = append(ids, tree.Comment.ID)
+		if len(tree.Children) > 0 {
+			ids = append(ids, prunedIDs(tree.Children))
+		}
+	}
+	return ids
+}
+
+func TestPruneShort(t *testing.T) {
+	// 1 "long root" -> 2 "ok" -> 3 "long reply"; 4 "ok" без ответов
+	trees := func() []domain.CommentTree {
+		return []domain.CommentTree{
+			commentTree(1, "long root", commentTree(2, "ok", commentTree(3, "long reply"))),
+			commentTree(4, "ok"),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter shortFilter
+		want   []any
+	}{
+		{name: "disabled", filter: shortFilter{Strategy: pruneReparent}, want: []any{int64(1), []any{int64(2), []any{int64(3)}}, int64(4)}},
+		{name: "reparent", filter: shortFilter{MinLength: 3, Strategy: pruneReparent}, want: []any{int64(1), []any{int64(3)}}},
+		{name: "drop", filter: shortFilter{MinLength: 3, Strategy: pruneDrop}, want: []any{int64(1)}},
+		{name: "length equal to minimum kept", filter: shortFilter{MinLength: 9, Strategy: pruneDrop}, want: []any{int64(1)}},
+		{name: "everything short", filter: shortFilter{MinLength: 20, Strategy: pruneReparent}, want: []any{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prunedIDs(pruneShort(trees(), tt.filter)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pruneShort = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
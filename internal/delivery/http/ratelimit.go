@@ -0,0 +1,101 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// limiterIdleTTL время, после которого неиспользуемый лимитер клиента удаляется
+const limiterIdleTTL = 3 * time.Minute
+
+// ipRateLimiter хранит отдельный rate.Limiter для каждого IP адреса клиента
+type ipRateLimiter struct {
+	mu        sync.Mutex
+	limiters  map[string]*clientLimiter
+	rps       rate.Limit
+	burst     int
+	lastSweep time.Time
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newIPRateLimiter(rps float64, burst int) *ipRateLimiter {
+	return &ipRateLimiter{
+		limiters:  make(map[string]*clientLimiter),
+		rps:       rate.Limit(rps),
+		burst:     burst,
+		lastSweep: time.Now(),
+	}
+}
+
+// allow сообщает, может ли клиент с данным IP выполнить запрос прямо сейчас
+func (l *ipRateLimiter) allow(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > limiterIdleTTL {
+		for key, client := range l.limiters {
+			if now.Sub(client.lastSeen) > limiterIdleTTL {
+				delete(l.limiters, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	client, ok := l.limiters[ip]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(l.rps, l.burst)}
+		l.limiters[ip] = client
+	}
+	client.lastSeen = now
+
+	return client.limiter.AllowN(now, 1)
+}
+
+// SearchRateLimitMiddleware ограничивает частоту поисковых запросов (GET /comments?search=...) для каждого IP.
+// Поиск строит деревья по всей таблице, поэтому для него действует отдельный, более строгий лимит.
+// Остальные запросы проходят без ограничений. При rps <= 0 ограничение отключено
+func SearchRateLimitMiddleware(rps float64, burst int, next http.Handler) http.Handler {
+	if rps <= 0 {
+		return next
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	limiter := newIPRateLimiter(rps, burst)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isSearchRequest(r) && !limiter.allow(clientIP(r)) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many search requests", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isSearchRequest сообщает, является ли запрос поиском по комментариям
+func isSearchRequest(r *http.Request) bool {
+	return r.Method == http.MethodGet &&
+		r.URL.Path == "/comments" &&
+		r.URL.Query().Get("search") != ""
+}
+
+// clientIP возвращает IP адрес клиента из RemoteAddr
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,53 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSearchRateLimitMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name       string
+		target     string
+		remoteAddr string
+		wantStatus int
+	}{
+		{name: "first search", target: "/comments?search=go", remoteAddr: "10.0.0.1:1000", wantStatus: http.StatusOK},
+		{name: "second search limited", target: "/comments?search=go", remoteAddr: "10.0.0.1:1001", wantStatus: http.StatusTooManyRequests},
+		{name: "list not limited", target: "/comments", remoteAddr: "10.0.0.1:1002", wantStatus: http.StatusOK},
+		{name: "subtree not limited", target: "/comments?parent=5", remoteAddr: "10.0.0.1:1003", wantStatus: http.StatusOK},
+		{name: "other client", target: "/comments?search=go", remoteAddr: "10.0.0.2:1000", wantStatus: http.StatusOK},
+	}
+
+	// Тесты выполняются по порядку над одним лимитером: 1 запрос без пополнения
+	handler := SearchRateLimitMiddleware(0.001, 1, ok)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.RemoteAddr = tt.remoteAddr
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+				t.Error("Retry-After is not set")
+			}
+		})
+	}
+}
+
+func TestSearchRateLimitDisabled(t *testing.T) {
+	handler := SearchRateLimitMiddleware(0, 1, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/comments?search=go", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i, rec.Code)
+		}
+	}
+}
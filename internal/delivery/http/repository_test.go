@@ -0,0 +1,157 @@
+package http
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+	"github.com/oziev02/CommentTree/internal/usecase"
+)
+
+// stubRepository подменяет отдельные методы репозитория в тестах обработчиков.
+// Методы без заданной функции достаются от nil-интерфейса и паникуют при вызове
+type stubRepository struct {
+	domain.CommentRepository
+
+	create           func(ctx context.Context, comment *domain.Comment) error
+	createWithThread func(ctx context.Context, comment *domain.Comment) (*domain.CommentTree, error)
+	getPrevious      func(ctx context.Context, id int64) (*domain.Comment, error)
+	getAncestors     func(ctx context.Context, id int64) ([]domain.Comment, error)
+	accept           func(ctx context.Context, id int64) (*domain.Comment, error)
+	setCollapsed     func(ctx context.Context, id int64, collapsed bool) (*domain.Comment, error)
+	getReplies       func(ctx context.Context, parentID *int64, limit, offset int) ([]domain.Comment, error)
+	update           func(ctx context.Context, comment *domain.Comment) error
+
+	getByID        func(ctx context.Context, id int64) (*domain.Comment, error)
+	delete         func(ctx context.Context, id int64) error
+	deleteReparent func(ctx context.Context, id int64) error
+
+	locate  func(ctx context.Context, id int64, filter domain.CommentFilter) (*domain.CommentLocation, error)
+	getTree func(ctx context.Context, parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error)
+	count   func(ctx context.Context, filter domain.CommentFilter) (int, error)
+
+	search       func(ctx context.Context, query string, filter domain.CommentFilter) ([]domain.CommentTree, bool, error)
+	searchStream func(ctx context.Context, query string, filter domain.CommentFilter, yield func(domain.CommentTree) error) (bool, error)
+
+	getTimeline func(ctx context.Context, filter domain.CommentFilter) ([]domain.TimelineComment, error)
+	getRecent   func(ctx context.Context, limit int) ([]domain.RecentComment, error)
+	hasChildren func(ctx context.Context, ids []int64) (map[int64]bool, error)
+
+	lastDeletedAt func(ctx context.Context) (time.Time, error)
+
+	getThreadSummary  func(ctx context.Context, id int64) (*domain.ThreadSummary, error)
+	directReplyCounts func(ctx context.Context, ids []int64) (map[int64]int, error)
+	countReplies      func(ctx context.Context, ids []int64) (map[int64]int, error)
+}
+
+func (r *stubRepository) Create(ctx context.Context, comment *domain.Comment) error {
+	return r.create(ctx, comment)
+}
+
+func (r *stubRepository) CreateWithThread(ctx context.Context, comment *domain.Comment) (*domain.CommentTree, error) {
+	return r.createWithThread(ctx, comment)
+}
+
+func (r *stubRepository) GetPrevious(ctx context.Context, id int64) (*domain.Comment, error) {
+	return r.getPrevious(ctx, id)
+}
+
+func (r *stubRepository) GetAncestors(ctx context.Context, id int64) ([]domain.Comment, error) {
+	return r.getAncestors(ctx, id)
+}
+
+func (r *stubRepository) Accept(ctx context.Context, id int64) (*domain.Comment, error) {
+	return r.accept(ctx, id)
+}
+
+func (r *stubRepository) GetByID(ctx context.Context, id int64) (*domain.Comment, error) {
+	return r.getByID(ctx, id)
+}
+
+func (r *stubRepository) Delete(ctx context.Context, id int64) error {
+	return r.delete(ctx, id)
+}
+
+func (r *stubRepository) DeleteReparent(ctx context.Context, id int64) error {
+	return r.deleteReparent(ctx, id)
+}
+
+func (r *stubRepository) Update(ctx context.Context, comment *domain.Comment) error {
+	return r.update(ctx, comment)
+}
+
+func (r *stubRepository) GetReplies(ctx context.Context, parentID *int64, limit, offset int) ([]domain.Comment, error) {
+	return r.getReplies(ctx, parentID, limit, offset)
+}
+
+func (r *stubRepository) SetChildrenCollapsed(ctx context.Context, id int64, collapsed bool) (*domain.Comment, error) {
+	return r.setCollapsed(ctx, id, collapsed)
+}
+
+func (r *stubRepository) Locate(ctx context.Context, id int64, filter domain.CommentFilter) (*domain.CommentLocation, error) {
+	return r.locate(ctx, id, filter)
+}
+
+func (r *stubRepository) GetTree(ctx context.Context, parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error) {
+	return r.getTree(ctx, parentID, filter)
+}
+
+func (r *stubRepository) Count(ctx context.Context, filter domain.CommentFilter) (int, error) {
+	return r.count(ctx, filter)
+}
+
+func (r *stubRepository) Search(ctx context.Context, query string, filter domain.CommentFilter) ([]domain.CommentTree, bool, error) {
+	return r.search(ctx, query, filter)
+}
+
+func (r *stubRepository) SearchStream(ctx context.Context, query string, filter domain.CommentFilter, yield func(domain.CommentTree) error) (bool, error) {
+	return r.searchStream(ctx, query, filter, yield)
+}
+
+func (r *stubRepository) GetTimeline(ctx context.Context, filter domain.CommentFilter) ([]domain.TimelineComment, error) {
+	return r.getTimeline(ctx, filter)
+}
+
+func (r *stubRepository) GetRecent(ctx context.Context, limit int) ([]domain.RecentComment, error) {
+	return r.getRecent(ctx, limit)
+}
+
+func (r *stubRepository) HasChildren(ctx context.Context, ids []int64) (map[int64]bool, error) {
+	return r.hasChildren(ctx, ids)
+}
+
+// LastDeletedAt без заданной функции сообщает, что удалений не было: его вызывает каждый GET /comments
+func (r *stubRepository) LastDeletedAt(ctx context.Context) (time.Time, error) {
+	if r.lastDeletedAt == nil {
+		return time.Time{}, nil
+	}
+	return r.lastDeletedAt(ctx)
+}
+
+func (r *stubRepository) GetThreadSummary(ctx context.Context, id int64) (*domain.ThreadSummary, error) {
+	return r.getThreadSummary(ctx, id)
+}
+
+func (r *stubRepository) DirectReplyCounts(ctx context.Context, ids []int64) (map[int64]int, error) {
+	return r.directReplyCounts(ctx, ids)
+}
+
+func (r *stubRepository) CountReplies(ctx context.Context, ids []int64) (map[int64]int, error) {
+	return r.countReplies(ctx, ids)
+}
+
+// newTestHandler создает обработчик над repo с настройками по умолчанию, дополненными cfg
+func newTestHandler(repo domain.CommentRepository, cfg Config) *CommentHandler {
+	return newTestHandlerWithUseCase(repo, cfg, usecase.Config{})
+}
+
+// newTestHandlerWithUseCase создает обработчик над repo с настройками бизнес-логики ucCfg
+func newTestHandlerWithUseCase(repo domain.CommentRepository, cfg Config, ucCfg usecase.Config) *CommentHandler {
+	if cfg.MaxPageSize == 0 {
+		cfg.MaxPageSize = 100
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewCommentHandler(usecase.NewCommentUseCase(repo, ucCfg), logger, cfg)
+}
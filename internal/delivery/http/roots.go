@@ -0,0 +1,24 @@
+package http
+
+import "context"
+
+// collapseToRoots убирает ответы из деревьев режима view=roots и проставляет каждому корню
+// число его прямых ответов, полученное одним запросом для всей страницы
+func (h *CommentHandler) collapseToRoots(ctx context.Context, trees []CommentTreeResponse) error {
+	ids := make([]int64, len(trees))
+	for i := range trees {
+		ids[i] = trees[i].Comment.ID.value
+	}
+
+	counts, err := h.useCase.DirectReplyCounts(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range trees {
+		count := counts[trees[i].Comment.ID.value]
+		trees[i].Children = []CommentTreeResponse{}
+		trees[i].DirectReplyCount = &count
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// treeResponse строит дерево ответа с ID id и ответами children
+func treeResponse(id int64, children ...CommentTreeResponse) CommentTreeResponse {
+	if children == nil {
+		children = []CommentTreeResponse{}
+	}
+	return CommentTreeResponse{Comment: CommentResponse{ID: newCommentID(id, false)}, Children: children}
+}
+
+func TestCollapseToRoots(t *testing.T) {
+	errDatabase := errors.New("connection refused")
+
+	tests := []struct {
+		name       string
+		trees      []CommentTreeResponse
+		counts     map[int64]int
+		err        error
+		wantIDs    []int64
+		wantCounts []int
+		wantErr    error
+	}{
+		{
+			name:       "roots with and without replies",
+			trees:      []CommentTreeResponse{treeResponse(1, treeResponse(3, treeResponse(4))), treeResponse(2)},
+			counts:     map[int64]int{1: 5},
+			wantIDs:    []int64{1, 2},
+			wantCounts: []int{5, 0},
+		},
+		{
+			name:       "empty page",
+			trees:      []CommentTreeResponse{},
+			wantCounts: []int{},
+		},
+		{
+			name:    "count failed",
+			trees:   []CommentTreeResponse{treeResponse(1)},
+			err:     errDatabase,
+			wantIDs: []int64{1},
+			wantErr: errDatabase,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requested []int64
+			repo := &stubRepository{
+				directReplyCounts: func(ctx context.Context, ids []int64) (map[int64]int, error) {
+					requested = ids
+					return tt.counts, tt.err
+				},
+			}
+			h := newTestHandler(repo, Config{})
+
+			err := h.collapseToRoots(context.Background(), tt.trees)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(requested, tt.wantIDs) {
+				t.Errorf("requested ids = %v, want %v (one query per page)", requested, tt.wantIDs)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			for i, tree := range tt.trees {
+				if len(tree.Children) != 0 || tree.Children == nil {
+					t.Errorf("tree %d children = %v, want empty list", i, tree.Children)
+				}
+				if tree.DirectReplyCount == nil || *tree.DirectReplyCount != tt.wantCounts[i] {
+					t.Errorf("tree %d direct_reply_count = %v, want %d", i, tree.DirectReplyCount, tt.wantCounts[i])
+				}
+			}
+		})
+	}
+}
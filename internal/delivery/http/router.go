@@ -1,20 +1,121 @@
 package http
 
 import (
+	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/oziev02/CommentTree/internal/usecase"
 )
 
+// Router оборачивает http.ServeMux и запоминает методы, зарегистрированные для каждого маршрута
+type Router struct {
+	*http.ServeMux
+	patterns map[string]bool
+	methods  []string
+}
+
 // NewRouter создает HTTP роутер
-func NewRouter(commentUseCase *usecase.CommentUseCase) *http.ServeMux {
-	handler := NewCommentHandler(commentUseCase)
+func NewRouter(commentUseCase *usecase.CommentUseCase, logger *slog.Logger, cfg Config) *Router {
+	handler := NewCommentHandler(commentUseCase, logger, cfg)
+
+	router := &Router{
+		ServeMux: http.NewServeMux(),
+		patterns: make(map[string]bool),
+	}
+
+	router.handle(http.MethodPost, "/comments", handler.Create)
+	router.handle(http.MethodGet, "/comments", handler.GetTree)
+	router.handle(http.MethodGet, "/comments/recent", handler.GetRecent)
+	router.handle(http.MethodPost, "/comments/reply-counts", handler.ReplyCounts)
+	router.handle(http.MethodPatch, "/comments/{id}", handler.Update)
+	router.handle(http.MethodDelete, "/comments/{id}", handler.Delete)
+	router.handle(http.MethodPost, "/comments/{id}/accept", handler.Accept)
+	router.handle(http.MethodPost, "/comments/{id}/collapse-children", handler.CollapseChildren)
+	router.handle(http.MethodGet, "/comments/{id}/locate", handler.Locate)
+	router.handle(http.MethodGet, "/comments/{id}/summary", handler.Summary)
+	router.handle(http.MethodGet, "/comments/{id}/context", handler.Context)
+	router.handle(http.MethodGet, "/mentions/{username}", handler.GetMentions)
+	router.handle(http.MethodGet, "/permalinks/{slug}", handler.GetBySlug)
+	router.handle(http.MethodGet, "/content-hashes/{hash}", handler.GetByContentHash)
+
+	return router
+}
+
+// handle регистрирует обработчик и запоминает метод маршрута
+func (rt *Router) handle(method, path string, h http.HandlerFunc) {
+	pattern := method + " " + path
+	rt.HandleFunc(pattern, h)
+	rt.patterns[pattern] = true
+
+	for _, m := range rt.methods {
+		if m == method {
+			return
+		}
+	}
+	rt.methods = append(rt.methods, method)
+}
+
+// AllowedMethods возвращает методы, которые роутер обслуживает для пути запроса.
+// Для каждого известного метода проверяется, к какому маршруту ServeMux направил бы запрос,
+// поэтому результат совпадает с фактической маршрутизацией
+func (rt *Router) AllowedMethods(r *http.Request) []string {
+	var allowed []string
+	for _, method := range rt.methods {
+		probe := r.Clone(r.Context())
+		probe.Method = method
 
-	mux := http.NewServeMux()
+		if _, pattern := rt.Handler(probe); rt.patterns[pattern] {
+			allowed = append(allowed, method)
+		}
+	}
 
-	mux.HandleFunc("POST /comments", handler.Create)
-	mux.HandleFunc("GET /comments", handler.GetTree)
-	mux.HandleFunc("DELETE /comments/{id}", handler.Delete)
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	return append(allowed, http.MethodOptions)
+}
+
+// ServeHTTP направляет запрос в ServeMux. Если путь обслуживается маршрутами роутера, но не методом
+// запроса, отвечает 405 с заголовком Allow из AllowedMethods: сам ServeMux направил бы GET такого пути
+// в раздачу статики "GET /", а в Allow своего ответа 405 добавил бы GET и HEAD от нее
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodOptions {
+		if allowed := rt.AllowedMethods(r); allowed != nil && !methodAllowed(allowed, r.Method) {
+			w.Header().Set("Allow", allowHeader(allowed))
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+	}
+	rt.ServeMux.ServeHTTP(w, r)
+}
+
+// methodAllowed сообщает, входит ли method в allowed. HEAD обслуживается маршрутами GET
+func methodAllowed(allowed []string, method string) bool {
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	for _, m := range allowed {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRoute сообщает, обслуживает ли роутер путь запроса хотя бы одним методом
+func (rt *Router) HasRoute(r *http.Request) bool {
+	return len(rt.AllowedMethods(r)) > 0
+}
+
+// Route возвращает шаблон маршрута, к которому ServeMux направит запрос (пустая строка, если маршрута нет)
+func (rt *Router) Route(r *http.Request) string {
+	_, pattern := rt.Handler(r)
+	return pattern
+}
 
-	return mux
+// allowHeader формирует значение заголовка со списком методов
+func allowHeader(methods []string) string {
+	return strings.Join(methods, ", ")
 }
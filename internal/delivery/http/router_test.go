@@ -0,0 +1,55 @@
+package http
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oziev02/CommentTree/internal/usecase"
+)
+
+func TestRouterAllowedMethods(t *testing.T) {
+	router := NewRouter(usecase.NewCommentUseCase(&stubRepository{}, usecase.Config{}), slog.New(slog.NewTextHandler(io.Discard, nil)), Config{MaxPageSize: 100})
+	// Как в cmd/app: статика зарегистрирована прямо в ServeMux и перехватывает любой GET
+	router.Handle("GET /", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("static"))
+	}))
+	handler := CORSMiddleware(router.AllowedMethods, router)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantAllow  string
+	}{
+		{name: "preflight comment", method: http.MethodOptions, path: "/comments/5", wantStatus: http.StatusNoContent, wantAllow: "PATCH, DELETE, OPTIONS"},
+		{name: "preflight list", method: http.MethodOptions, path: "/comments", wantStatus: http.StatusNoContent, wantAllow: "POST, GET, OPTIONS"},
+		{name: "get comment", method: http.MethodGet, path: "/comments/5", wantStatus: http.StatusMethodNotAllowed, wantAllow: "PATCH, DELETE, OPTIONS"},
+		{name: "head comment", method: http.MethodHead, path: "/comments/5", wantStatus: http.StatusMethodNotAllowed, wantAllow: "PATCH, DELETE, OPTIONS"},
+		{name: "put list", method: http.MethodPut, path: "/comments", wantStatus: http.StatusMethodNotAllowed, wantAllow: "POST, GET, OPTIONS"},
+		{name: "post locate", method: http.MethodPost, path: "/comments/5/locate", wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET, OPTIONS"},
+		{name: "static page", method: http.MethodGet, path: "/thread/5", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+			if tt.method == http.MethodOptions {
+				if got := rec.Header().Get("Access-Control-Allow-Methods"); got != tt.wantAllow {
+					t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, tt.wantAllow)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// snippetEllipsis добавляется к обрезанному тексту
+const snippetEllipsis = "…"
+
+// parseSnippetLength разбирает параметр snippet_length: 0, если параметр не указан,
+// иначе положительное число символов, до которого обрезается текст комментариев в списке
+func parseSnippetLength(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("snippet_length")
+	if value == "" {
+		return 0, nil
+	}
+
+	length, err := strconv.Atoi(value)
+	if err != nil || length < 1 {
+		return 0, &domain.ValidationError{
+			Field:   "snippet_length",
+			Message: fmt.Sprintf("snippet_length must be a positive integer, got %q", value),
+		}
+	}
+	return length, nil
+}
+
+// applySnippet обрезает текст ответа до length символов (не разрывая многобайтовые символы)
+// и отмечает его как обрезанный. При length == 0 ответ не меняется
+func applySnippet(response *CommentResponse, length int) {
+	if length == 0 || utf8.RuneCountInString(response.Content) <= length {
+		return
+	}
+
+	runes := 0
+	for i := range response.Content {
+		if runes == length {
+			response.Content = response.Content[:i] + snippetEllipsis
+			break
+		}
+		runes++
+	}
+	response.Truncated = true
+}
+
+// applySnippetTrees применяет applySnippet ко всем комментариям деревьев
+func applySnippetTrees(trees []CommentTreeResponse, length int) {
+	if length == 0 {
+		return
+	}
+	for i := range trees {
+		applySnippet(&trees[i].Comment, length)
+		applySnippetTrees(trees[i].Children, length)
+	}
+}
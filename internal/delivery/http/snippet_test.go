@@ -0,0 +1,85 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseSnippetLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{name: "absent", query: "", want: 0},
+		{name: "positive", query: "?snippet_length=40", want: 40},
+		{name: "zero", query: "?snippet_length=0", wantErr: true},
+		{name: "negative", query: "?snippet_length=-1", wantErr: true},
+		{name: "not a number", query: "?snippet_length=short", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSnippetLength(httptest.NewRequest(http.MethodGet, "/comments"+tt.query, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("length = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplySnippet(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		length        int
+		want          string
+		wantTruncated bool
+	}{
+		{name: "disabled", content: "hello world", length: 0, want: "hello world"},
+		{name: "shorter", content: "hello", length: 10, want: "hello"},
+		{name: "exact", content: "hello", length: 5, want: "hello"},
+		{name: "longer", content: "hello world", length: 5, want: "hello" + snippetEllipsis, wantTruncated: true},
+		{name: "multibyte", content: "привет мир", length: 6, want: "привет" + snippetEllipsis, wantTruncated: true},
+		{name: "multibyte exact", content: "привет", length: 6, want: "привет"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := CommentResponse{Content: tt.content}
+			applySnippet(&response, tt.length)
+
+			if response.Content != tt.want {
+				t.Errorf("content = %q, want %q", response.Content, tt.want)
+			}
+			if response.Truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", response.Truncated, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestApplySnippetTrees(t *testing.T) {
+	trees := []CommentTreeResponse{{
+		Comment: CommentResponse{Content: "root text"},
+		Children: []CommentTreeResponse{
+			{Comment: CommentResponse{Content: "reply text"}},
+			{Comment: CommentResponse{Content: "ok"}},
+		},
+	}}
+
+	applySnippetTrees(trees, 4)
+
+	got := []string{trees[0].Comment.Content, trees[0].Children[0].Comment.Content, trees[0].Children[1].Comment.Content}
+	want := []string{"root" + snippetEllipsis, "repl" + snippetEllipsis, "ok"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("content[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package http
+
+import (
+	"net/http"
+	"path"
+)
+
+// StaticHandler раздает файлы веб-интерфейса из dir.
+// Для путей без расширения, которым не соответствует файл, отдается index.html,
+// чтобы работала клиентская маршрутизация. Отсутствующие ассеты (пути с расширением)
+// и пути API, для которых isAPIPath возвращает true, отвечают 404
+func StaticHandler(dir string, isAPIPath func(r *http.Request) bool) http.Handler {
+	root := http.Dir(dir)
+	fileServer := http.FileServer(root)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isAPIPath(r) {
+			http.NotFound(w, r)
+			return
+		}
+
+		name := path.Clean("/" + r.URL.Path)
+		if f, err := root.Open(name); err == nil {
+			f.Close()
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+
+		if path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		index, err := root.Open("/index.html")
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer index.Close()
+
+		stat, err := index.Stat()
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		http.ServeContent(w, r, "index.html", stat.ModTime(), index)
+	})
+}
@@ -0,0 +1,53 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStaticHandler(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"index.html": "<html>app</html>",
+		"app.js":     "console.log('app')",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	isAPIPath := func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, "/comments")
+	}
+	handler := StaticHandler(dir, isAPIPath)
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "client route", path: "/thread/5", wantStatus: http.StatusOK, wantBody: "<html>app</html>"},
+		{name: "asset", path: "/app.js", wantStatus: http.StatusOK, wantBody: "console.log('app')"},
+		{name: "missing asset", path: "/missing.js", wantStatus: http.StatusNotFound},
+		{name: "api path", path: "/comments/5", wantStatus: http.StatusNotFound},
+		{name: "outside dir", path: "/../../etc/passwd", wantStatus: http.StatusOK, wantBody: "<html>app</html>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body, tt.wantBody)
+			}
+		})
+	}
+}
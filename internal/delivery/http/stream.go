@@ -0,0 +1,82 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// ndjsonContentType тип ответа потоковой выдачи результатов поиска
+const ndjsonContentType = "application/x-ndjson"
+
+// wantsNDJSON сообщает, что клиент запросил потоковую выдачу (Accept: application/x-ndjson)
+func wantsNDJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), ndjsonContentType)
+}
+
+// streamSearch обрабатывает GET /comments?search=... с Accept: application/x-ndjson.
+// Каждая найденная ветка записывается отдельной строкой JSON и сразу отправляется клиенту.
+// Признак обрезки результата передается в trailer X-Search-Truncated, так как становится
+// окончательным только после записи тела
+func (h *CommentHandler) streamSearch(w http.ResponseWriter, r *http.Request, filter domain.CommentFilter, snippetLength, collapseAfter, maxRenderDepth int, short shortFilter, format responseFormat) {
+	total, err := h.useCase.GetTotalCount(r.Context(), filter)
+	if err != nil {
+		h.logger.Error("failed to count comments", "error", err)
+		total = -1
+	}
+	setPaginationHeaders(w, r, filter.Page, filter.PageSize, total)
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.Header().Set("Trailer", "X-Search-Truncated")
+
+	controller := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	written := 0
+
+	truncated, err := h.useCase.SearchStream(r.Context(), filter, func(tree domain.CommentTree) error {
+		// min_length со стратегией reparent может превратить одну ветку в несколько
+		for _, pruned := range pruneShort([]domain.CommentTree{tree}, short) {
+			trees := []CommentTreeResponse{toCommentTreeResponse(pruned, format)}
+			trees[0].SiblingIndex = written
+			trees[0].SiblingCount = 0
+			applySnippetTrees(trees, snippetLength)
+			applyCollapse(trees, collapseAfter)
+			continuations := splitContinuations(trees, maxRenderDepth)
+			setMaxDepth(&trees[0])
+
+			if err := encoder.Encode(trees[0]); err != nil {
+				return err
+			}
+			written++
+
+			// Продолжения ветки идут отдельными строками сразу после нее и отличаются полем continued_from
+			for i := range continuations {
+				setMaxDepth(&continuations[i])
+				if err := encoder.Encode(continuations[i]); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		if written == 0 {
+			w.Header().Del("Trailer")
+			writeServerError(w, err)
+			return
+		}
+		// Часть ответа уже отправлена: статус изменить нельзя, поток просто обрывается
+		h.logger.Warn("search stream interrupted", "error", err, "written", written)
+		return
+	}
+
+	w.Header().Set("X-Search-Truncated", strconv.FormatBool(truncated))
+}
@@ -0,0 +1,120 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+func TestSearchContentNegotiation(t *testing.T) {
+	one := int64(1)
+	found := []domain.CommentTree{
+		{Comment: domain.Comment{ID: 1, Content: "recursive queries"}, Matched: true, Children: []domain.CommentTree{
+			{Comment: domain.Comment{ID: 3, ParentID: &one, Content: "recursive CTE"}, Matched: true},
+		}},
+		{Comment: domain.Comment{ID: 2, Content: "recursion again"}, Matched: true},
+	}
+
+	tests := []struct {
+		name       string
+		accept     string
+		streamErr  error
+		wantStatus int
+		wantStream bool
+	}{
+		{name: "ndjson", accept: "application/x-ndjson", wantStatus: http.StatusOK, wantStream: true},
+		{name: "ndjson among other types", accept: "application/x-ndjson, application/json;q=0.5", wantStatus: http.StatusOK, wantStream: true},
+		{name: "json", accept: "application/json", wantStatus: http.StatusOK},
+		{name: "no accept", wantStatus: http.StatusOK},
+		{name: "stream fails before first tree", accept: "application/x-ndjson", streamErr: errors.New("db down"), wantStatus: http.StatusInternalServerError, wantStream: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streamed := false
+			repo := &stubRepository{
+				count: func(ctx context.Context, filter domain.CommentFilter) (int, error) {
+					return len(found), nil
+				},
+				search: func(ctx context.Context, query string, filter domain.CommentFilter) ([]domain.CommentTree, bool, error) {
+					return found, true, nil
+				},
+				searchStream: func(ctx context.Context, query string, filter domain.CommentFilter, yield func(domain.CommentTree) error) (bool, error) {
+					streamed = true
+					if tt.streamErr != nil {
+						return false, tt.streamErr
+					}
+					for _, tree := range found {
+						if err := yield(tree); err != nil {
+							return false, err
+						}
+					}
+					return true, nil
+				},
+			}
+			h := newTestHandler(repo, Config{})
+
+			req := httptest.NewRequest(http.MethodGet, "/comments?search=recurs", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			h.GetTree(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if streamed != tt.wantStream {
+				t.Fatalf("streamed = %v, want %v", streamed, tt.wantStream)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if !tt.wantStream {
+				var got CommentsListResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+					t.Fatalf("body %q is not a JSON object: %v", rec.Body, err)
+				}
+				if len(got.Comments) != len(found) || !got.Truncated {
+					t.Errorf("response = %+v, want %d truncated trees", got, len(found))
+				}
+				return
+			}
+
+			if ct := rec.Header().Get("Content-Type"); ct != ndjsonContentType {
+				t.Errorf("Content-Type = %q, want %q", ct, ndjsonContentType)
+			}
+			var ids []int64
+			scanner := bufio.NewScanner(strings.NewReader(rec.Body.String()))
+			for scanner.Scan() {
+				var tree CommentTreeResponse
+				decoder := json.NewDecoder(strings.NewReader(scanner.Text()))
+				decoder.DisallowUnknownFields()
+				if err := decoder.Decode(&tree); err != nil {
+					t.Fatalf("line %q is not a tree: %v", scanner.Text(), err)
+				}
+				if decoder.More() {
+					t.Fatalf("line %q holds more than one JSON value", scanner.Text())
+				}
+				if tree.Children == nil {
+					t.Errorf("tree %d has no children list", tree.Comment.ID.value)
+				}
+				ids = append(ids, tree.Comment.ID.value)
+			}
+			if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+				t.Errorf("streamed roots = %v, want [1 2]", ids)
+			}
+			if got := rec.Result().Trailer.Get("X-Search-Truncated"); got != "true" {
+				t.Errorf("X-Search-Truncated trailer = %q, want %q", got, "true")
+			}
+		})
+	}
+}
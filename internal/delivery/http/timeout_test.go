@@ -0,0 +1,88 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	// slow ждет отмены контекста запроса, как запрос к БД, и сообщает ее причину
+	slow := func(cancelled chan<- error) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+				cancelled <- r.Context().Err()
+			case <-time.After(time.Second):
+				cancelled <- nil
+			}
+			w.Write([]byte("late\n"))
+		})
+	}
+	fast := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handler", "fast")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("done\n"))
+	})
+
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		slow       bool
+		accept     string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "fast handler", timeout: time.Second, wantStatus: http.StatusCreated, wantBody: "done\n"},
+		{name: "slow handler", timeout: 20 * time.Millisecond, slow: true, wantStatus: http.StatusServiceUnavailable},
+		{name: "disabled", timeout: 0, wantStatus: http.StatusCreated, wantBody: "done\n"},
+		{name: "streaming", timeout: 20 * time.Millisecond, slow: true, accept: "application/x-ndjson", wantStatus: http.StatusOK, wantBody: "late\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cancelled := make(chan error, 1)
+			var next http.Handler = fast
+			if tt.slow {
+				next = slow(cancelled)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/comments", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			TimeoutMiddleware(tt.timeout, next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.slow {
+				if err := <-cancelled; !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("handler context error = %v, want deadline exceeded", err)
+				}
+			}
+
+			if tt.wantStatus == http.StatusServiceUnavailable {
+				if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+					t.Errorf("Content-Type = %q, want application/json", ct)
+				}
+				var body ErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error != errRequestTimedOut {
+					t.Errorf("body = %q (%v), want {\"error\": %q}", rec.Body, err, errRequestTimedOut)
+				}
+				return
+			}
+			if rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body, tt.wantBody)
+			}
+			if !tt.slow && rec.Header().Get("X-Handler") != "fast" {
+				t.Error("handler headers were not copied to the response")
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// timestampLayout формат меток времени в ответах (RFC 3339 с точностью до секунды)
+const timestampLayout = "2006-01-02T15:04:05Z07:00"
+
+// parseTimezone разбирает параметр tz - имя часового пояса IANA, например Europe/Moscow,
+// в котором форматируются метки времени ответа. Если параметр не указан, используется UTC
+func parseTimezone(r *http.Request) (*time.Location, error) {
+	value := r.URL.Query().Get("tz")
+	if value == "" {
+		return time.UTC, nil
+	}
+
+	// LoadLocation трактует "Local" как часовой пояс сервера, а результат должен зависеть только от запроса
+	loc, err := time.LoadLocation(value)
+	if err != nil || value == "Local" {
+		return nil, &domain.ValidationError{
+			Field:   "tz",
+			Message: fmt.Sprintf("tz must be an IANA time zone name, got %q", value),
+		}
+	}
+	return loc, nil
+}
+
+// formatTime форматирует метку времени в часовом поясе loc
+func formatTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(timestampLayout)
+}
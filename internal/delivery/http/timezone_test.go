@@ -0,0 +1,67 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+func TestTimezoneFormatting(t *testing.T) {
+	winter := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	summer := time.Date(2026, 7, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		query       string
+		wantStatus  int
+		wantCreated string
+		wantUpdated string
+	}{
+		{name: "UTC by default", wantStatus: http.StatusOK, wantCreated: "2026-01-15T12:00:00Z", wantUpdated: "2026-07-15T12:00:00Z"},
+		{name: "explicit UTC", query: "?tz=UTC", wantStatus: http.StatusOK, wantCreated: "2026-01-15T12:00:00Z", wantUpdated: "2026-07-15T12:00:00Z"},
+		{name: "America/New_York", query: "?tz=America/New_York", wantStatus: http.StatusOK, wantCreated: "2026-01-15T07:00:00-05:00", wantUpdated: "2026-07-15T08:00:00-04:00"},
+		{name: "invalid zone", query: "?tz=Mars/Olympus", wantStatus: http.StatusBadRequest},
+		{name: "server local zone", query: "?tz=Local", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &stubRepository{
+				getTree: func(ctx context.Context, parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error) {
+					return []domain.CommentTree{{Comment: domain.Comment{ID: 1, Content: "text", CreatedAt: winter, UpdatedAt: summer}}}, nil
+				},
+				count: func(ctx context.Context, filter domain.CommentFilter) (int, error) {
+					return 1, nil
+				},
+			}
+			h := newTestHandler(repo, Config{})
+
+			rec := httptest.NewRecorder()
+			h.GetTree(rec, httptest.NewRequest(http.MethodGet, "/comments"+tt.query, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response CommentsListResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("body is not JSON: %v", err)
+			}
+			if len(response.Comments) != 1 {
+				t.Fatalf("got %d comments, want 1", len(response.Comments))
+			}
+			comment := response.Comments[0].Comment
+			if comment.CreatedAt != tt.wantCreated || comment.UpdatedAt != tt.wantUpdated {
+				t.Errorf("created_at = %s, updated_at = %s, want %s and %s", comment.CreatedAt, comment.UpdatedAt, tt.wantCreated, tt.wantUpdated)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package domain
 
 import (
+	"context"
+	"strconv"
 	"time"
 )
 
@@ -11,30 +13,154 @@ type Comment struct {
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// Accepted отмечает ответ, принятый как решение в ветке (не больше одного на ветку)
+	Accepted bool `json:"accepted"`
+	// ExpiresAt момент, после которого комментарий перестает отображаться и удаляется (nil - бессрочно)
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Slug идентификатор постоянной ссылки вида "great-point-42". До сохранения содержит
+	// только основу из текста, при сохранении к ней добавляется ID (см. PermalinkSlug)
+	Slug string `json:"slug"`
+	// ClientRef произвольная ссылка клиента (например, локальный ID офлайн-клиента).
+	// Не уникальна; при равных метках времени участвует в сортировке перед ID
+	ClientRef string `json:"client_ref,omitempty"`
+	// ContentHash SHA-256 нормализованного текста; совпадает у копий одного и того же сообщения
+	ContentHash string `json:"content_hash"`
+	// ViewCount сколько раз ветка комментария запрашивалась как поддерево (обновляется с задержкой)
+	ViewCount int64 `json:"view_count"`
+	// ChildrenCollapsed подсказка клиенту показывать ответы комментария свернутыми по умолчанию
+	ChildrenCollapsed bool `json:"children_collapsed"`
+
+	// Mentions содержит имена пользователей, упомянутых в тексте; сохраняются при создании
+	Mentions []string `json:"-"`
+}
+
+// PermalinkSlug формирует slug из основы и ID комментария. Суффикс ID делает slug уникальным;
+// если основа пуста, slug состоит из одного ID
+func PermalinkSlug(base string, id int64) string {
+	if base == "" {
+		return strconv.FormatInt(id, 10)
+	}
+	return base + "-" + strconv.FormatInt(id, 10)
 }
 
-// CommentTree представляет комментарий со всеми вложенными комментариями
+// CommentTree представляет комментарий со всеми вложенными комментариями.
+// Children всегда присутствует: у комментария без ответов это пустой список.
+// Matched выставляется только в результатах поиска у комментариев, совпавших с запросом
 type CommentTree struct {
 	Comment  Comment       `json:"comment"`
-	Children []CommentTree `json:"children,omitempty"`
+	Children []CommentTree `json:"children"`
+	Matched  bool          `json:"matched,omitempty"`
+}
+
+// RecentComment представляет комментарий из ленты последних вместе с корнем его ветки
+type RecentComment struct {
+	Comment Comment `json:"comment"`
+	RootID  int64   `json:"root_id"`
+}
+
+// TimelineComment представляет комментарий плоской ленты вместе с его глубиной в дереве
+type TimelineComment struct {
+	Comment Comment `json:"comment"`
+	Depth   int     `json:"depth"`
+}
+
+// CommentLocation описывает положение ветки комментария в списке корневых комментариев.
+// Index - позиция корня ветки (с нуля) при текущей сортировке, Page - страница с этим корнем
+type CommentLocation struct {
+	RootID int64
+	Index  int
+	Page   int
+}
+
+// ThreadSummary краткая сводка ветки для превью ссылок: корневой комментарий ветки,
+// число комментариев в ней (вместе с корнем) и время последней активности
+type ThreadSummary struct {
+	Root           Comment
+	CommentCount   int
+	LastActivityAt time.Time
+}
+
+// CommentContext комментарий в контексте беседы: родитель (nil для корневого), страница соседей -
+// ответов того же родителя, включая сам комментарий, и страница его прямых ответов. Соседи и ответы
+// приходят без вложенных ответов; Total - их общее число
+type CommentContext struct {
+	Comment       Comment
+	Parent        *Comment
+	Siblings      []Comment
+	SiblingsTotal int
+	Children      []Comment
+	ChildrenTotal int
 }
 
+// Режимы выдачи комментариев
+const (
+	ViewTree     = "tree"     // деревья с пагинацией по корневым комментариям
+	ViewTimeline = "timeline" // плоская лента всех комментариев с пагинацией по комментариям
+	ViewRoots    = "roots"    // деревья без ответов, только с числом прямых ответов у каждого корня
+)
+
+// Стратегии удаления комментария
+const (
+	DeleteCascade  = "cascade"  // комментарий удаляется вместе со всеми ответами
+	DeleteReparent = "reparent" // удаляется только комментарий, его ответы переходят к его родителю
+)
+
+// SortHot сортировка корневых комментариев по рейтингу, учитывающему число ответов и возраст ветки.
+// Применяется только к списку деревьев; поиск, лента и поддерево сортируются по created_at
+const SortHot = "hot"
+
 // CommentFilter содержит параметры фильтрации и пагинации
 type CommentFilter struct {
 	ParentID *int64
 	Search   string
 	Page     int
 	PageSize int
-	SortBy   string // "created_at", "updated_at"
+	SortBy   string // "created_at", "updated_at", SortHot
 	Order    string // "asc", "desc"
+	View     string // ViewTree, ViewTimeline, ViewRoots
+
+	// HotDecay период затухания рейтинга SortHot, задается бизнес-логикой
+	HotDecay time.Duration
+	// MaxSearchResults максимальное число веток, рассматриваемых поиском (0 - без ограничения), задается бизнес-логикой
+	MaxSearchResults int
+
+	// CreatedAfter оставляет только корневые комментарии (прямые ответы ParentID для поддерева,
+	// совпадения при поиске), созданные не раньше этого момента
+	CreatedAfter *time.Time
 }
 
 // CommentRepository определяет интерфейс для работы с комментариями
 type CommentRepository interface {
-	Create(comment *Comment) error
-	GetByID(id int64) (*Comment, error)
-	GetTree(parentID *int64, filter CommentFilter) ([]CommentTree, error)
-	Delete(id int64) error
-	Search(query string, filter CommentFilter) ([]CommentTree, error)
-	Count(parentID *int64, search string) (int, error)
+	Create(ctx context.Context, comment *Comment) error
+	CreateWithThread(ctx context.Context, comment *Comment) (*CommentTree, error)
+	GetByID(ctx context.Context, id int64) (*Comment, error)
+	GetBySlug(ctx context.Context, slug string) (*Comment, error)
+	GetTree(ctx context.Context, parentID *int64, filter CommentFilter) ([]CommentTree, error)
+	Update(ctx context.Context, comment *Comment) error
+	Delete(ctx context.Context, id int64) error
+	DeleteReparent(ctx context.Context, id int64) error
+	Search(ctx context.Context, query string, filter CommentFilter) ([]CommentTree, bool, error)
+	SearchStream(ctx context.Context, query string, filter CommentFilter, yield func(CommentTree) error) (bool, error)
+	Count(ctx context.Context, filter CommentFilter) (int, error)
+	GetRecent(ctx context.Context, limit int) ([]RecentComment, error)
+	GetAncestors(ctx context.Context, id int64) ([]Comment, error)
+	GetPrevious(ctx context.Context, id int64) (*Comment, error)
+	GetReplies(ctx context.Context, parentID *int64, limit, offset int) ([]Comment, error)
+	GetByMention(ctx context.Context, username string, limit, offset int) ([]Comment, error)
+	GetByContentHash(ctx context.Context, hash string, limit, offset int) ([]Comment, error)
+	Accept(ctx context.Context, id int64) (*Comment, error)
+	GetTimeline(ctx context.Context, filter CommentFilter) ([]TimelineComment, error)
+	HasRecentDuplicate(ctx context.Context, parentID *int64, content string, since time.Time) (bool, error)
+	HasRecentSimilar(ctx context.Context, parentID *int64, content string, since time.Time, threshold float64) (bool, error)
+	DeleteExpired(ctx context.Context) (int64, error)
+	SweepOrphans(ctx context.Context, fix bool) (int64, error)
+	PruneDeletedIDs(ctx context.Context, retention time.Duration) (int64, error)
+	LastDeletedAt(ctx context.Context) (time.Time, error)
+	Locate(ctx context.Context, id int64, filter CommentFilter) (*CommentLocation, error)
+	CountReplies(ctx context.Context, ids []int64) (map[int64]int, error)
+	DirectReplyCounts(ctx context.Context, ids []int64) (map[int64]int, error)
+	HasChildren(ctx context.Context, ids []int64) (map[int64]bool, error)
+	AddViews(ctx context.Context, views map[int64]int64) error
+	GetThreadSummary(ctx context.Context, id int64) (*ThreadSummary, error)
+	SetChildrenCollapsed(ctx context.Context, id int64, collapsed bool) (*Comment, error)
 }
@@ -1,10 +1,76 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"strings"
+)
 
 // Sentinel ошибки доменного слоя
 var (
-	ErrCommentNotFound = errors.New("comment not found")
-	ErrInvalidParent   = errors.New("invalid parent comment")
-	ErrEmptyContent    = errors.New("comment content cannot be empty")
+	ErrCommentNotFound   = errors.New("comment not found")
+	ErrCommentDeleted    = errors.New("comment has been deleted")
+	ErrInvalidParent     = errors.New("invalid parent comment")
+	ErrParentDeleted     = errors.New("parent comment has been deleted")
+	ErrEmptyContent      = errors.New("comment content cannot be empty")
+	ErrCannotAcceptRoot  = errors.New("root comment cannot be accepted as an answer")
+	ErrDuplicateComment  = errors.New("identical comment was just posted")
+	ErrProbableDuplicate = errors.New("a very similar comment was just posted")
+	ErrContentTooLong    = errors.New("comment content is too long")
+	ErrInvalidExpiry     = errors.New("expires_at must be in the future")
+	ErrInvalidHash       = errors.New("content hash must be 64 lowercase hex characters")
+	ErrSearchDisabled    = errors.New("search is not available when content encryption is enabled")
+
+	ErrServiceUnavailable = errors.New("service temporarily unavailable")
+)
+
+// ValidationError описывает ошибку валидации конкретного поля запроса
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// ValidationErrors объединяет несколько ошибок проверки запроса, найденных за один проход,
+// чтобы клиент узнал обо всех проблемах сразу. Unwrap возвращает все ошибки, поэтому
+// errors.Is и errors.As находят любую из них
+type ValidationErrors []error
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e ValidationErrors) Unwrap() []error {
+	return e
+}
+
+// Коды ошибок ContentError
+const (
+	ContentTooLong = "content_too_long"
+	ContentEmpty   = "content_empty"
 )
+
+// ContentError описывает недопустимый текст комментария вместе с подсказкой автору, как его исправить.
+// Limit и Actual заполняются для ограничений длины. Unwrap возвращает sentinel-ошибку
+// (ErrContentTooLong, ErrEmptyContent), поэтому проверки errors.Is продолжают работать
+type ContentError struct {
+	Err        error
+	Code       string
+	Suggestion string
+	Limit      int
+	Actual     int
+}
+
+func (e *ContentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ContentError) Unwrap() error {
+	return e.Err
+}
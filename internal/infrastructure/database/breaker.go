@@ -0,0 +1,416 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+	"github.com/sony/gobreaker"
+)
+
+// BreakerRepository оборачивает CommentRepository в circuit breaker.
+// После серии подряд идущих ошибок базы данных запросы сразу завершаются
+// с domain.ErrServiceUnavailable, пока не истечет время ожидания
+type BreakerRepository struct {
+	repo    domain.CommentRepository
+	breaker *gobreaker.CircuitBreaker
+}
+
+// NewBreakerRepository создает новый экземпляр BreakerRepository
+func NewBreakerRepository(repo domain.CommentRepository, failureThreshold uint32, cooldown time.Duration) *BreakerRepository {
+	breaker := gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name:    "database",
+		Timeout: cooldown,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= failureThreshold
+		},
+		IsSuccessful: isBreakerSuccess,
+	})
+
+	return &BreakerRepository{repo: repo, breaker: breaker}
+}
+
+// State возвращает текущее состояние circuit breaker: closed, half-open или open
+func (r *BreakerRepository) State() string {
+	return r.breaker.State().String()
+}
+
+// Create создает новый комментарий
+func (r *BreakerRepository) Create(ctx context.Context, comment *domain.Comment) error {
+	_, err := r.execute(func() (interface{}, error) {
+		return nil, r.repo.Create(ctx, comment)
+	})
+	return err
+}
+
+// GetByID получает комментарий по ID
+func (r *BreakerRepository) GetByID(ctx context.Context, id int64) (*domain.Comment, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.GetByID(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*domain.Comment), nil
+}
+
+// GetTree получает дерево комментариев
+func (r *BreakerRepository) GetTree(ctx context.Context, parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.GetTree(ctx, parentID, filter)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]domain.CommentTree), nil
+}
+
+// Update заменяет текст комментария
+func (r *BreakerRepository) Update(ctx context.Context, comment *domain.Comment) error {
+	_, err := r.execute(func() (interface{}, error) {
+		return nil, r.repo.Update(ctx, comment)
+	})
+	return err
+}
+
+// Delete удаляет комментарий и все вложенные комментарии
+func (r *BreakerRepository) Delete(ctx context.Context, id int64) error {
+	_, err := r.execute(func() (interface{}, error) {
+		return nil, r.repo.Delete(ctx, id)
+	})
+	return err
+}
+
+// DeleteReparent удаляет комментарий, передавая его ответы его родителю
+func (r *BreakerRepository) DeleteReparent(ctx context.Context, id int64) error {
+	_, err := r.execute(func() (interface{}, error) {
+		return nil, r.repo.DeleteReparent(ctx, id)
+	})
+	return err
+}
+
+// Search выполняет полнотекстовый поиск по комментариям
+func (r *BreakerRepository) Search(ctx context.Context, query string, filter domain.CommentFilter) ([]domain.CommentTree, bool, error) {
+	type searchResult struct {
+		trees     []domain.CommentTree
+		truncated bool
+	}
+
+	result, err := r.execute(func() (interface{}, error) {
+		trees, truncated, err := r.repo.Search(ctx, query, filter)
+		return searchResult{trees: trees, truncated: truncated}, err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	res := result.(searchResult)
+	return res.trees, res.truncated, nil
+}
+
+// SearchStream выполняет поиск с передачей веток в yield по одной.
+// Ошибка yield (например, клиент закрыл соединение) не считается отказом базы данных
+func (r *BreakerRepository) SearchStream(ctx context.Context, query string, filter domain.CommentFilter, yield func(domain.CommentTree) error) (bool, error) {
+	var yieldErr error
+	result, err := r.execute(func() (interface{}, error) {
+		truncated, err := r.repo.SearchStream(ctx, query, filter, func(tree domain.CommentTree) error {
+			yieldErr = yield(tree)
+			return yieldErr
+		})
+		if yieldErr != nil {
+			return truncated, nil
+		}
+		return truncated, err
+	})
+	if yieldErr != nil {
+		return false, yieldErr
+	}
+	if err != nil {
+		return false, err
+	}
+	return result.(bool), nil
+}
+
+// Count возвращает количество комментариев
+func (r *BreakerRepository) Count(ctx context.Context, filter domain.CommentFilter) (int, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.Count(ctx, filter)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.(int), nil
+}
+
+// GetRecent получает последние комментарии любой вложенности
+func (r *BreakerRepository) GetRecent(ctx context.Context, limit int) ([]domain.RecentComment, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.GetRecent(ctx, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]domain.RecentComment), nil
+}
+
+// GetAncestors получает предков комментария
+func (r *BreakerRepository) GetAncestors(ctx context.Context, id int64) ([]domain.Comment, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.GetAncestors(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]domain.Comment), nil
+}
+
+// GetPrevious получает предшествующий комментарий с тем же родителем
+func (r *BreakerRepository) GetPrevious(ctx context.Context, id int64) (*domain.Comment, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.GetPrevious(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*domain.Comment), nil
+}
+
+// GetReplies получает страницу прямых ответов комментария
+func (r *BreakerRepository) GetReplies(ctx context.Context, parentID *int64, limit, offset int) ([]domain.Comment, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.GetReplies(ctx, parentID, limit, offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]domain.Comment), nil
+}
+
+// GetByMention получает комментарии, в которых упомянут пользователь
+func (r *BreakerRepository) GetByMention(ctx context.Context, username string, limit, offset int) ([]domain.Comment, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.GetByMention(ctx, username, limit, offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]domain.Comment), nil
+}
+
+// GetByContentHash получает комментарии с указанным хешем текста
+func (r *BreakerRepository) GetByContentHash(ctx context.Context, hash string, limit, offset int) ([]domain.Comment, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.GetByContentHash(ctx, hash, limit, offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]domain.Comment), nil
+}
+
+// Accept отмечает ответ как принятый в его ветке
+func (r *BreakerRepository) Accept(ctx context.Context, id int64) (*domain.Comment, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.Accept(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*domain.Comment), nil
+}
+
+// GetTimeline получает плоскую ленту комментариев
+func (r *BreakerRepository) GetTimeline(ctx context.Context, filter domain.CommentFilter) ([]domain.TimelineComment, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.GetTimeline(ctx, filter)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]domain.TimelineComment), nil
+}
+
+// HasRecentDuplicate проверяет наличие недавнего комментария с тем же текстом под тем же родителем
+func (r *BreakerRepository) HasRecentDuplicate(ctx context.Context, parentID *int64, content string, since time.Time) (bool, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.HasRecentDuplicate(ctx, parentID, content, since)
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.(bool), nil
+}
+
+// HasRecentSimilar проверяет наличие недавнего похожего комментария под тем же родителем
+func (r *BreakerRepository) HasRecentSimilar(ctx context.Context, parentID *int64, content string, since time.Time, threshold float64) (bool, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.HasRecentSimilar(ctx, parentID, content, since, threshold)
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.(bool), nil
+}
+
+// DeleteExpired удаляет комментарии с истекшим сроком жизни
+func (r *BreakerRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.DeleteExpired(ctx)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
+
+// SweepOrphans находит (или удаляет при fix) ответы без действующего родителя
+func (r *BreakerRepository) SweepOrphans(ctx context.Context, fix bool) (int64, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.SweepOrphans(ctx, fix)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
+
+// PruneDeletedIDs забывает ID, удаленные раньше чем retention назад
+func (r *BreakerRepository) PruneDeletedIDs(ctx context.Context, retention time.Duration) (int64, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.PruneDeletedIDs(ctx, retention)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
+
+// LastDeletedAt возвращает время последнего удаления комментария
+func (r *BreakerRepository) LastDeletedAt(ctx context.Context) (time.Time, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.LastDeletedAt(ctx)
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return result.(time.Time), nil
+}
+
+// Locate находит положение ветки комментария среди корневых комментариев
+func (r *BreakerRepository) Locate(ctx context.Context, id int64, filter domain.CommentFilter) (*domain.CommentLocation, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.Locate(ctx, id, filter)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*domain.CommentLocation), nil
+}
+
+// CreateWithThread создает комментарий и возвращает ветку его корневого комментария
+func (r *BreakerRepository) CreateWithThread(ctx context.Context, comment *domain.Comment) (*domain.CommentTree, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.CreateWithThread(ctx, comment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*domain.CommentTree), nil
+}
+
+// GetBySlug получает комментарий по slug постоянной ссылки
+func (r *BreakerRepository) GetBySlug(ctx context.Context, slug string) (*domain.Comment, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.GetBySlug(ctx, slug)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*domain.Comment), nil
+}
+
+// CountReplies возвращает число ответов любой вложенности для каждого комментария
+func (r *BreakerRepository) CountReplies(ctx context.Context, ids []int64) (map[int64]int, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.CountReplies(ctx, ids)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(map[int64]int), nil
+}
+
+// HasChildren определяет, у каких комментариев есть ответы
+func (r *BreakerRepository) HasChildren(ctx context.Context, ids []int64) (map[int64]bool, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.HasChildren(ctx, ids)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(map[int64]bool), nil
+}
+
+// DirectReplyCounts возвращает число прямых ответов для каждого комментария
+func (r *BreakerRepository) DirectReplyCounts(ctx context.Context, ids []int64) (map[int64]int, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.DirectReplyCounts(ctx, ids)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(map[int64]int), nil
+}
+
+// AddViews увеличивает счетчики просмотров комментариев
+func (r *BreakerRepository) AddViews(ctx context.Context, views map[int64]int64) error {
+	_, err := r.execute(func() (interface{}, error) {
+		return nil, r.repo.AddViews(ctx, views)
+	})
+	return err
+}
+
+// GetThreadSummary возвращает сводку ветки комментария
+func (r *BreakerRepository) GetThreadSummary(ctx context.Context, id int64) (*domain.ThreadSummary, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.GetThreadSummary(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*domain.ThreadSummary), nil
+}
+
+// SetChildrenCollapsed задает флаг свернутых по умолчанию ответов комментария
+func (r *BreakerRepository) SetChildrenCollapsed(ctx context.Context, id int64, collapsed bool) (*domain.Comment, error) {
+	result, err := r.execute(func() (interface{}, error) {
+		return r.repo.SetChildrenCollapsed(ctx, id, collapsed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*domain.Comment), nil
+}
+
+// execute выполняет запрос через circuit breaker и переводит отказ breaker в доменную ошибку
+func (r *BreakerRepository) execute(req func() (interface{}, error)) (interface{}, error) {
+	result, err := r.breaker.Execute(req)
+	if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+		return nil, domain.ErrServiceUnavailable
+	}
+	return result, err
+}
+
+// isBreakerSuccess считает доменные ошибки успешными запросами: база данных при этом доступна.
+// Запросы, прерванные отключением клиента (context.Canceled) или таймаутом запроса
+// (context.DeadlineExceeded), тоже не считаются отказом базы: иначе серия медленных клиентов
+// или всплеск таймаутов размыкала бы breaker для всего сервиса
+func isBreakerSuccess(err error) bool {
+	return err == nil ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, domain.ErrCommentNotFound) ||
+		errors.Is(err, domain.ErrCommentDeleted) ||
+		errors.Is(err, domain.ErrInvalidParent) ||
+		errors.Is(err, domain.ErrCannotAcceptRoot)
+}
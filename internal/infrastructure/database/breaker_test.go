@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+func TestIsBreakerSuccess(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: true},
+		{name: "not found", err: domain.ErrCommentNotFound, want: true},
+		{name: "deleted", err: domain.ErrCommentDeleted, want: true},
+		{name: "invalid parent", err: domain.ErrInvalidParent, want: true},
+		{name: "cannot accept root", err: domain.ErrCannotAcceptRoot, want: true},
+		{name: "canceled", err: context.Canceled, want: true},
+		{name: "wrapped canceled", err: fmt.Errorf("failed to get comment: %w", context.Canceled), want: true},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: true},
+		{name: "wrapped deadline exceeded", err: fmt.Errorf("failed to count comments: %w", context.DeadlineExceeded), want: true},
+		{name: "database failure", err: errors.New("connection refused"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBreakerSuccess(tt.err); got != tt.want {
+				t.Errorf("isBreakerSuccess(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakerIgnoresInterruptedRequests(t *testing.T) {
+	for _, interrupted := range []error{context.Canceled, context.DeadlineExceeded} {
+		t.Run(interrupted.Error(), func(t *testing.T) {
+			inner := newMemoryRepository()
+			inner.err = fmt.Errorf("failed to get comment: %w", interrupted)
+			repo := NewBreakerRepository(inner, 2, time.Minute)
+
+			for i := 0; i < 5; i++ {
+				if _, err := repo.GetByID(context.Background(), 1); !errors.Is(err, interrupted) {
+					t.Fatalf("GetByID error = %v, want %v", err, interrupted)
+				}
+			}
+			if state := repo.State(); state != "closed" {
+				t.Errorf("breaker state = %s, want closed", state)
+			}
+		})
+	}
+}
+
+func TestBreakerOpensOnDatabaseFailures(t *testing.T) {
+	inner := newMemoryRepository()
+	inner.err = errors.New("connection refused")
+	repo := NewBreakerRepository(inner, 2, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		repo.GetByID(context.Background(), 1)
+	}
+
+	calls := inner.calls
+	if _, err := repo.GetByID(context.Background(), 1); !errors.Is(err, domain.ErrServiceUnavailable) {
+		t.Fatalf("GetByID error = %v, want ErrServiceUnavailable", err)
+	}
+	if inner.calls != calls {
+		t.Error("open breaker must not call the repository")
+	}
+}
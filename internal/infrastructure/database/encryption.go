@@ -0,0 +1,398 @@
+package database
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// encryptedContentPrefix отличает зашифрованный текст от записанного до включения шифрования.
+// Версия в префиксе позволит сменить формат, не теряя старые записи
+const encryptedContentPrefix = "enc:v1:"
+
+// errContentComparison возвращается проверками дубликатов, которые сравнивают текст в SQL
+// и не могут работать с зашифрованным текстом. Конфигурация не допускает такого сочетания
+var errContentComparison = errors.New("content comparison is not supported with content encryption")
+
+// contentHashKeyLabel отделяет ключ HMAC для content_hash от ключа шифрования текста
+const contentHashKeyLabel = "commenttree content_hash"
+
+// EncryptedRepository декоратор CommentRepository, шифрующий текст комментариев AES-GCM перед записью
+// и расшифровывающий его при чтении. Поиск по тексту в БД с шифрованием невозможен, поэтому
+// он отключается (domain.ErrSearchDisabled). Slug строится только из ID, чтобы начало текста
+// не попадало в БД и ссылки в открытом виде. content_hash заменяется HMAC от хеша с ключом,
+// производным от ключа шифрования: иначе по хешу можно было бы подтвердить догадку о тексте.
+// Методы перечислены явно, чтобы новый метод интерфейса не обошел шифрование незамеченным
+type EncryptedRepository struct {
+	repo    domain.CommentRepository
+	aead    cipher.AEAD
+	hashKey []byte
+}
+
+// NewEncryptedRepository создает новый экземпляр EncryptedRepository с ключом AES длиной 16, 24 или 32 байта
+func NewEncryptedRepository(repo domain.CommentRepository, key []byte) (*EncryptedRepository, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create content cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create content cipher: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(contentHashKeyLabel))
+
+	return &EncryptedRepository{repo: repo, aead: aead, hashKey: mac.Sum(nil)}, nil
+}
+
+// keyHash заменяет хеш нормализованного текста его HMAC: копии одного текста по-прежнему
+// получают одинаковый хеш, но без ключа его нельзя сверить с SHA-256 предполагаемого текста
+func (r *EncryptedRepository) keyHash(hash string) string {
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(hash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// encrypt шифрует текст со случайным nonce и возвращает encryptedContentPrefix + base64(nonce || шифротекст)
+func (r *EncryptedRepository) encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, r.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := r.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedContentPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt расшифровывает текст комментария. Текст без encryptedContentPrefix записан до включения
+// шифрования и возвращается как есть. Ошибка означает поврежденный текст или другой ключ
+func (r *EncryptedRepository) decrypt(comment *domain.Comment) error {
+	encoded, ok := strings.CutPrefix(comment.Content, encryptedContentPrefix)
+	if !ok {
+		return nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < r.aead.NonceSize() {
+		return fmt.Errorf("failed to decrypt content of comment %d: malformed ciphertext", comment.ID)
+	}
+
+	nonce, ciphertext := sealed[:r.aead.NonceSize()], sealed[r.aead.NonceSize():]
+	plaintext, err := r.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt content of comment %d: %w", comment.ID, err)
+	}
+
+	comment.Content = string(plaintext)
+	return nil
+}
+
+// decryptTrees расшифровывает текст всех комментариев деревьев
+func (r *EncryptedRepository) decryptTrees(trees []domain.CommentTree) error {
+	for i := range trees {
+		if err := r.decrypt(&trees[i].Comment); err != nil {
+			return err
+		}
+		if err := r.decryptTrees(trees[i].Children); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decryptComments расшифровывает текст списка комментариев
+func (r *EncryptedRepository) decryptComments(comments []domain.Comment) error {
+	for i := range comments {
+		if err := r.decrypt(&comments[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sealComment заменяет текст комментария шифротекстом, а хеш текста - его HMAC перед записью
+// и возвращает функцию, восстанавливающую открытый текст: вызывающий код получает комментарий
+// с исходным текстом и тем хешем, который записан в БД
+func (r *EncryptedRepository) sealComment(comment *domain.Comment) (func(), error) {
+	plaintext := comment.Content
+	sealed, err := r.encrypt(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	comment.Content = sealed
+	comment.Slug = ""
+	if comment.ContentHash != "" {
+		comment.ContentHash = r.keyHash(comment.ContentHash)
+	}
+	return func() { comment.Content = plaintext }, nil
+}
+
+// Create шифрует текст и создает комментарий
+func (r *EncryptedRepository) Create(ctx context.Context, comment *domain.Comment) error {
+	restore, err := r.sealComment(comment)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	return r.repo.Create(ctx, comment)
+}
+
+// CreateWithThread шифрует текст, создает комментарий и возвращает расшифрованную ветку
+func (r *EncryptedRepository) CreateWithThread(ctx context.Context, comment *domain.Comment) (*domain.CommentTree, error) {
+	restore, err := r.sealComment(comment)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+
+	thread, err := r.repo.CreateWithThread(ctx, comment)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.decryptTrees([]domain.CommentTree{*thread}); err != nil {
+		return nil, err
+	}
+	return thread, nil
+}
+
+// Update шифрует новый текст и заменяет им текст комментария
+func (r *EncryptedRepository) Update(ctx context.Context, comment *domain.Comment) error {
+	restore, err := r.sealComment(comment)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	return r.repo.Update(ctx, comment)
+}
+
+// GetByID получает комментарий по ID и расшифровывает его текст
+func (r *EncryptedRepository) GetByID(ctx context.Context, id int64) (*domain.Comment, error) {
+	return r.decryptOne(r.repo.GetByID(ctx, id))
+}
+
+// GetBySlug получает комментарий по slug и расшифровывает его текст
+func (r *EncryptedRepository) GetBySlug(ctx context.Context, slug string) (*domain.Comment, error) {
+	return r.decryptOne(r.repo.GetBySlug(ctx, slug))
+}
+
+// Accept отмечает ответ как принятый и расшифровывает текст результата
+func (r *EncryptedRepository) Accept(ctx context.Context, id int64) (*domain.Comment, error) {
+	return r.decryptOne(r.repo.Accept(ctx, id))
+}
+
+// SetChildrenCollapsed задает флаг свернутых ответов и расшифровывает текст результата
+func (r *EncryptedRepository) SetChildrenCollapsed(ctx context.Context, id int64, collapsed bool) (*domain.Comment, error) {
+	return r.decryptOne(r.repo.SetChildrenCollapsed(ctx, id, collapsed))
+}
+
+// decryptOne расшифровывает текст комментария, полученного из репозитория
+func (r *EncryptedRepository) decryptOne(comment *domain.Comment, err error) (*domain.Comment, error) {
+	if err != nil {
+		return nil, err
+	}
+	if err := r.decrypt(comment); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// GetTree получает дерево комментариев и расшифровывает их текст
+func (r *EncryptedRepository) GetTree(ctx context.Context, parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error) {
+	trees, err := r.repo.GetTree(ctx, parentID, filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.decryptTrees(trees); err != nil {
+		return nil, err
+	}
+	return trees, nil
+}
+
+// Search недоступен: текст в БД зашифрован
+func (r *EncryptedRepository) Search(ctx context.Context, query string, filter domain.CommentFilter) ([]domain.CommentTree, bool, error) {
+	return nil, false, domain.ErrSearchDisabled
+}
+
+// SearchStream недоступен: текст в БД зашифрован
+func (r *EncryptedRepository) SearchStream(ctx context.Context, query string, filter domain.CommentFilter, yield func(domain.CommentTree) error) (bool, error) {
+	return false, domain.ErrSearchDisabled
+}
+
+// GetRecent получает последние комментарии и расшифровывает их текст
+func (r *EncryptedRepository) GetRecent(ctx context.Context, limit int) ([]domain.RecentComment, error) {
+	recent, err := r.repo.GetRecent(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range recent {
+		if err := r.decrypt(&recent[i].Comment); err != nil {
+			return nil, err
+		}
+	}
+	return recent, nil
+}
+
+// GetAncestors получает цепочку предков и расшифровывает их текст
+func (r *EncryptedRepository) GetAncestors(ctx context.Context, id int64) ([]domain.Comment, error) {
+	ancestors, err := r.repo.GetAncestors(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.decryptComments(ancestors); err != nil {
+		return nil, err
+	}
+	return ancestors, nil
+}
+
+// GetPrevious получает предшествующий комментарий с тем же родителем и расшифровывает его текст
+func (r *EncryptedRepository) GetPrevious(ctx context.Context, id int64) (*domain.Comment, error) {
+	previous, err := r.repo.GetPrevious(ctx, id)
+	if err != nil || previous == nil {
+		return previous, err
+	}
+	return r.decryptOne(previous, nil)
+}
+
+// GetReplies получает страницу прямых ответов комментария и расшифровывает их текст
+func (r *EncryptedRepository) GetReplies(ctx context.Context, parentID *int64, limit, offset int) ([]domain.Comment, error) {
+	comments, err := r.repo.GetReplies(ctx, parentID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.decryptComments(comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// GetByMention получает комментарии с упоминанием пользователя и расшифровывает их текст
+func (r *EncryptedRepository) GetByMention(ctx context.Context, username string, limit, offset int) ([]domain.Comment, error) {
+	comments, err := r.repo.GetByMention(ctx, username, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.decryptComments(comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// GetByContentHash недоступен: хеши в БД вычислены с ключом, и хеш, посчитанный клиентом, с ними не совпадет
+func (r *EncryptedRepository) GetByContentHash(ctx context.Context, hash string, limit, offset int) ([]domain.Comment, error) {
+	return nil, domain.ErrSearchDisabled
+}
+
+// GetTimeline получает плоскую ленту и расшифровывает текст комментариев. Поиск по ленте недоступен
+func (r *EncryptedRepository) GetTimeline(ctx context.Context, filter domain.CommentFilter) ([]domain.TimelineComment, error) {
+	if filter.Search != "" {
+		return nil, domain.ErrSearchDisabled
+	}
+
+	timeline, err := r.repo.GetTimeline(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for i := range timeline {
+		if err := r.decrypt(&timeline[i].Comment); err != nil {
+			return nil, err
+		}
+	}
+	return timeline, nil
+}
+
+// GetThreadSummary получает сводку ветки и расшифровывает текст ее корня
+func (r *EncryptedRepository) GetThreadSummary(ctx context.Context, id int64) (*domain.ThreadSummary, error) {
+	summary, err := r.repo.GetThreadSummary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.decrypt(&summary.Root); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// HasRecentDuplicate недоступен: шифротексты одинаковых текстов различаются
+func (r *EncryptedRepository) HasRecentDuplicate(ctx context.Context, parentID *int64, content string, since time.Time) (bool, error) {
+	return false, errContentComparison
+}
+
+// HasRecentSimilar недоступен: сходство шифротекстов не связано со сходством текстов
+func (r *EncryptedRepository) HasRecentSimilar(ctx context.Context, parentID *int64, content string, since time.Time, threshold float64) (bool, error) {
+	return false, errContentComparison
+}
+
+// Delete удаляет комментарий: текст не затрагивается
+func (r *EncryptedRepository) Delete(ctx context.Context, id int64) error {
+	return r.repo.Delete(ctx, id)
+}
+
+// DeleteReparent удаляет комментарий, переподвешивая ответы: текст не затрагивается
+func (r *EncryptedRepository) DeleteReparent(ctx context.Context, id int64) error {
+	return r.repo.DeleteReparent(ctx, id)
+}
+
+// Count подсчитывает комментарии: текст не затрагивается
+func (r *EncryptedRepository) Count(ctx context.Context, filter domain.CommentFilter) (int, error) {
+	return r.repo.Count(ctx, filter)
+}
+
+// DeleteExpired удаляет истекшие комментарии: текст не затрагивается
+func (r *EncryptedRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	return r.repo.DeleteExpired(ctx)
+}
+
+// SweepOrphans ищет и удаляет осиротевшие комментарии: текст не затрагивается
+func (r *EncryptedRepository) SweepOrphans(ctx context.Context, fix bool) (int64, error) {
+	return r.repo.SweepOrphans(ctx, fix)
+}
+
+// PruneDeletedIDs забывает старые удаленные ID: текст не затрагивается
+func (r *EncryptedRepository) PruneDeletedIDs(ctx context.Context, retention time.Duration) (int64, error) {
+	return r.repo.PruneDeletedIDs(ctx, retention)
+}
+
+// LastDeletedAt возвращает время последнего удаления: текст не затрагивается
+func (r *EncryptedRepository) LastDeletedAt(ctx context.Context) (time.Time, error) {
+	return r.repo.LastDeletedAt(ctx)
+}
+
+// Locate определяет позицию комментария в выдаче: текст не затрагивается
+func (r *EncryptedRepository) Locate(ctx context.Context, id int64, filter domain.CommentFilter) (*domain.CommentLocation, error) {
+	return r.repo.Locate(ctx, id, filter)
+}
+
+// CountReplies подсчитывает ответы: текст не затрагивается
+func (r *EncryptedRepository) CountReplies(ctx context.Context, ids []int64) (map[int64]int, error) {
+	return r.repo.CountReplies(ctx, ids)
+}
+
+// DirectReplyCounts подсчитывает прямые ответы: текст не затрагивается
+func (r *EncryptedRepository) DirectReplyCounts(ctx context.Context, ids []int64) (map[int64]int, error) {
+	return r.repo.DirectReplyCounts(ctx, ids)
+}
+
+// HasChildren проверяет наличие ответов: текст не затрагивается
+func (r *EncryptedRepository) HasChildren(ctx context.Context, ids []int64) (map[int64]bool, error) {
+	return r.repo.HasChildren(ctx, ids)
+}
+
+// AddViews добавляет просмотры: текст не затрагивается
+func (r *EncryptedRepository) AddViews(ctx context.Context, views map[int64]int64) error {
+	return r.repo.AddViews(ctx, views)
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+func newTestEncryptedRepository(t *testing.T, inner domain.CommentRepository, key []byte) *EncryptedRepository {
+	t.Helper()
+
+	repo, err := NewEncryptedRepository(inner, key)
+	if err != nil {
+		t.Fatalf("NewEncryptedRepository: %v", err)
+	}
+	return repo
+}
+
+func TestNewEncryptedRepositoryKeyLength(t *testing.T) {
+	tests := []struct {
+		size    int
+		wantErr bool
+	}{
+		{size: 16},
+		{size: 24},
+		{size: 32},
+		{size: 0, wantErr: true},
+		{size: 31, wantErr: true},
+		{size: 64, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := NewEncryptedRepository(newMemoryRepository(), make([]byte, tt.size))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("key of %d bytes: error = %v, wantErr %v", tt.size, err, tt.wantErr)
+		}
+	}
+}
+
+func TestEncryptedRepositoryStoresCiphertext(t *testing.T) {
+	const plaintext = "secret message"
+	const plainHash = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+
+	tests := []struct {
+		name  string
+		write func(repo *EncryptedRepository, inner *memoryRepository) (*domain.Comment, error)
+	}{
+		{name: "Create", write: func(repo *EncryptedRepository, inner *memoryRepository) (*domain.Comment, error) {
+			comment := &domain.Comment{Content: plaintext, ContentHash: plainHash, Slug: "secret-message"}
+			return comment, repo.Create(context.Background(), comment)
+		}},
+		{name: "Update", write: func(repo *EncryptedRepository, inner *memoryRepository) (*domain.Comment, error) {
+			if err := inner.Create(context.Background(), &domain.Comment{Content: "old"}); err != nil {
+				return nil, err
+			}
+			comment := &domain.Comment{ID: 1, Content: plaintext, ContentHash: plainHash}
+			return comment, repo.Update(context.Background(), comment)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := newMemoryRepository()
+			repo := newTestEncryptedRepository(t, inner, bytes.Repeat([]byte{1}, 32))
+
+			comment, err := tt.write(repo, inner)
+			if err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			if comment.Content != plaintext {
+				t.Errorf("caller content = %q, want plaintext restored", comment.Content)
+			}
+
+			stored := inner.stored(comment.ID)
+			if !strings.HasPrefix(stored.Content, encryptedContentPrefix) {
+				t.Errorf("stored content = %q, want %s prefix", stored.Content, encryptedContentPrefix)
+			}
+			if strings.Contains(stored.Content, plaintext) {
+				t.Error("stored content contains plaintext")
+			}
+			if stored.Slug != "" {
+				t.Errorf("stored slug = %q, want empty", stored.Slug)
+			}
+			if stored.ContentHash == plainHash || len(stored.ContentHash) != len(plainHash) {
+				t.Errorf("stored content_hash = %q, want keyed hash", stored.ContentHash)
+			}
+			if comment.ContentHash != stored.ContentHash {
+				t.Errorf("caller content_hash = %q, want stored %q", comment.ContentHash, stored.ContentHash)
+			}
+
+			read, err := repo.GetByID(context.Background(), comment.ID)
+			if err != nil {
+				t.Fatalf("GetByID: %v", err)
+			}
+			if read.Content != plaintext {
+				t.Errorf("read content = %q, want %q", read.Content, plaintext)
+			}
+		})
+	}
+}
+
+func TestEncryptedRepositoryKeyedHash(t *testing.T) {
+	const plainHash = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+
+	repo := newTestEncryptedRepository(t, newMemoryRepository(), bytes.Repeat([]byte{1}, 32))
+	other := newTestEncryptedRepository(t, newMemoryRepository(), bytes.Repeat([]byte{2}, 32))
+
+	if repo.keyHash(plainHash) != repo.keyHash(plainHash) {
+		t.Error("keyed hash must be deterministic so copies of a text share it")
+	}
+	if repo.keyHash(plainHash) == other.keyHash(plainHash) {
+		t.Error("keyed hash must depend on the key")
+	}
+	if repo.keyHash(plainHash) == repo.keyHash(strings.Repeat("0", 64)) {
+		t.Error("keyed hash must depend on the text hash")
+	}
+}
+
+func TestEncryptedRepositoryWrongKey(t *testing.T) {
+	inner := newMemoryRepository()
+	writer := newTestEncryptedRepository(t, inner, bytes.Repeat([]byte{1}, 32))
+	reader := newTestEncryptedRepository(t, inner, bytes.Repeat([]byte{2}, 32))
+
+	comment := &domain.Comment{Content: "secret message"}
+	if err := writer.Create(context.Background(), comment); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if _, err := reader.GetByID(context.Background(), comment.ID); err == nil {
+		t.Error("GetByID with a wrong key must fail instead of returning garbage")
+	}
+}
+
+func TestEncryptedRepositoryDecrypt(t *testing.T) {
+	repo := newTestEncryptedRepository(t, newMemoryRepository(), bytes.Repeat([]byte{1}, 32))
+	sealed, err := repo.encrypt("secret message")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{name: "ciphertext", content: sealed, want: "secret message"},
+		{name: "written before encryption", content: "legacy text", want: "legacy text"},
+		{name: "malformed base64", content: encryptedContentPrefix + "!!!", wantErr: true},
+		{name: "too short", content: encryptedContentPrefix + "AAAA", wantErr: true},
+		{name: "tampered", content: sealed[:len(sealed)-4] + "AAAA", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comment := &domain.Comment{ID: 1, Content: tt.content}
+			err := repo.decrypt(comment)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decrypt error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && comment.Content != tt.want {
+				t.Errorf("content = %q, want %q", comment.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptedRepositoryDisabledMethods(t *testing.T) {
+	repo := newTestEncryptedRepository(t, newMemoryRepository(), bytes.Repeat([]byte{1}, 32))
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{name: "Search", call: func() error {
+			_, _, err := repo.Search(ctx, "text", domain.CommentFilter{})
+			return err
+		}, want: domain.ErrSearchDisabled},
+		{name: "SearchStream", call: func() error {
+			_, err := repo.SearchStream(ctx, "text", domain.CommentFilter{}, nil)
+			return err
+		}, want: domain.ErrSearchDisabled},
+		{name: "GetByContentHash", call: func() error {
+			_, err := repo.GetByContentHash(ctx, strings.Repeat("0", 64), 10, 0)
+			return err
+		}, want: domain.ErrSearchDisabled},
+		{name: "GetTimeline search", call: func() error {
+			_, err := repo.GetTimeline(ctx, domain.CommentFilter{Search: "text"})
+			return err
+		}, want: domain.ErrSearchDisabled},
+		{name: "HasRecentDuplicate", call: func() error {
+			_, err := repo.HasRecentDuplicate(ctx, nil, "text", time.Time{})
+			return err
+		}, want: errContentComparison},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
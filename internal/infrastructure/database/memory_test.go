@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"sync"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// memoryRepository хранит комментарии в памяти для тестов декораторов репозитория.
+// Методы, которые тесты не используют, достаются от nil-интерфейса и паникуют при вызове.
+// Если задан err, все реализованные методы возвращают его
+type memoryRepository struct {
+	domain.CommentRepository
+
+	mu       sync.Mutex
+	comments map[int64]domain.Comment
+	nextID   int64
+	err      error
+	calls    int
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{comments: make(map[int64]domain.Comment)}
+}
+
+func (r *memoryRepository) Create(ctx context.Context, comment *domain.Comment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls++
+	if r.err != nil {
+		return r.err
+	}
+	r.nextID++
+	comment.ID = r.nextID
+	r.comments[comment.ID] = *comment
+	return nil
+}
+
+func (r *memoryRepository) GetByID(ctx context.Context, id int64) (*domain.Comment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	comment, ok := r.comments[id]
+	if !ok {
+		return nil, domain.ErrCommentNotFound
+	}
+	return &comment, nil
+}
+
+func (r *memoryRepository) Update(ctx context.Context, comment *domain.Comment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls++
+	if r.err != nil {
+		return r.err
+	}
+	stored, ok := r.comments[comment.ID]
+	if !ok {
+		return domain.ErrCommentNotFound
+	}
+	stored.Content = comment.Content
+	stored.ContentHash = comment.ContentHash
+	r.comments[comment.ID] = stored
+	*comment = stored
+	return nil
+}
+
+// stored возвращает комментарий в том виде, в котором он записан в "БД"
+func (r *memoryRepository) stored(id int64) domain.Comment {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.comments[id]
+}
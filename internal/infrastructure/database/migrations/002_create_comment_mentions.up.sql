@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS comment_mentions (
+    comment_id BIGINT NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    username TEXT NOT NULL,
+    PRIMARY KEY (comment_id, username)
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_mentions_username ON comment_mentions(username);
@@ -0,0 +1 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS accepted BOOLEAN NOT NULL DEFAULT FALSE;
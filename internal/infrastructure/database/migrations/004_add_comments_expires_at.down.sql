@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_comments_expires_at;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_comments_slug;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS slug;
@@ -0,0 +1,5 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS slug TEXT;
+
+UPDATE comments SET slug = id::text WHERE slug IS NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_comments_slug ON comments(slug);
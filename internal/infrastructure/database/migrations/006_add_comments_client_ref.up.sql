@@ -0,0 +1 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS client_ref TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS deleted_ids (
+    id BIGINT PRIMARY KEY,
+    deleted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_comments_content_hash;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS content_hash;
@@ -0,0 +1,7 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS content_hash TEXT NOT NULL DEFAULT '';
+
+UPDATE comments
+SET content_hash = encode(sha256(convert_to(lower(btrim(regexp_replace(content, '\s+', ' ', 'g'))), 'UTF8')), 'hex')
+WHERE content_hash = '';
+
+CREATE INDEX IF NOT EXISTS idx_comments_content_hash ON comments(content_hash);
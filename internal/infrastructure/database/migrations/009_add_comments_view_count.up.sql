@@ -0,0 +1 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS view_count BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_comment_mentions_username_lower;
+
+CREATE INDEX IF NOT EXISTS idx_comment_mentions_username ON comment_mentions(username);
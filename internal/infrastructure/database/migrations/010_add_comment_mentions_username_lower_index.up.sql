@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_comment_mentions_username;
+
+CREATE INDEX IF NOT EXISTS idx_comment_mentions_username_lower ON comment_mentions(LOWER(username));
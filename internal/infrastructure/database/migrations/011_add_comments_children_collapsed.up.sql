@@ -0,0 +1 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS children_collapsed BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_deleted_ids_deleted_at;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_deleted_ids_deleted_at ON deleted_ids(deleted_at);
@@ -3,14 +3,21 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/oziev02/CommentTree/internal/domain"
 )
 
+// foreignKeyViolation код ошибки PostgreSQL при нарушении внешнего ключа
+const foreignKeyViolation = "23503"
+
 // PostgresRepository реализует CommentRepository для PostgreSQL
 type PostgresRepository struct {
 	pool *pgxpool.Pool
@@ -21,11 +28,127 @@ func NewPostgresRepository(pool *pgxpool.Pool) *PostgresRepository {
 	return &PostgresRepository{pool: pool}
 }
 
-// Create создает новый комментарий
-func (r *PostgresRepository) Create(comment *domain.Comment) error {
+// Create создает новый комментарий вместе с его упоминаниями в одной транзакции
+func (r *PostgresRepository) Create(ctx context.Context, comment *domain.Comment) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := r.insertComment(ctx, tx, comment); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// CreateWithThread создает комментарий и в той же транзакции читает всю ветку его корневого
+// комментария, поэтому возвращаемое дерево гарантированно содержит новый комментарий
+func (r *PostgresRepository) CreateWithThread(ctx context.Context, comment *domain.Comment) (*domain.CommentTree, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := r.insertComment(ctx, tx, comment); err != nil {
+		return nil, err
+	}
+
+	query := `
+		WITH RECURSIVE comment_path AS (
+			SELECT id, parent_id
+			FROM comments
+			WHERE id = $1
+			
+			UNION ALL
+			
+			SELECT c.id, c.parent_id
+			FROM comments c
+			INNER JOIN comment_path cp ON c.id = cp.parent_id
+		),
+		thread AS (
+			SELECT ` + commentColumnsAs("c") + `
+			FROM comments c
+			INNER JOIN comment_path cp ON cp.id = c.id
+			WHERE cp.parent_id IS NULL
+			
+			UNION ALL
+			
+			SELECT ` + commentColumnsAs("c") + `
+			FROM comments c
+			INNER JOIN thread t ON c.parent_id = t.id
+			WHERE ` + notExpiredAs("c") + `
+		)
+		SELECT ` + commentColumns + `
+		FROM thread
+	`
+
+	rows, err := tx.Query(ctx, query, comment.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comment thread: %w", err)
+	}
+	defer rows.Close()
+
+	comments := make(map[int64]*domain.Comment)
+	var root *domain.Comment
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+
+		if c.ParentID == nil {
+			root = &c
+		}
+
+		comments[c.ID] = &c
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	if root == nil {
+		return nil, fmt.Errorf("failed to get comment thread: root of comment %d not found", comment.ID)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	tree := r.buildTree(root, comments)
+
+	return &tree, nil
+}
+
+// insertComment вставляет комментарий и его упоминания в рамках транзакции tx.
+// Родитель блокируется FOR SHARE до конца транзакции: проверка в use case выполняется раньше,
+// и без блокировки родитель мог бы быть удален между проверкой и вставкой. Родитель, удаленный
+// уже после проверки, дает ErrParentDeleted, как и в use case
+func (r *PostgresRepository) insertComment(ctx context.Context, tx pgx.Tx, comment *domain.Comment) error {
+	if comment.ParentID != nil {
+		var parentExpiresAt *time.Time
+		parentQuery := `SELECT expires_at FROM comments WHERE id = $1 AND ` + notExpired + ` FOR SHARE`
+		err := tx.QueryRow(ctx, parentQuery, *comment.ParentID).Scan(&parentExpiresAt)
+		if err == pgx.ErrNoRows {
+			return r.invalidParent(ctx, *comment.ParentID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock parent comment: %w", err)
+		}
+		if parentExpiresAt != nil && (comment.ExpiresAt == nil || comment.ExpiresAt.After(*parentExpiresAt)) {
+			comment.ExpiresAt = parentExpiresAt
+		}
+	}
+
 	query := `
-		INSERT INTO comments (parent_id, content, created_at, updated_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO comments (parent_id, content, created_at, updated_at, expires_at, client_ref, content_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id
 	`
 
@@ -33,64 +156,123 @@ func (r *PostgresRepository) Create(comment *domain.Comment) error {
 	comment.CreatedAt = now
 	comment.UpdatedAt = now
 
-	err := r.pool.QueryRow(
-		context.Background(),
+	err := tx.QueryRow(
+		ctx,
 		query,
 		comment.ParentID,
 		comment.Content,
 		comment.CreatedAt,
 		comment.UpdatedAt,
+		comment.ExpiresAt,
+		comment.ClientRef,
+		comment.ContentHash,
 	).Scan(&comment.ID)
 
+	// Внешний ключ parent_id - последняя линия защиты от вставки ответа без родителя
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+		return r.invalidParent(ctx, *comment.ParentID)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create comment: %w", err)
 	}
 
+	// Slug включает ID, который известен только после вставки
+	comment.Slug = domain.PermalinkSlug(comment.Slug, comment.ID)
+	if _, err := tx.Exec(ctx, `UPDATE comments SET slug = $1 WHERE id = $2`, comment.Slug, comment.ID); err != nil {
+		return fmt.Errorf("failed to set comment slug: %w", err)
+	}
+
+	if len(comment.Mentions) > 0 {
+		mentionsQuery := `
+			INSERT INTO comment_mentions (comment_id, username)
+			SELECT $1, unnest($2::text[])
+			ON CONFLICT DO NOTHING
+		`
+		if _, err := tx.Exec(ctx, mentionsQuery, comment.ID, comment.Mentions); err != nil {
+			return fmt.Errorf("failed to save mentions: %w", err)
+		}
+	}
+
 	return nil
 }
 
 // GetByID получает комментарий по ID
-func (r *PostgresRepository) GetByID(id int64) (*domain.Comment, error) {
+func (r *PostgresRepository) GetByID(ctx context.Context, id int64) (*domain.Comment, error) {
 	query := `
-		SELECT id, parent_id, content, created_at, updated_at
+		SELECT ` + commentColumns + `
 		FROM comments
-		WHERE id = $1
+		WHERE id = $1 AND ` + notExpired + `
 	`
 
-	var comment domain.Comment
-	var parentID sql.NullInt64
-
-	err := r.pool.QueryRow(
-		context.Background(),
-		query,
-		id,
-	).Scan(
-		&comment.ID,
-		&parentID,
-		&comment.Content,
-		&comment.CreatedAt,
-		&comment.UpdatedAt,
-	)
-
+	comment, err := scanComment(r.pool.QueryRow(ctx, query, id))
 	if err == pgx.ErrNoRows {
-		return nil, domain.ErrCommentNotFound
+		return nil, r.notFound(ctx, id)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get comment: %w", err)
 	}
 
-	if parentID.Valid {
-		comment.ParentID = &parentID.Int64
+	return &comment, nil
+}
+
+// invalidParent возвращает ошибку для отсутствующего родителя parentID: ErrParentDeleted,
+// если он был удален, иначе ErrInvalidParent. Проверка идет через пул, а не через транзакцию
+// вставки: после нарушения внешнего ключа транзакция уже прервана
+func (r *PostgresRepository) invalidParent(ctx context.Context, parentID int64) error {
+	err := r.notFound(ctx, parentID)
+	if errors.Is(err, domain.ErrCommentDeleted) {
+		return domain.ErrParentDeleted
 	}
+	if errors.Is(err, domain.ErrCommentNotFound) {
+		return domain.ErrInvalidParent
+	}
+	return err
+}
 
-	return &comment, nil
+// notFound возвращает ошибку для отсутствующего комментария id: ErrCommentDeleted,
+// если он был удален через Delete или DeleteReparent, иначе ErrCommentNotFound
+func (r *PostgresRepository) notFound(ctx context.Context, id int64) error {
+	var deleted bool
+	err := r.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM deleted_ids WHERE id = $1)`, id).Scan(&deleted)
+	if err != nil {
+		return fmt.Errorf("failed to check deleted comment: %w", err)
+	}
+	if deleted {
+		return domain.ErrCommentDeleted
+	}
+	return domain.ErrCommentNotFound
 }
 
-// GetTree получает дерево комментариев
-func (r *PostgresRepository) GetTree(parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error) {
-	var query string
-	var args []interface{}
+// querier общий интерфейс пула соединений и транзакции для запросов на чтение
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// readSnapshot выполняет fn в транзакции REPEATABLE READ только для чтения, чтобы все запросы
+// многошагового чтения видели один и тот же снимок данных, а не смесь до и после параллельной записи
+func (r *PostgresRepository) readSnapshot(ctx context.Context, fn func(q querier) error) error {
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 
+	return nil
+}
+
+// GetTree получает дерево комментариев.
+// Если указан parentID, возвращается поддерево этого комментария, см. getSubtree
+func (r *PostgresRepository) GetTree(ctx context.Context, parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error) {
 	sortBy := filter.SortBy
 	if sortBy != "created_at" && sortBy != "updated_at" {
 		sortBy = "created_at"
@@ -100,35 +282,31 @@ func (r *PostgresRepository) GetTree(parentID *int64, filter domain.CommentFilte
 		order = "desc"
 	}
 
-	if parentID == nil {
-		// Получаем ВСЕ комментарии (и корневые, и дочерние) для построения полного дерева
-		// Затем в коде отфильтруем корневые и применим пагинацию
-		query = `
-			SELECT id, parent_id, content, created_at, updated_at
-			FROM comments
-		`
-		args = []interface{}{}
-	} else {
-		query = fmt.Sprintf(`
-			WITH RECURSIVE comment_tree AS (
-				SELECT id, parent_id, content, created_at, updated_at
-				FROM comments
-				WHERE id = $1
-				
-				UNION ALL
-				
-				SELECT c.id, c.parent_id, c.content, c.created_at, c.updated_at
-				FROM comments c
-				INNER JOIN comment_tree ct ON c.parent_id = ct.id
-			)
-			SELECT id, parent_id, content, created_at, updated_at
-			FROM comment_tree
-			ORDER BY %s %s
-		`, sortBy, order)
-		args = []interface{}{*parentID}
+	if parentID != nil {
+		return r.getSubtree(ctx, *parentID, filter, sortBy, order)
 	}
 
-	rows, err := r.pool.Query(context.Background(), query, args...)
+	// Список корней и рейтинг hot читаются разными запросами, поэтому выполняются в одном снимке
+	var trees []domain.CommentTree
+	err := r.readSnapshot(ctx, func(q querier) error {
+		var err error
+		trees, err = r.getRootTrees(ctx, q, filter, sortBy, order)
+		return err
+	})
+	return trees, err
+}
+
+// getRootTrees получает страницу деревьев корневых комментариев
+func (r *PostgresRepository) getRootTrees(ctx context.Context, q querier, filter domain.CommentFilter, sortBy, order string) ([]domain.CommentTree, error) {
+	// Получаем ВСЕ комментарии (и корневые, и дочерние) для построения полного дерева
+	// Затем в коде отфильтруем корневые и применим пагинацию
+	query := `
+		SELECT ` + commentColumns + `
+		FROM comments
+		WHERE ` + notExpired + `
+	`
+
+	rows, err := q.Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get comment tree: %w", err)
 	}
@@ -138,27 +316,14 @@ func (r *PostgresRepository) GetTree(parentID *int64, filter domain.CommentFilte
 	var rootComments []*domain.Comment
 
 	for rows.Next() {
-		var comment domain.Comment
-		var parentID sql.NullInt64
-
-		err := rows.Scan(
-			&comment.ID,
-			&parentID,
-			&comment.Content,
-			&comment.CreatedAt,
-			&comment.UpdatedAt,
-		)
+		comment, err := scanComment(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan comment: %w", err)
 		}
 
-		if parentID.Valid {
-			comment.ParentID = &parentID.Int64
-		}
-
 		comments[comment.ID] = &comment
 
-		if comment.ParentID == nil {
+		if comment.ParentID == nil && createdAfter(&comment, filter.CreatedAfter) {
 			rootComments = append(rootComments, &comment)
 		}
 	}
@@ -167,58 +332,37 @@ func (r *PostgresRepository) GetTree(parentID *int64, filter domain.CommentFilte
 		return nil, fmt.Errorf("error iterating rows: %w", err)
 	}
 
-	// Сортируем корневые комментарии
-	sortedRoots := make([]*domain.Comment, len(rootComments))
-	copy(sortedRoots, rootComments)
-
-	// Сортировка корневых комментариев
-	if filter.SortBy == "created_at" {
-		if filter.Order == "desc" {
-			for i := 0; i < len(sortedRoots)-1; i++ {
-				for j := i + 1; j < len(sortedRoots); j++ {
-					if sortedRoots[i].CreatedAt.Before(sortedRoots[j].CreatedAt) {
-						sortedRoots[i], sortedRoots[j] = sortedRoots[j], sortedRoots[i]
-					}
-				}
-			}
-		} else {
-			for i := 0; i < len(sortedRoots)-1; i++ {
-				for j := i + 1; j < len(sortedRoots); j++ {
-					if sortedRoots[i].CreatedAt.After(sortedRoots[j].CreatedAt) {
-						sortedRoots[i], sortedRoots[j] = sortedRoots[j], sortedRoots[i]
-					}
-				}
-			}
+	var sortedRoots []*domain.Comment
+	if filter.SortBy == domain.SortHot {
+		// Рейтинг зависит от числа ответов, поэтому порядок и страница корней вычисляются в SQL
+		ids, err := r.hotRootIDs(ctx, q, filter, order)
+		if err != nil {
+			return nil, err
 		}
-	} else if filter.SortBy == "updated_at" {
-		if filter.Order == "desc" {
-			for i := 0; i < len(sortedRoots)-1; i++ {
-				for j := i + 1; j < len(sortedRoots); j++ {
-					if sortedRoots[i].UpdatedAt.Before(sortedRoots[j].UpdatedAt) {
-						sortedRoots[i], sortedRoots[j] = sortedRoots[j], sortedRoots[i]
-					}
-				}
-			}
-		} else {
-			for i := 0; i < len(sortedRoots)-1; i++ {
-				for j := i + 1; j < len(sortedRoots); j++ {
-					if sortedRoots[i].UpdatedAt.After(sortedRoots[j].UpdatedAt) {
-						sortedRoots[i], sortedRoots[j] = sortedRoots[j], sortedRoots[i]
-					}
-				}
+		for _, id := range ids {
+			if root, ok := comments[id]; ok {
+				sortedRoots = append(sortedRoots, root)
 			}
 		}
-	}
-
-	// Применяем пагинацию к корневым комментариям
-	start := (filter.Page - 1) * filter.PageSize
-	end := start + filter.PageSize
-	if start >= len(sortedRoots) {
-		sortedRoots = []*domain.Comment{}
-	} else if end > len(sortedRoots) {
-		sortedRoots = sortedRoots[start:]
 	} else {
-		sortedRoots = sortedRoots[start:end]
+		// Сортируем корневые комментарии; при равных метках порядок задает ID,
+		// как и при вычислении позиции в Locate
+		sortedRoots = make([]*domain.Comment, len(rootComments))
+		copy(sortedRoots, rootComments)
+		sort.SliceStable(sortedRoots, func(i, j int) bool {
+			return commentBefore(sortedRoots[i], sortedRoots[j], sortBy, order)
+		})
+
+		// Применяем пагинацию к корневым комментариям
+		start := (filter.Page - 1) * filter.PageSize
+		end := start + filter.PageSize
+		if start >= len(sortedRoots) {
+			sortedRoots = []*domain.Comment{}
+		} else if end > len(sortedRoots) {
+			sortedRoots = sortedRoots[start:]
+		} else {
+			sortedRoots = sortedRoots[start:end]
+		}
 	}
 
 	// Строим дерево для каждого корневого комментария
@@ -231,344 +375,1483 @@ func (r *PostgresRepository) GetTree(parentID *int64, filter domain.CommentFilte
 	return trees, nil
 }
 
-// buildTree строит дерево комментариев рекурсивно
-func (r *PostgresRepository) buildTree(comment *domain.Comment, allComments map[int64]*domain.Comment) domain.CommentTree {
-	tree := domain.CommentTree{
-		Comment:  *comment,
-		Children: make([]domain.CommentTree, 0),
-	}
+// defaultHotDecay период затухания рейтинга hot, если он не задан в фильтре
+const defaultHotDecay = 24 * time.Hour
 
-	for _, c := range allComments {
-		if c.ParentID != nil && *c.ParentID == comment.ID {
-			childTree := r.buildTree(c, allComments)
-			tree.Children = append(tree.Children, childTree)
-		}
+// hotRootIDs возвращает ID корневых комментариев страницы, упорядоченных по рейтингу hot:
+// ln(число ответов в ветке + 1) - возраст в часах / период затухания в часах.
+// Текущее время передается параметром, так как created_at хранится без часового пояса
+func (r *PostgresRepository) hotRootIDs(ctx context.Context, q querier, filter domain.CommentFilter, order string) ([]int64, error) {
+	decay := filter.HotDecay
+	if decay <= 0 {
+		decay = defaultHotDecay
 	}
 
-	return tree
-}
+	args := []interface{}{time.Now(), decay.Hours(), filter.PageSize, (filter.Page - 1) * filter.PageSize}
+	rootCondition := ""
+	if filter.CreatedAfter != nil {
+		args = append(args, *filter.CreatedAfter)
+		rootCondition = " AND created_at >= $5"
+	}
 
-// Delete удаляет комментарий и все вложенные комментарии
-func (r *PostgresRepository) Delete(id int64) error {
-	query := `
-		WITH RECURSIVE comment_tree AS (
-			SELECT id
+	query := fmt.Sprintf(`
+		WITH RECURSIVE thread AS (
+			SELECT id AS root_id, id
 			FROM comments
-			WHERE id = $1
+			WHERE parent_id IS NULL AND %[1]s%[2]s
 			
 			UNION ALL
 			
-			SELECT c.id
+			SELECT t.root_id, c.id
 			FROM comments c
-			INNER JOIN comment_tree ct ON c.parent_id = ct.id
+			INNER JOIN thread t ON c.parent_id = t.id
+			WHERE %[3]s
+		),
+		replies AS (
+			SELECT root_id, COUNT(*) - 1 AS reply_count
+			FROM thread
+			GROUP BY root_id
 		)
-		DELETE FROM comments
-		WHERE id IN (SELECT id FROM comment_tree)
-	`
-
-	_, err := r.pool.Exec(context.Background(), query, id)
+		SELECT c.id
+		FROM comments c
+		INNER JOIN replies rp ON rp.root_id = c.id
+		ORDER BY LN(rp.reply_count + 1) - EXTRACT(EPOCH FROM ($1::timestamp - c.created_at)) / 3600 / $2 %[4]s, c.client_ref COLLATE "C" %[4]s, c.id %[4]s
+		LIMIT $3 OFFSET $4
+	`, notExpired, rootCondition, notExpiredAs("c"), order)
+
+	rows, err := q.Query(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("failed to delete comment: %w", err)
+		return nil, fmt.Errorf("failed to rank comments: %w", err)
 	}
+	defer rows.Close()
 
-	return nil
-}
-
-// Search выполняет полнотекстовый поиск по комментариям
-func (r *PostgresRepository) Search(query string, filter domain.CommentFilter) ([]domain.CommentTree, error) {
-	sortBy := filter.SortBy
-	if sortBy != "created_at" && sortBy != "updated_at" {
-		sortBy = "created_at"
+	ids := make([]int64, 0, filter.PageSize)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan comment id: %w", err)
+		}
+		ids = append(ids, id)
 	}
-	order := filter.Order
-	if order != "asc" && order != "desc" {
-		order = "desc"
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
 	}
 
-	searchPattern := "%" + query + "%"
+	return ids, nil
+}
 
-	// Находим все комментарии, содержащие поисковый запрос
-	searchQuery := `
-		SELECT id, parent_id, content, created_at, updated_at
-		FROM comments
-		WHERE content ILIKE $1
-	`
+// getSubtree получает поддерево комментария parentID, в котором пагинация применяется
+// к его прямым ответам: выбирается одна страница ответов первого уровня (в порядке сортировки)
+// вместе со всеми их потомками. Если комментария нет, возвращается пустой список
+func (r *PostgresRepository) getSubtree(ctx context.Context, parentID int64, filter domain.CommentFilter, sortBy, order string) ([]domain.CommentTree, error) {
+	offset := (filter.Page - 1) * filter.PageSize
+	args := []interface{}{parentID, filter.PageSize, offset}
+
+	// CreatedAfter отбирает прямые ответы страницы, их собственные ответы возвращаются целиком
+	childrenConditions := notExpired
+	if filter.CreatedAfter != nil {
+		args = append(args, *filter.CreatedAfter)
+		childrenConditions += ` AND created_at >= $4`
+	}
 
-	searchRows, err := r.pool.Query(context.Background(), searchQuery, searchPattern)
+	query := fmt.Sprintf(`
+		WITH RECURSIVE page_children AS (
+			SELECT id
+			FROM comments
+			WHERE parent_id = $1 AND %s
+			ORDER BY %s %s, client_ref COLLATE "C" %s, id %s
+			LIMIT $2 OFFSET $3
+		),
+		subtree AS (
+			SELECT `+commentColumnsAs("c")+`
+			FROM comments c
+			INNER JOIN page_children pc ON pc.id = c.id
+			
+			UNION ALL
+			
+			SELECT `+commentColumnsAs("c")+`
+			FROM comments c
+			INNER JOIN subtree s ON c.parent_id = s.id
+			WHERE %s
+		)
+		SELECT `+commentColumns+`
+		FROM comments
+		WHERE id = $1 AND %s
+		
+		UNION ALL
+		
+		SELECT `+commentColumns+`
+		FROM subtree
+	`, childrenConditions, sortBy, order, order, order, notExpiredAs("c"), notExpired)
+
+	rows, err := r.pool.Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search comments: %w", err)
+		return nil, fmt.Errorf("failed to get comment subtree: %w", err)
 	}
-	defer searchRows.Close()
-
-	// Собираем ID найденных комментариев и их корневых родителей
-	foundCommentIDs := make(map[int64]bool)
-	rootIDs := make(map[int64]bool)
-
-	for searchRows.Next() {
-		var comment domain.Comment
-		var parentID sql.NullInt64
+	defer rows.Close()
 
-		err := searchRows.Scan(
-			&comment.ID,
-			&parentID,
-			&comment.Content,
-			&comment.CreatedAt,
-			&comment.UpdatedAt,
-		)
+	comments := make(map[int64]*domain.Comment)
+	for rows.Next() {
+		comment, err := scanComment(rows)
 		if err != nil {
-			continue
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
 		}
 
-		foundCommentIDs[comment.ID] = true
-
-		// Находим корневой комментарий для каждого найденного
-		rootID := comment.ID
-		if parentID.Valid {
-			rootID = r.findRootComment(comment.ID)
-		}
-		rootIDs[rootID] = true
+		comments[comment.ID] = &comment
 	}
 
-	if len(rootIDs) == 0 {
-		return []domain.CommentTree{}, nil
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
 	}
 
-	// Получаем все комментарии для построения полного дерева
-	allCommentsQuery := `SELECT id, parent_id, content, created_at, updated_at FROM comments`
-	allRows, err := r.pool.Query(context.Background(), allCommentsQuery)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get all comments: %w", err)
+	root, ok := comments[parentID]
+	if !ok {
+		return []domain.CommentTree{}, nil
 	}
-	defer allRows.Close()
-
-	allComments := make(map[int64]*domain.Comment)
-	var rootComments []*domain.Comment
 
-	for allRows.Next() {
-		var comment domain.Comment
-		var parentID sql.NullInt64
+	tree := r.buildTree(root, comments)
+	sortTrees(tree.Children, sortBy, order)
 
-		err := allRows.Scan(
-			&comment.ID,
-			&parentID,
-			&comment.Content,
-			&comment.CreatedAt,
-			&comment.UpdatedAt,
-		)
-		if err != nil {
-			continue
-		}
+	return []domain.CommentTree{tree}, nil
+}
 
-		if parentID.Valid {
-			comment.ParentID = &parentID.Int64
-		}
+// sortTrees сортирует деревья по полю корневого комментария, при равенстве - по ID
+func sortTrees(trees []domain.CommentTree, sortBy, order string) {
+	sort.SliceStable(trees, func(i, j int) bool {
+		return commentBefore(&trees[i].Comment, &trees[j].Comment, sortBy, order)
+	})
+}
 
-		allComments[comment.ID] = &comment
+// commentBefore сообщает, идет ли комментарий a раньше b при сортировке по полю sortBy,
+// при равенстве - по client_ref (побайтово, как COLLATE "C" в SQL), затем по ID
+func commentBefore(a, b *domain.Comment, sortBy, order string) bool {
+	ta, tb := a.CreatedAt, b.CreatedAt
+	if sortBy == "updated_at" {
+		ta, tb = a.UpdatedAt, b.UpdatedAt
+	}
 
-		// Добавляем только корневые комментарии, которые есть в результатах поиска
-		if comment.ParentID == nil && rootIDs[comment.ID] {
-			rootComments = append(rootComments, &comment)
+	if !ta.Equal(tb) {
+		if order == "asc" {
+			return ta.Before(tb)
 		}
+		return ta.After(tb)
 	}
 
-	// Сортируем корневые комментарии
-	sortedRoots := make([]*domain.Comment, len(rootComments))
-	copy(sortedRoots, rootComments)
-
-	if sortBy == "created_at" {
-		if order == "desc" {
-			for i := 0; i < len(sortedRoots)-1; i++ {
-				for j := i + 1; j < len(sortedRoots); j++ {
-					if sortedRoots[i].CreatedAt.Before(sortedRoots[j].CreatedAt) {
-						sortedRoots[i], sortedRoots[j] = sortedRoots[j], sortedRoots[i]
-					}
-				}
-			}
-		} else {
-			for i := 0; i < len(sortedRoots)-1; i++ {
-				for j := i + 1; j < len(sortedRoots); j++ {
-					if sortedRoots[i].CreatedAt.After(sortedRoots[j].CreatedAt) {
-						sortedRoots[i], sortedRoots[j] = sortedRoots[j], sortedRoots[i]
-					}
-				}
-			}
-		}
-	} else if sortBy == "updated_at" {
-		if order == "desc" {
-			for i := 0; i < len(sortedRoots)-1; i++ {
-				for j := i + 1; j < len(sortedRoots); j++ {
-					if sortedRoots[i].UpdatedAt.Before(sortedRoots[j].UpdatedAt) {
-						sortedRoots[i], sortedRoots[j] = sortedRoots[j], sortedRoots[i]
-					}
-				}
-			}
-		} else {
-			for i := 0; i < len(sortedRoots)-1; i++ {
-				for j := i + 1; j < len(sortedRoots); j++ {
-					if sortedRoots[i].UpdatedAt.After(sortedRoots[j].UpdatedAt) {
-						sortedRoots[i], sortedRoots[j] = sortedRoots[j], sortedRoots[i]
-					}
-				}
-			}
+	if a.ClientRef != b.ClientRef {
+		if order == "asc" {
+			return a.ClientRef < b.ClientRef
 		}
+		return a.ClientRef > b.ClientRef
 	}
 
-	// Применяем пагинацию
-	start := (filter.Page - 1) * filter.PageSize
-	end := start + filter.PageSize
-	if start >= len(sortedRoots) {
-		sortedRoots = []*domain.Comment{}
-	} else if end > len(sortedRoots) {
-		sortedRoots = sortedRoots[start:]
-	} else {
-		sortedRoots = sortedRoots[start:end]
+	if order == "asc" {
+		return a.ID < b.ID
 	}
+	return a.ID > b.ID
+}
 
-	// Строим дерево для каждого корневого комментария
-	trees := make([]domain.CommentTree, 0)
-	for _, root := range sortedRoots {
-		fullTree := r.buildTree(root, allComments)
-		trees = append(trees, fullTree)
-	}
+// notExpired условие, исключающее из выборки комментарии с истекшим сроком жизни
+const notExpired = `(expires_at IS NULL OR expires_at > NOW())`
 
-	return trees, nil
+// notExpiredAs возвращает условие notExpired для таблицы comments с псевдонимом alias
+func notExpiredAs(alias string) string {
+	return fmt.Sprintf("(%[1]s.expires_at IS NULL OR %[1]s.expires_at > NOW())", alias)
 }
 
-// findRootComment находит корневой комментарий для данного комментария
-func (r *PostgresRepository) findRootComment(commentID int64) int64 {
-	query := `
-		WITH RECURSIVE comment_path AS (
-			SELECT id, parent_id
-			FROM comments
-			WHERE id = $1
-			
-			UNION ALL
-			
-			SELECT c.id, c.parent_id
-			FROM comments c
-			INNER JOIN comment_path cp ON c.id = cp.parent_id
-		)
-		SELECT id FROM comment_path WHERE parent_id IS NULL LIMIT 1
-	`
+// commentColumns столбцы comments, которые читает scanComment, в том же порядке
+const commentColumns = `id, parent_id, content, created_at, updated_at, accepted, expires_at, slug, client_ref, content_hash, view_count, children_collapsed`
 
-	var rootID int64
-	err := r.pool.QueryRow(context.Background(), query, commentID).Scan(&rootID)
-	if err != nil {
-		// Если не удалось найти корневой, возвращаем сам ID
-		return commentID
+// commentColumnsAs возвращает список commentColumns для таблицы comments с псевдонимом alias
+func commentColumnsAs(alias string) string {
+	columns := strings.Split(commentColumns, ", ")
+	for i := range columns {
+		columns[i] = alias + "." + columns[i]
 	}
-
-	return rootID
+	return strings.Join(columns, ", ")
 }
 
-// getFullTree получает полное дерево комментария
-func (r *PostgresRepository) getFullTree(rootID int64) domain.CommentTree {
-	query := `
-		WITH RECURSIVE comment_tree AS (
-			SELECT id, parent_id, content, created_at, updated_at
-			FROM comments
-			WHERE id = $1
-			
-			UNION ALL
-			
-			SELECT c.id, c.parent_id, c.content, c.created_at, c.updated_at
+// scanComment читает из row столбцы commentColumns и следующие за ними значения extra
+func scanComment(row pgx.Row, extra ...interface{}) (domain.Comment, error) {
+	var comment domain.Comment
+	var parentID sql.NullInt64
+
+	dest := append([]interface{}{
+		&comment.ID,
+		&parentID,
+		&comment.Content,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+		&comment.Accepted,
+		&comment.ExpiresAt,
+		&comment.Slug,
+		&comment.ClientRef,
+		&comment.ContentHash,
+		&comment.ViewCount,
+		&comment.ChildrenCollapsed,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return domain.Comment{}, err
+	}
+
+	if parentID.Valid {
+		comment.ParentID = &parentID.Int64
+	}
+	return comment, nil
+}
+
+// createdAfter сообщает, создан ли комментарий не раньше момента after (nil - без ограничения)
+func createdAfter(comment *domain.Comment, after *time.Time) bool {
+	return after == nil || !comment.CreatedAt.Before(*after)
+}
+
+// buildTree строит дерево комментариев рекурсивно.
+// Ответы каждого уровня упорядочены от старых к новым, чтобы порядок не зависел от обхода map
+func (r *PostgresRepository) buildTree(comment *domain.Comment, allComments map[int64]*domain.Comment) domain.CommentTree {
+	tree := domain.CommentTree{
+		Comment:  *comment,
+		Children: make([]domain.CommentTree, 0),
+	}
+
+	for _, c := range allComments {
+		if c.ParentID != nil && *c.ParentID == comment.ID {
+			childTree := r.buildTree(c, allComments)
+			tree.Children = append(tree.Children, childTree)
+		}
+	}
+	sortTrees(tree.Children, "created_at", "asc")
+
+	return tree
+}
+
+// Delete удаляет комментарий и все вложенные комментарии, запоминая их ID в deleted_ids
+func (r *PostgresRepository) Delete(ctx context.Context, id int64) error {
+	query := `
+		WITH RECURSIVE comment_tree AS (
+			SELECT id
+			FROM comments
+			WHERE id = $1
+			
+			UNION ALL
+			
+			SELECT c.id
 			FROM comments c
 			INNER JOIN comment_tree ct ON c.parent_id = ct.id
+		),
+		deleted AS (
+			DELETE FROM comments
+			WHERE id IN (SELECT id FROM comment_tree)
+			RETURNING id
 		)
-		SELECT id, parent_id, content, created_at, updated_at
-		FROM comment_tree
+		INSERT INTO deleted_ids (id)
+		SELECT id FROM deleted
+		ON CONFLICT (id) DO NOTHING
+	`
+
+	_, err := r.pool.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteReparent удаляет только комментарий id, а его прямые ответы переподвешивает к его родителю
+// (ответы корневого комментария становятся корневыми). Ответы переходят к предку удаляемого
+// комментария, поэтому цикл возникнуть не может. Становясь корневыми, ответы теряют отметку
+// принятого ответа, так как корневой комментарий принятым быть не может
+func (r *PostgresRepository) DeleteReparent(ctx context.Context, id int64) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var parentID *int64
+	err = tx.QueryRow(ctx, `SELECT parent_id FROM comments WHERE id = $1 FOR UPDATE`, id).Scan(&parentID)
+	if err == pgx.ErrNoRows {
+		return r.notFound(ctx, id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock comment: %w", err)
+	}
+
+	reparentQuery := `
+		UPDATE comments
+		SET parent_id = $2, accepted = accepted AND $2::bigint IS NOT NULL
+		WHERE parent_id = $1
 	`
+	if _, err := tx.Exec(ctx, reparentQuery, id, parentID); err != nil {
+		return fmt.Errorf("failed to reparent replies: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM comments WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `INSERT INTO deleted_ids (id) VALUES ($1) ON CONFLICT (id) DO NOTHING`, id); err != nil {
+		return fmt.Errorf("failed to record deleted comment: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Search выполняет полнотекстовый поиск по комментариям и возвращает ветки, содержащие совпадения.
+// Рассматривается не больше filter.MaxSearchResults веток (первые в порядке сортировки);
+// второе значение сообщает, что веток с совпадениями больше и результат обрезан
+func (r *PostgresRepository) Search(ctx context.Context, query string, filter domain.CommentFilter) ([]domain.CommentTree, bool, error) {
+	trees := make([]domain.CommentTree, 0)
+	truncated, err := r.SearchStream(ctx, query, filter, func(tree domain.CommentTree) error {
+		trees = append(trees, tree)
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return trees, truncated, nil
+}
+
+// SearchStream выполняет тот же поиск, что и Search, но передает ветки в yield по одной в порядке
+// сортировки, как только ветка прочитана, не дожидаясь остальных. Ошибка yield прерывает поиск
+// и возвращается как есть. Корни и их ветки читаются разными запросами в одном снимке REPEATABLE READ;
+// отмена ctx (таймаут запроса или отключение клиента) прерывает запрос и откатывает транзакцию
+func (r *PostgresRepository) SearchStream(ctx context.Context, query string, filter domain.CommentFilter, yield func(domain.CommentTree) error) (bool, error) {
+	var truncated bool
+	err := r.readSnapshot(ctx, func(q querier) error {
+		var err error
+		truncated, err = r.search(ctx, q, query, filter, yield)
+		return err
+	})
+	return truncated, err
+}
+
+// search выполняет запросы SearchStream через q
+func (r *PostgresRepository) search(ctx context.Context, q querier, query string, filter domain.CommentFilter, yield func(domain.CommentTree) error) (bool, error) {
+	sortBy := filter.SortBy
+	if sortBy != "created_at" && sortBy != "updated_at" {
+		sortBy = "created_at"
+	}
+	order := filter.Order
+	if order != "asc" && order != "desc" {
+		order = "desc"
+	}
 
-	rows, err := r.pool.Query(context.Background(), query, rootID)
+	// Находим корни веток с совпадениями; лимит на одну ветку больше, чтобы заметить обрезку
+	pathQuery, rootsArgs := searchPath(query, filter)
+	limitClause := ""
+	if filter.MaxSearchResults > 0 {
+		rootsArgs = append(rootsArgs, filter.MaxSearchResults+1)
+		limitClause = fmt.Sprintf("LIMIT $%d", len(rootsArgs))
+	}
+
+	rootsQuery := fmt.Sprintf(`
+		%[1]s
+		SELECT c.id
+		FROM comments c
+		WHERE c.id IN (SELECT id FROM comment_path WHERE parent_id IS NULL)
+		ORDER BY c.%[2]s %[3]s, c.client_ref COLLATE "C" %[3]s, c.id %[3]s
+		%[4]s
+	`, pathQuery, sortBy, order, limitClause)
+
+	rootRows, err := q.Query(ctx, rootsQuery, rootsArgs...)
 	if err != nil {
-		// Если ошибка, возвращаем только корневой комментарий
-		comment, _ := r.GetByID(rootID)
-		if comment != nil {
-			return domain.CommentTree{Comment: *comment}
+		return false, fmt.Errorf("failed to search comments: %w", err)
+	}
+	defer rootRows.Close()
+
+	var rootIDs []int64
+	for rootRows.Next() {
+		var id int64
+		if err := rootRows.Scan(&id); err != nil {
+			return false, fmt.Errorf("failed to scan comment id: %w", err)
 		}
-		return domain.CommentTree{}
+		rootIDs = append(rootIDs, id)
+	}
+
+	if err = rootRows.Err(); err != nil {
+		return false, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	truncated := filter.MaxSearchResults > 0 && len(rootIDs) > filter.MaxSearchResults
+	if truncated {
+		rootIDs = rootIDs[:filter.MaxSearchResults]
+	}
+
+	// Применяем пагинацию к уже отсортированным корням
+	start := (filter.Page - 1) * filter.PageSize
+	end := start + filter.PageSize
+	if start >= len(rootIDs) {
+		return truncated, nil
+	}
+	if end > len(rootIDs) {
+		end = len(rootIDs)
+	}
+	rootIDs = rootIDs[start:end]
+
+	// Загружаем только ветки страницы, сгруппированные по корню в порядке сортировки,
+	// чтобы отдавать каждую ветку, как только прочитаны все ее комментарии.
+	// matched отмечает сами совпадения, чтобы клиент мог их подсветить
+	threadsArgs := []interface{}{rootIDs, "%" + query + "%"}
+	matchExpr := "content ILIKE $2"
+	if filter.CreatedAfter != nil {
+		threadsArgs = append(threadsArgs, *filter.CreatedAfter)
+		matchExpr += " AND created_at >= $3"
+	}
+	threadsQuery := `
+		WITH RECURSIVE thread AS (
+			SELECT ` + commentColumns + `, id AS root_id
+			FROM comments
+			WHERE id = ANY($1)
+			
+			UNION ALL
+			
+			SELECT ` + commentColumnsAs("c") + `, t.root_id
+			FROM comments c
+			INNER JOIN thread t ON c.parent_id = t.id
+			WHERE ` + notExpiredAs("c") + `
+		)
+		SELECT ` + commentColumns + `, root_id,
+			` + matchExpr + `
+		FROM thread
+		ORDER BY array_position($1::bigint[], root_id)
+	`
+
+	rows, err := q.Query(ctx, threadsQuery, threadsArgs...)
+	if err != nil {
+		return false, fmt.Errorf("failed to get comment threads: %w", err)
 	}
 	defer rows.Close()
 
 	comments := make(map[int64]*domain.Comment)
-	var rootComment *domain.Comment
+	matched := make(map[int64]bool)
+	var currentRoot int64
+	// flush строит ветку текущего корня, передает ее в yield и освобождает ее комментарии
+	flush := func() error {
+		root, ok := comments[currentRoot]
+		if !ok {
+			return nil
+		}
+		tree := r.buildTree(root, comments)
+		markMatched(&tree, matched)
+		comments = make(map[int64]*domain.Comment)
+		matched = make(map[int64]bool)
+		return yield(tree)
+	}
 
 	for rows.Next() {
-		var comment domain.Comment
-		var parentID sql.NullInt64
-
-		err := rows.Scan(
-			&comment.ID,
-			&parentID,
-			&comment.Content,
-			&comment.CreatedAt,
-			&comment.UpdatedAt,
-		)
+		var rootID int64
+		var isMatch bool
+
+		comment, err := scanComment(rows, &rootID, &isMatch)
 		if err != nil {
-			continue
+			return false, fmt.Errorf("failed to scan comment: %w", err)
 		}
 
-		if parentID.Valid {
-			comment.ParentID = &parentID.Int64
+		if rootID != currentRoot {
+			if err := flush(); err != nil {
+				return false, err
+			}
+			currentRoot = rootID
 		}
-
 		comments[comment.ID] = &comment
-
-		if comment.ParentID == nil {
-			rootComment = &comment
+		if isMatch {
+			matched[comment.ID] = true
 		}
 	}
 
-	if rootComment == nil {
-		return domain.CommentTree{}
+	if err = rows.Err(); err != nil {
+		return false, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	if err := flush(); err != nil {
+		return false, err
+	}
+
+	return truncated, nil
+}
+
+// markMatched выставляет Matched у узлов дерева, ID которых есть в matched
+func markMatched(tree *domain.CommentTree, matched map[int64]bool) {
+	tree.Matched = matched[tree.Comment.ID]
+	for i := range tree.Children {
+		markMatched(&tree.Children[i], matched)
+	}
+}
+
+// searchPath возвращает начало запроса WITH RECURSIVE с CTE comment_path: комментарии, совпавшие
+// с query (с учетом filter.CreatedAfter), и все их предки. Корни найденных веток - строки с parent_id IS NULL
+func searchPath(query string, filter domain.CommentFilter) (string, []interface{}) {
+	args := []interface{}{"%" + query + "%"}
+	matchCondition := ""
+	if filter.CreatedAfter != nil {
+		args = append(args, *filter.CreatedAfter)
+		matchCondition = fmt.Sprintf(" AND created_at >= $%d", len(args))
 	}
 
-	return r.buildTree(rootComment, comments)
+	return fmt.Sprintf(`
+		WITH RECURSIVE matches AS (
+			SELECT id, parent_id
+			FROM comments
+			WHERE content ILIKE $1 AND %s%s
+		),
+		comment_path AS (
+			SELECT id, parent_id
+			FROM matches
+			
+			UNION
+			
+			SELECT c.id, c.parent_id
+			FROM comments c
+			INNER JOIN comment_path cp ON c.id = cp.parent_id
+		)`, notExpired, matchCondition), args
 }
 
-// Count возвращает количество комментариев
-func (r *PostgresRepository) Count(parentID *int64, search string) (int, error) {
+// Count возвращает общее количество элементов выдачи для фильтра, по которому считается пагинация:
+// комментарии ленты, корни веток (в том числе найденных поиском) или прямые ответы поддерева
+func (r *PostgresRepository) Count(ctx context.Context, filter domain.CommentFilter) (int, error) {
 	var query string
 	var args []interface{}
 
-	if search != "" {
-		query = `
-			SELECT COUNT(DISTINCT id)
-			FROM comments
-			WHERE content ILIKE $1
+	parentID := filter.ParentID
+
+	if filter.View == domain.ViewTimeline {
+		query, args = timelineConditions(`SELECT COUNT(*) FROM comments`, filter)
+	} else if filter.Search != "" {
+		// Поиск выдает страницы веток, поэтому считаются корни веток с совпадениями, а не сами совпадения
+		query, args = searchPath(filter.Search, filter)
+		query += `
+			SELECT COUNT(*)
+			FROM comment_path
+			WHERE parent_id IS NULL
 		`
-		args = []interface{}{"%" + search + "%"}
 	} else if parentID == nil {
 		query = `
 			SELECT COUNT(*)
 			FROM comments
-			WHERE parent_id IS NULL
+			WHERE parent_id IS NULL AND ` + notExpired + `
 		`
 		args = []interface{}{}
+		if filter.CreatedAfter != nil {
+			query += ` AND created_at >= $1`
+			args = append(args, *filter.CreatedAfter)
+		}
 	} else {
+		// Для поддерева пагинация идет по прямым ответам, поэтому считаем только их
 		query = `
-			WITH RECURSIVE comment_tree AS (
-				SELECT id
-				FROM comments
-				WHERE id = $1
-				
-				UNION ALL
-				
-				SELECT c.id
-				FROM comments c
-				INNER JOIN comment_tree ct ON c.parent_id = ct.id
-			)
 			SELECT COUNT(*)
-			FROM comment_tree
+			FROM comments
+			WHERE parent_id = $1 AND ` + notExpired + `
 		`
 		args = []interface{}{*parentID}
+		if filter.CreatedAfter != nil {
+			query += ` AND created_at >= $2`
+			args = append(args, *filter.CreatedAfter)
+		}
 	}
 
 	var count int
-	err := r.pool.QueryRow(context.Background(), query, args...).Scan(&count)
+	err := r.pool.QueryRow(ctx, query, args...).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count comments: %w", err)
 	}
 
+	// Поиск рассматривает не больше MaxSearchResults веток, страниц за этой границей нет
+	if filter.Search != "" && filter.View != domain.ViewTimeline && filter.MaxSearchResults > 0 && count > filter.MaxSearchResults {
+		count = filter.MaxSearchResults
+	}
+
 	return count, nil
 }
+
+// GetRecent получает последние комментарии любой вложенности вместе с ID их корневых комментариев
+func (r *PostgresRepository) GetRecent(ctx context.Context, limit int) ([]domain.RecentComment, error) {
+	query := `
+		WITH RECURSIVE recent AS (
+			SELECT ` + commentColumns + `
+			FROM comments
+			WHERE ` + notExpired + `
+			ORDER BY created_at DESC, id DESC
+			LIMIT $1
+		),
+		comment_path AS (
+			SELECT id AS comment_id, id, parent_id
+			FROM recent
+			
+			UNION ALL
+			
+			SELECT cp.comment_id, c.id, c.parent_id
+			FROM comments c
+			INNER JOIN comment_path cp ON c.id = cp.parent_id
+		)
+		SELECT ` + commentColumnsAs("r") + `, cp.id
+		FROM recent r
+		INNER JOIN comment_path cp ON cp.comment_id = r.id AND cp.parent_id IS NULL
+		ORDER BY r.created_at DESC, r.id DESC
+	`
+
+	rows, err := r.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent comments: %w", err)
+	}
+	defer rows.Close()
+
+	recent := make([]domain.RecentComment, 0, limit)
+	for rows.Next() {
+		var item domain.RecentComment
+
+		comment, err := scanComment(rows, &item.RootID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		item.Comment = comment
+
+		recent = append(recent, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return recent, nil
+}
+
+// GetAncestors получает предков комментария в порядке от корневого к непосредственному родителю
+func (r *PostgresRepository) GetAncestors(ctx context.Context, id int64) ([]domain.Comment, error) {
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT ` + commentColumnsAs("c") + `, 1 AS distance
+			FROM comments c
+			INNER JOIN comments child ON child.parent_id = c.id
+			WHERE child.id = $1
+			
+			UNION ALL
+			
+			SELECT ` + commentColumnsAs("c") + `, a.distance + 1
+			FROM comments c
+			INNER JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT ` + commentColumns + `
+		FROM ancestors
+		ORDER BY distance DESC
+	`
+
+	rows, err := r.pool.Query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ancestors: %w", err)
+	}
+	defer rows.Close()
+
+	ancestors := make([]domain.Comment, 0)
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+
+		ancestors = append(ancestors, comment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return ancestors, nil
+}
+
+// GetPrevious получает ближайший предшествующий комментарий с тем же родителем (для корневого -
+// предыдущий корневой) по ключу (created_at, id). Если такого нет, возвращает nil без ошибки
+func (r *PostgresRepository) GetPrevious(ctx context.Context, id int64) (*domain.Comment, error) {
+	query := `
+		SELECT ` + commentColumnsAs("c") + `
+		FROM comments c
+		INNER JOIN comments cur ON cur.id = $1
+		WHERE c.parent_id IS NOT DISTINCT FROM cur.parent_id
+			AND (c.created_at, c.id) < (cur.created_at, cur.id)
+			AND ` + notExpiredAs("c") + `
+		ORDER BY c.created_at DESC, c.id DESC
+		LIMIT 1
+	`
+
+	comment, err := scanComment(r.pool.QueryRow(ctx, query, id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get previous comment: %w", err)
+	}
+
+	return &comment, nil
+}
+
+// GetReplies получает страницу прямых ответов parentID (корневых комментариев, если parentID == nil)
+// без их собственных ответов, от старых к новым в порядке commentBefore
+func (r *PostgresRepository) GetReplies(ctx context.Context, parentID *int64, limit, offset int) ([]domain.Comment, error) {
+	args := []interface{}{limit, offset}
+	parentCondition := "parent_id IS NULL"
+	if parentID != nil {
+		args = append(args, *parentID)
+		parentCondition = "parent_id = $3"
+	}
+
+	query := `
+		SELECT ` + commentColumns + `
+		FROM comments
+		WHERE ` + parentCondition + ` AND ` + notExpired + `
+		ORDER BY created_at ASC, client_ref COLLATE "C" ASC, id ASC
+		LIMIT $1 OFFSET $2
+	`
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replies: %w", err)
+	}
+	defer rows.Close()
+
+	comments := make([]domain.Comment, 0)
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+
+		comments = append(comments, comment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return comments, nil
+}
+
+// GetByMention получает комментарии, в которых упомянут пользователь, от новых к старым.
+// Имя сравнивается без учета регистра, в БД упоминания хранятся в написании автора комментария
+func (r *PostgresRepository) GetByMention(ctx context.Context, username string, limit, offset int) ([]domain.Comment, error) {
+	query := `
+		SELECT ` + commentColumnsAs("c") + `
+		FROM comments c
+		WHERE EXISTS (
+			SELECT 1
+			FROM comment_mentions m
+			WHERE m.comment_id = c.id AND LOWER(m.username) = $1
+		) AND ` + notExpiredAs("c") + `
+		ORDER BY c.created_at DESC, c.id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.pool.Query(ctx, query, strings.ToLower(username), limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mentions: %w", err)
+	}
+	defer rows.Close()
+
+	comments := make([]domain.Comment, 0)
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+
+		comments = append(comments, comment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return comments, nil
+}
+
+// GetByContentHash получает комментарии с указанным хешем текста, от новых к старым
+func (r *PostgresRepository) GetByContentHash(ctx context.Context, hash string, limit, offset int) ([]domain.Comment, error) {
+	query := `
+		SELECT ` + commentColumnsAs("c") + `
+		FROM comments c
+		WHERE c.content_hash = $1 AND ` + notExpiredAs("c") + `
+		ORDER BY c.created_at DESC, c.id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.pool.Query(ctx, query, hash, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comments by content hash: %w", err)
+	}
+	defer rows.Close()
+
+	comments := make([]domain.Comment, 0)
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+
+		comments = append(comments, comment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return comments, nil
+}
+
+// Accept отмечает ответ как принятый в его ветке и снимает отметку с ранее принятого ответа той же ветки.
+// Корневой комментарий ветки блокируется на время транзакции, поэтому параллельные вызовы
+// в одной ветке выполняются последовательно. updated_at не изменяется
+func (r *PostgresRepository) Accept(ctx context.Context, id int64) (*domain.Comment, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rootQuery := `
+		WITH RECURSIVE comment_path AS (
+			SELECT id, parent_id
+			FROM comments
+			WHERE id = $1
+			
+			UNION ALL
+			
+			SELECT c.id, c.parent_id
+			FROM comments c
+			INNER JOIN comment_path cp ON c.id = cp.parent_id
+		)
+		SELECT id FROM comment_path WHERE parent_id IS NULL LIMIT 1
+	`
+
+	var rootID int64
+	err = tx.QueryRow(ctx, rootQuery, id).Scan(&rootID)
+	if err == pgx.ErrNoRows {
+		return nil, r.notFound(ctx, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find root comment: %w", err)
+	}
+	if rootID == id {
+		return nil, domain.ErrCannotAcceptRoot
+	}
+
+	if _, err := tx.Exec(ctx, `SELECT id FROM comments WHERE id = $1 FOR UPDATE`, rootID); err != nil {
+		return nil, fmt.Errorf("failed to lock root comment: %w", err)
+	}
+
+	clearQuery := `
+		WITH RECURSIVE comment_tree AS (
+			SELECT id
+			FROM comments
+			WHERE id = $1
+			
+			UNION ALL
+			
+			SELECT c.id
+			FROM comments c
+			INNER JOIN comment_tree ct ON c.parent_id = ct.id
+		)
+		UPDATE comments
+		SET accepted = FALSE
+		WHERE accepted AND id <> $2 AND id IN (SELECT id FROM comment_tree)
+	`
+	if _, err := tx.Exec(ctx, clearQuery, rootID, id); err != nil {
+		return nil, fmt.Errorf("failed to clear accepted answer: %w", err)
+	}
+
+	acceptQuery := `
+		UPDATE comments
+		SET accepted = TRUE
+		WHERE id = $1 AND ` + notExpired + `
+		RETURNING ` + commentColumns + `
+	`
+
+	comment, err := scanComment(tx.QueryRow(ctx, acceptQuery, id))
+	if err == pgx.ErrNoRows {
+		return nil, domain.ErrCommentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept comment: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &comment, nil
+}
+
+// GetTimeline получает плоскую ленту комментариев любой вложенности с пагинацией по комментариям.
+// Для каждого комментария вычисляется глубина - число его предков
+func (r *PostgresRepository) GetTimeline(ctx context.Context, filter domain.CommentFilter) ([]domain.TimelineComment, error) {
+	sortBy := filter.SortBy
+	if sortBy != "created_at" && sortBy != "updated_at" {
+		sortBy = "created_at"
+	}
+	order := filter.Order
+	if order != "asc" && order != "desc" {
+		order = "desc"
+	}
+
+	pageQuery, args := timelineConditions(`
+		SELECT `+commentColumns+`
+		FROM comments`, filter)
+
+	limitArg := len(args) + 1
+	args = append(args, filter.PageSize, (filter.Page-1)*filter.PageSize)
+
+	query := fmt.Sprintf(`
+		WITH RECURSIVE page AS (
+			%s
+			ORDER BY %s %s, client_ref COLLATE "C" %s, id %s
+			LIMIT $%d OFFSET $%d
+		),
+		comment_path AS (
+			SELECT id AS comment_id, parent_id, 0 AS depth
+			FROM page
+			
+			UNION ALL
+			
+			SELECT cp.comment_id, c.parent_id, cp.depth + 1
+			FROM comments c
+			INNER JOIN comment_path cp ON c.id = cp.parent_id
+		)
+		SELECT `+commentColumnsAs("p")+`,
+			(SELECT MAX(cp.depth) FROM comment_path cp WHERE cp.comment_id = p.id)
+		FROM page p
+		ORDER BY p.%s %s, p.client_ref COLLATE "C" %s, p.id %s
+	`, pageQuery, sortBy, order, order, order, limitArg, limitArg+1, sortBy, order, order, order)
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comment timeline: %w", err)
+	}
+	defer rows.Close()
+
+	timeline := make([]domain.TimelineComment, 0, filter.PageSize)
+	for rows.Next() {
+		var item domain.TimelineComment
+
+		comment, err := scanComment(rows, &item.Depth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		item.Comment = comment
+
+		timeline = append(timeline, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return timeline, nil
+}
+
+// timelineConditions дополняет запрос по таблице comments условиями ленты (поиск, since)
+func timelineConditions(query string, filter domain.CommentFilter) (string, []interface{}) {
+	conditions := []string{notExpired}
+	var args []interface{}
+
+	if filter.Search != "" {
+		args = append(args, "%"+filter.Search+"%")
+		conditions = append(conditions, fmt.Sprintf("content ILIKE $%d", len(args)))
+	}
+	if filter.CreatedAfter != nil {
+		args = append(args, *filter.CreatedAfter)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+
+	query += " WHERE " + strings.Join(conditions, " AND ")
+
+	return query, args
+}
+
+// HasRecentDuplicate проверяет, есть ли комментарий с тем же текстом под тем же родителем, созданный не раньше since
+func (r *PostgresRepository) HasRecentDuplicate(ctx context.Context, parentID *int64, content string, since time.Time) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM comments
+			WHERE parent_id IS NOT DISTINCT FROM $1
+				AND content = $2
+				AND created_at >= $3
+				AND ` + notExpired + `
+		)
+	`
+
+	var exists bool
+	err := r.pool.QueryRow(ctx, query, parentID, content, since).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check duplicate comment: %w", err)
+	}
+
+	return exists, nil
+}
+
+// HasRecentSimilar проверяет, есть ли под тем же родителем комментарий, созданный не раньше since,
+// триграммное сходство текста которого с content больше threshold (требует расширения pg_trgm)
+func (r *PostgresRepository) HasRecentSimilar(ctx context.Context, parentID *int64, content string, since time.Time, threshold float64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM comments
+			WHERE parent_id IS NOT DISTINCT FROM $1
+				AND created_at >= $3
+				AND similarity(content, $2) > $4
+				AND ` + notExpired + `
+		)
+	`
+
+	var exists bool
+	err := r.pool.QueryRow(ctx, query, parentID, content, since, threshold).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check similar comment: %w", err)
+	}
+
+	return exists, nil
+}
+
+// DeleteExpired удаляет комментарии с истекшим сроком жизни вместе с ответами и возвращает
+// число удаленных комментариев с учетом ответов. ID удаленных запоминаются в deleted_ids,
+// как при Delete, чтобы обращения к ним получали ErrCommentDeleted, а ответы - ErrParentDeleted
+func (r *PostgresRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `
+		WITH RECURSIVE comment_tree AS (
+			SELECT id
+			FROM comments
+			WHERE expires_at <= NOW()
+			
+			UNION
+			
+			SELECT c.id
+			FROM comments c
+			INNER JOIN comment_tree ct ON c.parent_id = ct.id
+		),
+		deleted AS (
+			DELETE FROM comments
+			WHERE id IN (SELECT id FROM comment_tree)
+			RETURNING id
+		)
+		INSERT INTO deleted_ids (id)
+		SELECT id FROM deleted
+		ON CONFLICT (id) DO NOTHING
+	`
+
+	tag, err := r.pool.Exec(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired comments: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// SweepOrphans находит действующие ответы, родителя которых нет или срок жизни родителя истек:
+// построение дерева их молча отбрасывает. При fix такие ответы удаляются вместе со своими ответами,
+// а их ID запоминаются в deleted_ids, как при Delete. Возвращает число найденных (или удаленных)
+// ответов без учета их потомков
+func (r *PostgresRepository) SweepOrphans(ctx context.Context, fix bool) (int64, error) {
+	condition := `
+		WHERE c.parent_id IS NOT NULL
+			AND ` + notExpiredAs("c") + `
+			AND NOT EXISTS (
+				SELECT 1
+				FROM comments p
+				WHERE p.id = c.parent_id AND ` + notExpiredAs("p") + `
+			)
+	`
+
+	if fix {
+		query := `
+			WITH RECURSIVE orphans AS (
+				SELECT c.id
+				FROM comments c` + condition + `
+			),
+			comment_tree AS (
+				SELECT id FROM orphans
+				
+				UNION
+				
+				SELECT c.id
+				FROM comments c
+				INNER JOIN comment_tree ct ON c.parent_id = ct.id
+			),
+			deleted AS (
+				DELETE FROM comments
+				WHERE id IN (SELECT id FROM comment_tree)
+				RETURNING id
+			),
+			recorded AS (
+				INSERT INTO deleted_ids (id)
+				SELECT id FROM deleted
+				ON CONFLICT (id) DO NOTHING
+			)
+			SELECT COUNT(*) FROM orphans
+		`
+
+		var count int64
+		if err := r.pool.QueryRow(ctx, query).Scan(&count); err != nil {
+			return 0, fmt.Errorf("failed to delete orphan comments: %w", err)
+		}
+		return count, nil
+	}
+
+	var count int64
+	if err := r.pool.QueryRow(ctx, `SELECT COUNT(*) FROM comments c`+condition).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count orphan comments: %w", err)
+	}
+	return count, nil
+}
+
+// PruneDeletedIDs забывает ID, удаленные раньше чем retention назад, и возвращает их количество.
+// Срок отсчитывается по времени БД, которым заполняется deleted_ids.deleted_at
+func (r *PostgresRepository) PruneDeletedIDs(ctx context.Context, retention time.Duration) (int64, error) {
+	query := `
+		DELETE FROM deleted_ids
+		WHERE deleted_at < NOW() - make_interval(secs => $1)
+	`
+
+	tag, err := r.pool.Exec(ctx, query, retention.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune deleted ids: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// LastDeletedAt возвращает время последнего удаления комментария из deleted_ids
+// (нулевое время, если удалений не было)
+func (r *PostgresRepository) LastDeletedAt(ctx context.Context) (time.Time, error) {
+	var lastDeletedAt sql.NullTime
+	if err := r.pool.QueryRow(ctx, `SELECT MAX(deleted_at) FROM deleted_ids`).Scan(&lastDeletedAt); err != nil {
+		return time.Time{}, fmt.Errorf("failed to get last deletion time: %w", err)
+	}
+
+	return lastDeletedAt.Time, nil
+}
+
+// Locate находит корень ветки комментария и его позицию среди корневых комментариев
+// при сортировке из filter: позиция равна числу корней, которые идут раньше него.
+// Если комментария нет или его корень не попадает в выборку (since), возвращается ErrCommentNotFound
+// (ErrCommentDeleted для удаленного комментария)
+func (r *PostgresRepository) Locate(ctx context.Context, id int64, filter domain.CommentFilter) (*domain.CommentLocation, error) {
+	sortBy := filter.SortBy
+	if sortBy != "created_at" && sortBy != "updated_at" {
+		sortBy = "created_at"
+	}
+	cmp := ">"
+	if filter.Order == "asc" {
+		cmp = "<"
+	}
+
+	args := []interface{}{id}
+	rootCondition := ""
+	beforeCondition := ""
+	if filter.CreatedAfter != nil {
+		args = append(args, *filter.CreatedAfter)
+		rootCondition = " AND c.created_at >= $2"
+		beforeCondition = " AND c.created_at >= $2"
+	}
+
+	query := fmt.Sprintf(`
+		WITH RECURSIVE comment_path AS (
+			SELECT id, parent_id
+			FROM comments
+			WHERE id = $1 AND %[1]s
+			
+			UNION ALL
+			
+			SELECT c.id, c.parent_id
+			FROM comments c
+			INNER JOIN comment_path cp ON c.id = cp.parent_id
+		),
+		root AS (
+			SELECT c.id, c.created_at, c.updated_at, c.client_ref
+			FROM comments c
+			INNER JOIN comment_path cp ON cp.id = c.id
+			WHERE cp.parent_id IS NULL%[2]s
+		)
+		SELECT root.id, (
+			SELECT COUNT(*)
+			FROM comments c
+			WHERE c.parent_id IS NULL AND %[3]s%[4]s
+				AND (c.%[5]s, c.client_ref COLLATE "C", c.id) %[6]s (root.%[5]s, root.client_ref COLLATE "C", root.id)
+		)
+		FROM root
+	`, notExpired, rootCondition, notExpiredAs("c"), beforeCondition, sortBy, cmp)
+
+	var location domain.CommentLocation
+	err := r.pool.QueryRow(ctx, query, args...).Scan(&location.RootID, &location.Index)
+	if err == pgx.ErrNoRows {
+		return nil, r.notFound(ctx, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate comment: %w", err)
+	}
+
+	return &location, nil
+}
+
+// GetBySlug получает комментарий по slug постоянной ссылки
+func (r *PostgresRepository) GetBySlug(ctx context.Context, slug string) (*domain.Comment, error) {
+	query := `
+		SELECT ` + commentColumns + `
+		FROM comments
+		WHERE slug = $1 AND ` + notExpired + `
+	`
+
+	comment, err := scanComment(r.pool.QueryRow(ctx, query, slug))
+
+	if err == pgx.ErrNoRows {
+		return nil, domain.ErrCommentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comment by slug: %w", err)
+	}
+
+	return &comment, nil
+}
+
+// CountReplies одним запросом считает ответы любой вложенности для каждого из комментариев ids.
+// В результат попадают только существующие комментарии, включая комментарии без ответов
+func (r *PostgresRepository) CountReplies(ctx context.Context, ids []int64) (map[int64]int, error) {
+	query := `
+		WITH RECURSIVE thread AS (
+			SELECT id AS ancestor_id, id
+			FROM comments
+			WHERE id = ANY($1) AND ` + notExpired + `
+			
+			UNION ALL
+			
+			SELECT t.ancestor_id, c.id
+			FROM comments c
+			INNER JOIN thread t ON c.parent_id = t.id
+			WHERE ` + notExpiredAs("c") + `
+		)
+		SELECT ancestor_id, COUNT(*) - 1
+		FROM thread
+		GROUP BY ancestor_id
+	`
+
+	rows, err := r.pool.Query(ctx, query, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count replies: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]int, len(ids))
+	for rows.Next() {
+		var id int64
+		var count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan reply count: %w", err)
+		}
+		counts[id] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return counts, nil
+}
+
+// DirectReplyCounts одним запросом считает только прямые ответы каждого из комментариев ids.
+// Это дешевле рекурсивного CountReplies; комментарии без ответов в результат не попадают
+func (r *PostgresRepository) DirectReplyCounts(ctx context.Context, ids []int64) (map[int64]int, error) {
+	query := `
+		SELECT parent_id, COUNT(*)
+		FROM comments
+		WHERE parent_id = ANY($1) AND ` + notExpired + `
+		GROUP BY parent_id
+	`
+
+	rows, err := r.pool.Query(ctx, query, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count direct replies: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]int, len(ids))
+	for rows.Next() {
+		var id int64
+		var count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan direct reply count: %w", err)
+		}
+		counts[id] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return counts, nil
+}
+
+// HasChildren одним запросом определяет, у каких из комментариев ids есть хотя бы один действующий ответ.
+// В отличие от DirectReplyCounts ответы не считаются; комментариев без ответов в результате нет
+func (r *PostgresRepository) HasChildren(ctx context.Context, ids []int64) (map[int64]bool, error) {
+	query := `
+		SELECT DISTINCT parent_id
+		FROM comments
+		WHERE parent_id = ANY($1) AND ` + notExpired + `
+	`
+
+	rows, err := r.pool.Query(ctx, query, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check children: %w", err)
+	}
+	defer rows.Close()
+
+	hasChildren := make(map[int64]bool, len(ids))
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan parent id: %w", err)
+		}
+		hasChildren[id] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return hasChildren, nil
+}
+
+// AddViews увеличивает счетчики просмотров комментариев на накопленные значения одним запросом
+func (r *PostgresRepository) AddViews(ctx context.Context, views map[int64]int64) error {
+	if len(views) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(views))
+	counts := make([]int64, 0, len(views))
+	for id, n := range views {
+		ids = append(ids, id)
+		counts = append(counts, n)
+	}
+
+	query := `
+		UPDATE comments c
+		SET view_count = c.view_count + v.n
+		FROM unnest($1::bigint[], $2::bigint[]) AS v(id, n)
+		WHERE c.id = v.id
+	`
+
+	if _, err := r.pool.Exec(ctx, query, ids, counts); err != nil {
+		return fmt.Errorf("failed to add views: %w", err)
+	}
+
+	return nil
+}
+
+// GetThreadSummary возвращает сводку ветки комментария id: сам комментарий, число комментариев
+// в его поддереве (вместе с ним) и время последнего создания или изменения в поддереве.
+// Дерево не строится, комментарии поддерева только агрегируются
+func (r *PostgresRepository) GetThreadSummary(ctx context.Context, id int64) (*domain.ThreadSummary, error) {
+	root, err := r.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		WITH RECURSIVE thread AS (
+			SELECT id, created_at, updated_at
+			FROM comments
+			WHERE id = $1
+			
+			UNION ALL
+			
+			SELECT c.id, c.created_at, c.updated_at
+			FROM comments c
+			INNER JOIN thread t ON c.parent_id = t.id
+			WHERE ` + notExpiredAs("c") + `
+		)
+		SELECT COUNT(*), MAX(GREATEST(created_at, updated_at))
+		FROM thread
+	`
+
+	summary := domain.ThreadSummary{Root: *root}
+	err = r.pool.QueryRow(ctx, query, id).Scan(&summary.CommentCount, &summary.LastActivityAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize thread: %w", err)
+	}
+
+	return &summary, nil
+}
+
+// SetChildrenCollapsed задает, сворачиваются ли ответы комментария id по умолчанию при отображении.
+// Флаг не влияет на состав дерева и, как и принятие ответа, не меняет updated_at
+func (r *PostgresRepository) SetChildrenCollapsed(ctx context.Context, id int64, collapsed bool) (*domain.Comment, error) {
+	query := `
+		UPDATE comments
+		SET children_collapsed = $2
+		WHERE id = $1 AND ` + notExpired + `
+		RETURNING ` + commentColumns + `
+	`
+
+	comment, err := scanComment(r.pool.QueryRow(ctx, query, id, collapsed))
+	if err == pgx.ErrNoRows {
+		return nil, r.notFound(ctx, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to set children collapsed: %w", err)
+	}
+
+	return &comment, nil
+}
+
+// Update заменяет текст комментария comment.ID вместе с его хешем и упоминаниями в одной транзакции
+// и выставляет updated_at текущим временем сервиса, как Create для created_at: время БД могло бы
+// разойтись с ним, и правка оказалась бы раньше создания. created_at и slug не меняются, чтобы
+// постоянные ссылки оставались рабочими. Остальные поля comment заполняются из обновленной строки
+func (r *PostgresRepository) Update(ctx context.Context, comment *domain.Comment) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE comments
+		SET content = $2, content_hash = $3, updated_at = $4
+		WHERE id = $1 AND ` + notExpired + `
+		RETURNING ` + commentColumns + `
+	`
+
+	id := comment.ID
+	updated, err := scanComment(tx.QueryRow(ctx, query, id, comment.Content, comment.ContentHash, time.Now()))
+	if err == pgx.ErrNoRows {
+		return r.notFound(ctx, id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update comment: %w", err)
+	}
+	updated.Mentions = comment.Mentions
+	*comment = updated
+
+	// Упоминания зависят от текста, поэтому заменяются целиком
+	if _, err := tx.Exec(ctx, `DELETE FROM comment_mentions WHERE comment_id = $1`, id); err != nil {
+		return fmt.Errorf("failed to clear mentions: %w", err)
+	}
+	if len(comment.Mentions) > 0 {
+		mentionsQuery := `
+			INSERT INTO comment_mentions (comment_id, username)
+			SELECT $1, unnest($2::text[])
+			ON CONFLICT DO NOTHING
+		`
+		if _, err := tx.Exec(ctx, mentionsQuery, id, comment.Mentions); err != nil {
+			return fmt.Errorf("failed to save mentions: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
@@ -2,51 +2,244 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
+	"unicode/utf8"
 
 	"github.com/oziev02/CommentTree/internal/domain"
 )
 
+// Config содержит настройки бизнес-логики комментариев
+type Config struct {
+	// DedupWindow окно, в течение которого повторный комментарий с тем же текстом
+	// под тем же родителем отклоняется как случайная двойная отправка (0 - проверка отключена).
+	// У комментариев нет автора, поэтому дубликатом считается такой же текст любого
+	// комментатора под тем же родителем
+	DedupWindow time.Duration
+
+	// SimilarityThreshold порог триграммного сходства (0..1), выше которого комментарий под тем же
+	// родителем в пределах SimilarityWindow отклоняется как почти дубликат (0 - проверка отключена).
+	// Как и DedupWindow, сравнивается с комментариями всех комментаторов под тем же родителем
+	SimilarityThreshold float64
+	// SimilarityWindow окно проверки похожих комментариев
+	SimilarityWindow time.Duration
+
+	// ContentProcessors шаги обработки текста, применяемые по порядку перед сохранением
+	ContentProcessors []ContentProcessor
+
+	// DefaultTTL срок жизни комментария, если expires_at не указан при создании (0 - бессрочно)
+	DefaultTTL time.Duration
+
+	// HotDecay период, за который возраст ветки снижает рейтинг сортировки hot на единицу
+	HotDecay time.Duration
+
+	// MaxSearchResults максимальное число веток с совпадениями, рассматриваемых поиском (0 - без ограничения)
+	MaxSearchResults int
+
+	// Events шина, в которую публикуются события после успешных изменений (nil - события не публикуются)
+	Events *EventBus
+
+	// Views счетчик просмотров поддеревьев (nil - просмотры не считаются)
+	Views *ViewCounter
+}
+
+// maxClientRefLength максимальная длина client_ref в символах
+const maxClientRefLength = 128
+
 // CommentUseCase содержит бизнес-логику для работы с комментариями
 type CommentUseCase struct {
-	repo domain.CommentRepository
+	repo    domain.CommentRepository
+	cfg     Config
+	content ContentPipeline
 }
 
 // NewCommentUseCase создает новый экземпляр CommentUseCase
-func NewCommentUseCase(repo domain.CommentRepository) *CommentUseCase {
-	return &CommentUseCase{repo: repo}
+func NewCommentUseCase(repo domain.CommentRepository, cfg Config) *CommentUseCase {
+	return &CommentUseCase{
+		repo:    repo,
+		cfg:     cfg,
+		content: ContentPipeline(cfg.ContentProcessors),
+	}
 }
 
 // Create создает новый комментарий
-func (uc *CommentUseCase) Create(ctx context.Context, parentID *int64, content string) (*domain.Comment, error) {
+func (uc *CommentUseCase) Create(ctx context.Context, parentID *int64, content string, expiresAt *time.Time, clientRef string) (*domain.Comment, error) {
+	comment, err := uc.newComment(ctx, parentID, content, expiresAt, clientRef)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := uc.repo.Create(ctx, comment); err != nil {
+		return nil, fmt.Errorf("failed to create comment: %w", err)
+	}
+	uc.publish(EventCreated, comment)
+
+	return comment, nil
+}
+
+// CreateWithThread создает комментарий и возвращает его вместе со всей веткой корневого комментария,
+// прочитанной в той же транзакции
+func (uc *CommentUseCase) CreateWithThread(ctx context.Context, parentID *int64, content string, expiresAt *time.Time, clientRef string) (*domain.Comment, *domain.CommentTree, error) {
+	comment, err := uc.newComment(ctx, parentID, content, expiresAt, clientRef)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	thread, err := uc.repo.CreateWithThread(ctx, comment)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create comment: %w", err)
+	}
+	uc.publish(EventCreated, comment)
+
+	return comment, thread, nil
+}
+
+// Validate выполняет все проверки и обработку текста, что и Create, но не сохраняет комментарий.
+// Возвращает комментарий в том виде, в котором он был бы сохранен
+func (uc *CommentUseCase) Validate(ctx context.Context, parentID *int64, content string, expiresAt *time.Time, clientRef string) (*domain.Comment, error) {
+	return uc.newComment(ctx, parentID, content, expiresAt, clientRef)
+}
+
+// processContent прогоняет текст через конвейер обработки и отклоняет текст, ставший пустым
+func (uc *CommentUseCase) processContent(content string) (string, error) {
+	content, err := uc.content.Process(content)
+	if err != nil {
+		return "", err
+	}
 	if content == "" {
-		return nil, domain.ErrEmptyContent
+		return "", &domain.ContentError{
+			Err:        domain.ErrEmptyContent,
+			Code:       domain.ContentEmpty,
+			Suggestion: "enter some text other than whitespace",
+		}
+	}
+	return content, nil
+}
+
+// newComment обрабатывает и проверяет данные нового комментария. Если expiresAt не указан,
+// срок жизни берется из DefaultTTL; ответ не может пережить родителя, поэтому его срок
+// ограничивается сроком родителя
+func (uc *CommentUseCase) newComment(ctx context.Context, parentID *int64, content string, expiresAt *time.Time, clientRef string) (*domain.Comment, error) {
+	// Проверки без обращения к БД выполняются все, и их ошибки возвращаются вместе.
+	// Родитель и дубликаты проверяются в БД только для запроса, прошедшего эти проверки
+	var invalid domain.ValidationErrors
+
+	content, err := uc.processContent(content)
+	if err != nil {
+		invalid = append(invalid, err)
+	}
+
+	if utf8.RuneCountInString(clientRef) > maxClientRefLength {
+		invalid = append(invalid, &domain.ValidationError{
+			Field:   "client_ref",
+			Message: fmt.Sprintf("client_ref must be at most %d characters", maxClientRefLength),
+		})
+	}
+
+	now := time.Now()
+	if expiresAt != nil && !expiresAt.After(now) {
+		invalid = append(invalid, domain.ErrInvalidExpiry)
+	}
+
+	// Единственная ошибка возвращается как есть, чтобы ответ на нее не изменился
+	switch len(invalid) {
+	case 0:
+	case 1:
+		return nil, invalid[0]
+	default:
+		return nil, invalid
+	}
+	if expiresAt == nil && uc.cfg.DefaultTTL > 0 {
+		defaultExpiry := now.Add(uc.cfg.DefaultTTL)
+		expiresAt = &defaultExpiry
 	}
 
 	comment := &domain.Comment{
-		ParentID: parentID,
-		Content:  content,
+		ParentID:    parentID,
+		Content:     content,
+		Mentions:    extractMentions(content),
+		Slug:        slugBase(content),
+		ClientRef:   clientRef,
+		ContentHash: contentHash(content),
+		ExpiresAt:   expiresAt,
 	}
 
 	if parentID != nil {
-		parent, err := uc.repo.GetByID(*parentID)
+		parent, err := uc.repo.GetByID(ctx, *parentID)
+		if errors.Is(err, domain.ErrCommentDeleted) {
+			return nil, domain.ErrParentDeleted
+		}
+		if errors.Is(err, domain.ErrCommentNotFound) {
+			return nil, domain.ErrInvalidParent
+		}
 		if err != nil {
 			return nil, fmt.Errorf("failed to get parent comment: %w", err)
 		}
 		if parent == nil {
 			return nil, domain.ErrInvalidParent
 		}
+		if parent.ExpiresAt != nil && (comment.ExpiresAt == nil || comment.ExpiresAt.After(*parent.ExpiresAt)) {
+			comment.ExpiresAt = parent.ExpiresAt
+		}
 	}
 
-	if err := uc.repo.Create(comment); err != nil {
-		return nil, fmt.Errorf("failed to create comment: %w", err)
+	if uc.cfg.DedupWindow > 0 {
+		duplicate, err := uc.repo.HasRecentDuplicate(ctx, parentID, content, now.Add(-uc.cfg.DedupWindow))
+		if err != nil {
+			return nil, fmt.Errorf("failed to check duplicate comment: %w", err)
+		}
+		if duplicate {
+			return nil, domain.ErrDuplicateComment
+		}
+	}
+
+	if uc.cfg.SimilarityThreshold > 0 && uc.cfg.SimilarityWindow > 0 {
+		similar, err := uc.repo.HasRecentSimilar(ctx, parentID, content, now.Add(-uc.cfg.SimilarityWindow), uc.cfg.SimilarityThreshold)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check similar comment: %w", err)
+		}
+		if similar {
+			return nil, domain.ErrProbableDuplicate
+		}
 	}
 
 	return comment, nil
 }
 
-// GetTree получает дерево комментариев
-func (uc *CommentUseCase) GetTree(ctx context.Context, filter domain.CommentFilter) ([]domain.CommentTree, error) {
+// GetTree получает дерево комментариев. Второе значение сообщает, что результат поиска
+// обрезан ограничением MaxSearchResults
+func (uc *CommentUseCase) GetTree(ctx context.Context, filter domain.CommentFilter) ([]domain.CommentTree, bool, error) {
+	filter = uc.treeFilter(filter)
+
+	if filter.Search != "" {
+		return uc.repo.Search(ctx, filter.Search, filter)
+	}
+
+	trees, err := uc.repo.GetTree(ctx, filter.ParentID, filter)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Просмотром ветки считается загрузка ее поддерева. Для отсутствующего родителя GetTree
+	// возвращает пустой результат без ошибки, и такой ID не должен попадать в буфер просмотров
+	if filter.ParentID != nil && len(trees) > 0 {
+		uc.cfg.Views.Record(*filter.ParentID)
+	}
+
+	return trees, false, nil
+}
+
+// SearchStream выполняет поиск filter.Search и передает найденные ветки в yield по одной,
+// по мере чтения из БД. Возвращает признак обрезки результата ограничением MaxSearchResults
+func (uc *CommentUseCase) SearchStream(ctx context.Context, filter domain.CommentFilter, yield func(domain.CommentTree) error) (bool, error) {
+	filter = uc.treeFilter(filter)
+
+	return uc.repo.SearchStream(ctx, filter.Search, filter, yield)
+}
+
+// treeFilter заполняет значения фильтра дерева по умолчанию и настройки из Config
+func (uc *CommentUseCase) treeFilter(filter domain.CommentFilter) domain.CommentFilter {
 	if filter.Page <= 0 {
 		filter.Page = 1
 	}
@@ -59,29 +252,253 @@ func (uc *CommentUseCase) GetTree(ctx context.Context, filter domain.CommentFilt
 	if filter.Order == "" {
 		filter.Order = "desc"
 	}
+	filter.HotDecay = uc.cfg.HotDecay
+	filter.MaxSearchResults = uc.cfg.MaxSearchResults
 
-	if filter.Search != "" {
-		return uc.repo.Search(filter.Search, filter)
-	}
-
-	return uc.repo.GetTree(filter.ParentID, filter)
+	return filter
 }
 
-// Delete удаляет комментарий и все вложенные комментарии
-func (uc *CommentUseCase) Delete(ctx context.Context, id int64) error {
-	_, err := uc.repo.GetByID(id)
+// Delete удаляет комментарий. При стратегии domain.DeleteCascade удаляются и все вложенные
+// комментарии, при domain.DeleteReparent ответы переходят к родителю удаляемого комментария
+func (uc *CommentUseCase) Delete(ctx context.Context, id int64, strategy string) error {
+	comment, err := uc.repo.GetByID(ctx, id)
 	if err != nil {
 		return fmt.Errorf("failed to get comment: %w", err)
 	}
 
-	if err := uc.repo.Delete(id); err != nil {
+	if strategy == domain.DeleteReparent {
+		err = uc.repo.DeleteReparent(ctx, id)
+	} else {
+		err = uc.repo.Delete(ctx, id)
+	}
+	if err != nil {
 		return fmt.Errorf("failed to delete comment: %w", err)
 	}
+	uc.publish(EventDeleted, comment)
 
 	return nil
 }
 
-// GetTotalCount возвращает общее количество комментариев
-func (uc *CommentUseCase) GetTotalCount(ctx context.Context, parentID *int64, search string) (int, error) {
-	return uc.repo.Count(parentID, search)
+// GetTotalCount возвращает общее количество комментариев, подходящих под фильтр
+func (uc *CommentUseCase) GetTotalCount(ctx context.Context, filter domain.CommentFilter) (int, error) {
+	filter.MaxSearchResults = uc.cfg.MaxSearchResults
+	return uc.repo.Count(ctx, filter)
+}
+
+// LastDeletedAt возвращает время последнего удаления комментария (нулевое, если удалений не было)
+func (uc *CommentUseCase) LastDeletedAt(ctx context.Context) (time.Time, error) {
+	return uc.repo.LastDeletedAt(ctx)
+}
+
+// GetRecent возвращает последние комментарии любой вложенности
+func (uc *CommentUseCase) GetRecent(ctx context.Context, limit int) ([]domain.RecentComment, error) {
+	return uc.repo.GetRecent(ctx, limit)
+}
+
+// GetAncestors возвращает цепочку предков комментария, начиная с корневого
+func (uc *CommentUseCase) GetAncestors(ctx context.Context, id int64) ([]domain.Comment, error) {
+	return uc.repo.GetAncestors(ctx, id)
+}
+
+// GetPrevious возвращает комментарий, предшествующий id среди ответов того же родителя
+// (для корневого - предыдущий корневой), или nil, если id первый
+func (uc *CommentUseCase) GetPrevious(ctx context.Context, id int64) (*domain.Comment, error) {
+	return uc.repo.GetPrevious(ctx, id)
+}
+
+// GetByMention возвращает комментарии, в которых упомянут пользователь
+func (uc *CommentUseCase) GetByMention(ctx context.Context, username string, page, pageSize int) ([]domain.Comment, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 50
+	}
+
+	return uc.repo.GetByMention(ctx, username, pageSize, (page-1)*pageSize)
+}
+
+// GetByContentHash возвращает комментарии с тем же нормализованным текстом, что и у хеша hash
+// (например, все копии спам-сообщения)
+func (uc *CommentUseCase) GetByContentHash(ctx context.Context, hash string, page, pageSize int) ([]domain.Comment, error) {
+	if !isContentHash(hash) {
+		return nil, domain.ErrInvalidHash
+	}
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 50
+	}
+
+	return uc.repo.GetByContentHash(ctx, hash, pageSize, (page-1)*pageSize)
+}
+
+// Accept отмечает ответ как принятый; ранее принятый ответ той же ветки перестает быть принятым
+func (uc *CommentUseCase) Accept(ctx context.Context, id int64) (*domain.Comment, error) {
+	comment, err := uc.repo.Accept(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept comment: %w", err)
+	}
+	uc.publish(EventAccepted, comment)
+
+	return comment, nil
+}
+
+// Update заменяет текст комментария. Текст проходит тот же конвейер обработки, что и при создании;
+// пустой текст отклоняется с ошибкой, оборачивающей domain.ErrEmptyContent. Хеш и упоминания
+// пересчитываются, updated_at обновляется, created_at и slug сохраняются
+func (uc *CommentUseCase) Update(ctx context.Context, id int64, content string) (*domain.Comment, error) {
+	content, err := uc.processContent(content)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := &domain.Comment{
+		ID:          id,
+		Content:     content,
+		Mentions:    extractMentions(content),
+		ContentHash: contentHash(content),
+	}
+	if err := uc.repo.Update(ctx, comment); err != nil {
+		return nil, fmt.Errorf("failed to update comment: %w", err)
+	}
+	uc.publish(EventUpdated, comment)
+
+	return comment, nil
+}
+
+// SetChildrenCollapsed задает, показываются ли ответы комментария свернутыми по умолчанию
+func (uc *CommentUseCase) SetChildrenCollapsed(ctx context.Context, id int64, collapsed bool) (*domain.Comment, error) {
+	comment, err := uc.repo.SetChildrenCollapsed(ctx, id, collapsed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set children collapsed: %w", err)
+	}
+	uc.publish(EventChildrenCollapsed, comment)
+
+	return comment, nil
+}
+
+// GetTimeline возвращает плоскую ленту комментариев с пагинацией по комментариям
+func (uc *CommentUseCase) GetTimeline(ctx context.Context, filter domain.CommentFilter) ([]domain.TimelineComment, error) {
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 {
+		filter.PageSize = 50
+	}
+
+	return uc.repo.GetTimeline(ctx, filter)
+}
+
+// Locate возвращает корень ветки комментария, его позицию среди корневых комментариев
+// и номер страницы, на которой он окажется при размере страницы filter.PageSize
+func (uc *CommentUseCase) Locate(ctx context.Context, id int64, filter domain.CommentFilter) (*domain.CommentLocation, error) {
+	if filter.PageSize <= 0 {
+		filter.PageSize = 50
+	}
+
+	location, err := uc.repo.Locate(ctx, id, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate comment: %w", err)
+	}
+	location.Page = location.Index/filter.PageSize + 1
+
+	return location, nil
+}
+
+// GetBySlug возвращает комментарий по slug постоянной ссылки
+func (uc *CommentUseCase) GetBySlug(ctx context.Context, slug string) (*domain.Comment, error) {
+	return uc.repo.GetBySlug(ctx, slug)
+}
+
+// GetThreadSummary возвращает краткую сводку ветки комментария id
+func (uc *CommentUseCase) GetThreadSummary(ctx context.Context, id int64) (*domain.ThreadSummary, error) {
+	return uc.repo.GetThreadSummary(ctx, id)
+}
+
+// GetContext возвращает комментарий id вместе с родителем, страницей соседей и страницей прямых ответов
+// для показа ответа в контексте беседы. Соседи и ответы упорядочены от старых к новым
+func (uc *CommentUseCase) GetContext(ctx context.Context, id int64, siblingsPage, childrenPage, pageSize int) (*domain.CommentContext, error) {
+	comment, err := uc.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &domain.CommentContext{Comment: *comment}
+	if comment.ParentID != nil {
+		result.Parent, err = uc.repo.GetByID(ctx, *comment.ParentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result.Siblings, result.SiblingsTotal, err = uc.directReplies(ctx, comment.ParentID, siblingsPage, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	result.Children, result.ChildrenTotal, err = uc.directReplies(ctx, &comment.ID, childrenPage, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// directReplies возвращает страницу прямых ответов parentID (корневых комментариев, если parentID == nil)
+// без их собственных ответов и общее число таких комментариев
+func (uc *CommentUseCase) directReplies(ctx context.Context, parentID *int64, page, pageSize int) ([]domain.Comment, int, error) {
+	replies, err := uc.repo.GetReplies(ctx, parentID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := uc.repo.Count(ctx, domain.CommentFilter{ParentID: parentID})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return replies, total, nil
+}
+
+// CountReplies возвращает число ответов любой вложенности для каждого из комментариев ids
+func (uc *CommentUseCase) CountReplies(ctx context.Context, ids []int64) (map[int64]int, error) {
+	if len(ids) == 0 {
+		return map[int64]int{}, nil
+	}
+
+	return uc.repo.CountReplies(ctx, ids)
+}
+
+// DirectReplyCounts возвращает число прямых ответов для каждого из комментариев ids.
+// Комментариев без ответов в результате нет
+func (uc *CommentUseCase) DirectReplyCounts(ctx context.Context, ids []int64) (map[int64]int, error) {
+	if len(ids) == 0 {
+		return map[int64]int{}, nil
+	}
+
+	return uc.repo.DirectReplyCounts(ctx, ids)
+}
+
+// HasChildren сообщает, есть ли ответы у каждого из комментариев ids, не считая и не загружая их.
+// Комментариев без ответов в результате нет
+func (uc *CommentUseCase) HasChildren(ctx context.Context, ids []int64) (map[int64]bool, error) {
+	if len(ids) == 0 {
+		return map[int64]bool{}, nil
+	}
+
+	return uc.repo.HasChildren(ctx, ids)
+}
+
+// publish отправляет событие об изменении комментария в шину событий, если она задана
+func (uc *CommentUseCase) publish(eventType string, comment *domain.Comment) {
+	if comment == nil {
+		return
+	}
+
+	uc.cfg.Events.Publish(Event{
+		Type:       eventType,
+		Comment:    *comment,
+		OccurredAt: time.Now(),
+	})
 }
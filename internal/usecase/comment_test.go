@@ -0,0 +1,152 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+func TestCreateDedup(t *testing.T) {
+	parentID := int64(1)
+	// Под комментарием 1 пять секунд назад уже оставлен ответ "same text"
+	stored := domain.Comment{ID: 2, ParentID: &parentID, Content: "same text", CreatedAt: time.Now().Add(-5 * time.Second)}
+
+	tests := []struct {
+		name     string
+		window   time.Duration
+		parentID *int64
+		content  string
+		wantErr  error
+	}{
+		{name: "duplicate within window", window: 10 * time.Second, parentID: &parentID, content: "same text", wantErr: domain.ErrDuplicateComment},
+		{name: "duplicate outside window", window: 2 * time.Second, parentID: &parentID, content: "same text"},
+		{name: "same text under another parent", window: 10 * time.Second, content: "same text"},
+		{name: "different text", window: 10 * time.Second, parentID: &parentID, content: "other text"},
+		{name: "check disabled", parentID: &parentID, content: "same text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created := false
+			repo := &stubRepository{
+				getByID: func(ctx context.Context, id int64) (*domain.Comment, error) {
+					return &domain.Comment{ID: id}, nil
+				},
+				hasRecentDuplicate: func(ctx context.Context, parentID *int64, content string, since time.Time) (bool, error) {
+					if tt.window == 0 {
+						t.Error("HasRecentDuplicate called with the check disabled")
+					}
+					sameParent := (parentID == nil) == (stored.ParentID == nil) && (parentID == nil || *parentID == *stored.ParentID)
+					return sameParent && content == stored.Content && !stored.CreatedAt.Before(since), nil
+				},
+				create: func(ctx context.Context, comment *domain.Comment) error {
+					created = true
+					return nil
+				},
+			}
+			uc := NewCommentUseCase(repo, Config{DedupWindow: tt.window})
+
+			_, err := uc.Create(context.Background(), tt.parentID, tt.content, nil, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Create error = %v, want %v", err, tt.wantErr)
+			}
+			if created != (tt.wantErr == nil) {
+				t.Errorf("comment created = %v, want %v", created, tt.wantErr == nil)
+			}
+		})
+	}
+}
+
+func TestCreateSimilarity(t *testing.T) {
+	// Сходство нового текста с уже оставленным под родителем ответом "buy cheap watches here"
+	similarity := map[string]float64{
+		"buy cheap watches here!!": 0.8,
+		"buy cheap watches":        0.6,
+		"what a great article":     0.05,
+	}
+
+	tests := []struct {
+		name      string
+		threshold float64
+		content   string
+		wantErr   error
+	}{
+		{name: "near duplicate", threshold: 0.7, content: "buy cheap watches here!!", wantErr: domain.ErrProbableDuplicate},
+		{name: "below threshold", threshold: 0.7, content: "buy cheap watches"},
+		{name: "lower threshold", threshold: 0.5, content: "buy cheap watches", wantErr: domain.ErrProbableDuplicate},
+		{name: "clearly different", threshold: 0.3, content: "what a great article"},
+		{name: "check disabled", content: "buy cheap watches here!!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			repo := &stubRepository{
+				hasRecentSimilar: func(ctx context.Context, parentID *int64, content string, since time.Time, threshold float64) (bool, error) {
+					if tt.threshold == 0 {
+						t.Error("HasRecentSimilar called with the check disabled")
+					}
+					if threshold != tt.threshold {
+						t.Errorf("threshold = %v, want %v", threshold, tt.threshold)
+					}
+					if since.Before(now.Add(-time.Minute)) || since.After(now) {
+						t.Errorf("since = %v, want SimilarityWindow before %v", since, now)
+					}
+					return similarity[content] > threshold, nil
+				},
+				create: func(ctx context.Context, comment *domain.Comment) error {
+					return nil
+				},
+			}
+			uc := NewCommentUseCase(repo, Config{SimilarityThreshold: tt.threshold, SimilarityWindow: time.Minute})
+
+			_, err := uc.Create(context.Background(), nil, tt.content, nil, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Create error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateParentState(t *testing.T) {
+	tests := []struct {
+		name      string
+		parentErr error
+		wantErr   error
+	}{
+		{name: "live parent"},
+		{name: "deleted parent", parentErr: domain.ErrCommentDeleted, wantErr: domain.ErrParentDeleted},
+		{name: "missing parent", parentErr: domain.ErrCommentNotFound, wantErr: domain.ErrInvalidParent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created := false
+			repo := &stubRepository{
+				getByID: func(ctx context.Context, id int64) (*domain.Comment, error) {
+					if tt.parentErr != nil {
+						return nil, tt.parentErr
+					}
+					return &domain.Comment{ID: id}, nil
+				},
+				create: func(ctx context.Context, comment *domain.Comment) error {
+					created = true
+					return nil
+				},
+			}
+			uc := NewCommentUseCase(repo, Config{})
+
+			parentID := int64(1)
+			_, err := uc.Create(context.Background(), &parentID, "reply", nil, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Create error = %v, want %v", err, tt.wantErr)
+			}
+			if created != (tt.wantErr == nil) {
+				t.Errorf("comment created = %v, want %v", created, tt.wantErr == nil)
+			}
+		})
+	}
+}
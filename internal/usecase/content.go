@@ -0,0 +1,74 @@
+package usecase
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// ContentProcessor шаг обработки текста комментария перед сохранением.
+// Шаг возвращает преобразованный текст или ошибку, если текст недопустим
+type ContentProcessor interface {
+	Process(content string) (string, error)
+}
+
+// ContentProcessorFunc позволяет использовать функцию как ContentProcessor
+type ContentProcessorFunc func(content string) (string, error)
+
+// Process вызывает f(content)
+func (f ContentProcessorFunc) Process(content string) (string, error) {
+	return f(content)
+}
+
+// ContentPipeline применяет шаги обработки по порядку; первая ошибка прерывает обработку
+type ContentPipeline []ContentProcessor
+
+// Process прогоняет текст через все шаги конвейера
+func (p ContentPipeline) Process(content string) (string, error) {
+	for _, step := range p {
+		var err error
+		content, err = step.Process(content)
+		if err != nil {
+			return "", err
+		}
+	}
+	return content, nil
+}
+
+// TrimSpace удаляет пробельные символы в начале и конце текста
+func TrimSpace() ContentProcessor {
+	return ContentProcessorFunc(func(content string) (string, error) {
+		return strings.TrimSpace(content), nil
+	})
+}
+
+// inlineWhitespace последовательность пробельных символов, кроме переводов строки (\n и \r для CRLF)
+var inlineWhitespace = regexp.MustCompile(`[^\S\r\n]+`)
+
+// CollapseWhitespace заменяет последовательности пробелов и табуляций внутри текста одним пробелом.
+// Переводы строк сохраняются, поэтому абзацы (пустые строки между ними) не склеиваются
+func CollapseWhitespace() ContentProcessor {
+	return ContentProcessorFunc(func(content string) (string, error) {
+		return inlineWhitespace.ReplaceAllString(content, " "), nil
+	})
+}
+
+// MaxLength отклоняет текст длиннее maxRunes символов с ошибкой *domain.ContentError,
+// которая оборачивает domain.ErrContentTooLong и сообщает, сколько символов нужно убрать
+func MaxLength(maxRunes int) ContentProcessor {
+	return ContentProcessorFunc(func(content string) (string, error) {
+		if n := utf8.RuneCountInString(content); n > maxRunes {
+			return "", &domain.ContentError{
+				Err:        domain.ErrContentTooLong,
+				Code:       domain.ContentTooLong,
+				Suggestion: fmt.Sprintf("remove %d characters", n-maxRunes),
+				Limit:      maxRunes,
+				Actual:     n,
+			}
+		}
+		return content, nil
+	})
+}
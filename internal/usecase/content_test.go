@@ -0,0 +1,142 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+func TestMaxLength(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		max            int
+		wantErr        bool
+		wantActual     int
+		wantSuggestion string
+	}{
+		{name: "shorter", content: "abc", max: 5},
+		{name: "exact", content: "abcde", max: 5},
+		{name: "longer", content: "abcdefg", max: 5, wantErr: true, wantActual: 7, wantSuggestion: "remove 2 characters"},
+		{name: "counts runes, not bytes", content: "привет", max: 6},
+		{name: "multibyte longer", content: "привет!", max: 6, wantErr: true, wantActual: 7, wantSuggestion: "remove 1 characters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MaxLength(tt.max).Process(tt.content)
+			if !tt.wantErr {
+				if err != nil || got != tt.content {
+					t.Fatalf("Process = %q, %v, want %q unchanged", got, err, tt.content)
+				}
+				return
+			}
+
+			var contentErr *domain.ContentError
+			if !errors.As(err, &contentErr) {
+				t.Fatalf("error = %v, want *domain.ContentError", err)
+			}
+			if !errors.Is(err, domain.ErrContentTooLong) {
+				t.Error("error must wrap ErrContentTooLong")
+			}
+			if contentErr.Code != domain.ContentTooLong || contentErr.Limit != tt.max || contentErr.Actual != tt.wantActual {
+				t.Errorf("error = %+v, want code %s, limit %d, actual %d", contentErr, domain.ContentTooLong, tt.max, tt.wantActual)
+			}
+			if contentErr.Suggestion != tt.wantSuggestion {
+				t.Errorf("suggestion = %q, want %q", contentErr.Suggestion, tt.wantSuggestion)
+			}
+		})
+	}
+}
+
+func TestCollapseWhitespace(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "single spaces", content: "a b c", want: "a b c"},
+		{name: "multiple spaces", content: "a   b", want: "a b"},
+		{name: "tabs", content: "a\t\tb \t c", want: "a b c"},
+		{name: "edges kept", content: "  a  ", want: " a "},
+		{name: "newline kept", content: "a  \n  b", want: "a \n b"},
+		{name: "paragraphs kept", content: "first\n\nsecond", want: "first\n\nsecond"},
+		{name: "crlf kept", content: "a\t\r\nb", want: "a \r\nb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CollapseWhitespace().Process(tt.content)
+			if err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Process(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentPipeline(t *testing.T) {
+	tests := []struct {
+		name     string
+		pipeline ContentPipeline
+		content  string
+		want     string
+		wantErr  error
+	}{
+		{name: "empty pipeline", pipeline: nil, content: "  text  ", want: "  text  "},
+		{name: "trim", pipeline: ContentPipeline{TrimSpace()}, content: "  text  ", want: "text"},
+		{name: "limit after trim", pipeline: ContentPipeline{TrimSpace(), MaxLength(4)}, content: "  text  ", want: "text"},
+		{name: "limit before trim", pipeline: ContentPipeline{MaxLength(4), TrimSpace()}, content: "  text  ", wantErr: domain.ErrContentTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.pipeline.Process(tt.content)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("Process = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessContent(t *testing.T) {
+	uc := NewCommentUseCase(nil, Config{ContentProcessors: []ContentProcessor{TrimSpace(), MaxLength(10)}})
+
+	tests := []struct {
+		name     string
+		content  string
+		want     string
+		wantCode string
+	}{
+		{name: "valid", content: " hello ", want: "hello"},
+		{name: "empty", content: "", wantCode: domain.ContentEmpty},
+		{name: "whitespace only", content: " \n\t ", wantCode: domain.ContentEmpty},
+		{name: "too long", content: "hello world!", wantCode: domain.ContentTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := uc.processContent(tt.content)
+			if tt.wantCode == "" {
+				if err != nil || got != tt.want {
+					t.Fatalf("processContent = %q, %v, want %q", got, err, tt.want)
+				}
+				return
+			}
+
+			var contentErr *domain.ContentError
+			if !errors.As(err, &contentErr) || contentErr.Code != tt.wantCode {
+				t.Fatalf("error = %v, want ContentError %s", err, tt.wantCode)
+			}
+			if contentErr.Suggestion == "" {
+				t.Error("content error must suggest a fix")
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// threadRepository отдает GetByID, GetReplies и Count по набору комментариев в памяти:
+// 1 и 2 - корни, 3, 4 и 5 - ответы на 1, 6 - ответ на 3. Комментарий 9 удален
+func threadRepository() *stubRepository {
+	one, three := int64(1), int64(3)
+	comments := map[int64]domain.Comment{
+		1: {ID: 1},
+		2: {ID: 2},
+		3: {ID: 3, ParentID: &one},
+		4: {ID: 4, ParentID: &one},
+		5: {ID: 5, ParentID: &one},
+		6: {ID: 6, ParentID: &three},
+	}
+	children := func(parentID *int64) []domain.Comment {
+		var replies []domain.Comment
+		for id := int64(1); id <= 6; id++ {
+			c := comments[id]
+			if (parentID == nil && c.ParentID == nil) || (parentID != nil && c.ParentID != nil && *c.ParentID == *parentID) {
+				replies = append(replies, c)
+			}
+		}
+		return replies
+	}
+
+	return &stubRepository{
+		getByID: func(ctx context.Context, id int64) (*domain.Comment, error) {
+			if id == 9 {
+				return nil, domain.ErrCommentDeleted
+			}
+			c, ok := comments[id]
+			if !ok {
+				return nil, domain.ErrCommentNotFound
+			}
+			return &c, nil
+		},
+		getReplies: func(ctx context.Context, parentID *int64, limit, offset int) ([]domain.Comment, error) {
+			replies := children(parentID)
+			if offset >= len(replies) {
+				return []domain.Comment{}, nil
+			}
+			if offset+limit < len(replies) {
+				replies = replies[:offset+limit]
+			}
+			return replies[offset:], nil
+		},
+		count: func(ctx context.Context, filter domain.CommentFilter) (int, error) {
+			return len(children(filter.ParentID)), nil
+		},
+	}
+}
+
+func ids(comments []domain.Comment) []int64 {
+	result := make([]int64, len(comments))
+	for i := range comments {
+		result[i] = comments[i].ID
+	}
+	return result
+}
+
+func TestGetContext(t *testing.T) {
+	tests := []struct {
+		name          string
+		id            int64
+		siblingsPage  int
+		childrenPage  int
+		pageSize      int
+		wantParent    *int64
+		wantSiblings  []int64
+		wantSiblingsN int
+		wantChildren  []int64
+		wantChildrenN int
+		wantErr       error
+	}{
+		{
+			name: "root", id: 1, siblingsPage: 1, childrenPage: 1, pageSize: 10,
+			wantSiblings: []int64{1, 2}, wantSiblingsN: 2,
+			wantChildren: []int64{3, 4, 5}, wantChildrenN: 3,
+		},
+		{
+			name: "reply", id: 3, siblingsPage: 1, childrenPage: 1, pageSize: 10,
+			wantParent:   int64Ptr(1),
+			wantSiblings: []int64{3, 4, 5}, wantSiblingsN: 3,
+			wantChildren: []int64{6}, wantChildrenN: 1,
+		},
+		{
+			name: "paged siblings", id: 4, siblingsPage: 2, childrenPage: 1, pageSize: 2,
+			wantParent:   int64Ptr(1),
+			wantSiblings: []int64{5}, wantSiblingsN: 3,
+			wantChildren: []int64{}, wantChildrenN: 0,
+		},
+		{name: "missing", id: 42, siblingsPage: 1, childrenPage: 1, pageSize: 10, wantErr: domain.ErrCommentNotFound},
+		{name: "deleted", id: 9, siblingsPage: 1, childrenPage: 1, pageSize: 10, wantErr: domain.ErrCommentDeleted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := NewCommentUseCase(threadRepository(), Config{})
+
+			got, err := uc.GetContext(context.Background(), tt.id, tt.siblingsPage, tt.childrenPage, tt.pageSize)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got.Comment.ID != tt.id {
+				t.Errorf("comment = %d, want %d", got.Comment.ID, tt.id)
+			}
+			switch {
+			case tt.wantParent == nil && got.Parent != nil:
+				t.Errorf("parent = %d, want none", got.Parent.ID)
+			case tt.wantParent != nil && (got.Parent == nil || got.Parent.ID != *tt.wantParent):
+				t.Errorf("parent = %v, want %d", got.Parent, *tt.wantParent)
+			}
+			if !reflect.DeepEqual(ids(got.Siblings), tt.wantSiblings) || got.SiblingsTotal != tt.wantSiblingsN {
+				t.Errorf("siblings = %v of %d, want %v of %d", ids(got.Siblings), got.SiblingsTotal, tt.wantSiblings, tt.wantSiblingsN)
+			}
+			if !reflect.DeepEqual(ids(got.Children), tt.wantChildren) || got.ChildrenTotal != tt.wantChildrenN {
+				t.Errorf("children = %v of %d, want %v of %d", ids(got.Children), got.ChildrenTotal, tt.wantChildren, tt.wantChildrenN)
+			}
+		})
+	}
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
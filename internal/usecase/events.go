@@ -0,0 +1,95 @@
+package usecase
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// Типы событий об изменении комментариев
+const (
+	EventCreated           = "comment.created"
+	EventUpdated           = "comment.updated"
+	EventDeleted           = "comment.deleted"
+	EventAccepted          = "comment.accepted"
+	EventChildrenCollapsed = "comment.children_collapsed"
+)
+
+// Event описывает успешное изменение комментария. Для EventDeleted Comment содержит
+// состояние комментария до удаления
+type Event struct {
+	Type       string
+	Comment    domain.Comment
+	OccurredAt time.Time
+}
+
+// EventBus рассылает события об изменениях всем подписчикам внутри процесса.
+// У каждого подписчика свой буферизованный канал; если буфер заполнен, событие для этого
+// подписчика отбрасывается с предупреждением в лог, чтобы медленный подписчик не блокировал запись
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers []chan Event
+	buffer      int
+	closed      bool
+	logger      *slog.Logger
+}
+
+// NewEventBus создает новый экземпляр EventBus с буфером buffer событий на подписчика
+func NewEventBus(buffer int, logger *slog.Logger) *EventBus {
+	if buffer < 0 {
+		buffer = 0
+	}
+	return &EventBus{buffer: buffer, logger: logger}
+}
+
+// Subscribe регистрирует нового подписчика. Канал закрывается при вызове Close
+func (b *EventBus) Subscribe() <-chan Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, b.buffer)
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	b.subscribers = append(b.subscribers, ch)
+	return ch
+}
+
+// Publish отправляет событие всем подписчикам не блокируясь. Вызов на nil EventBus ничего не делает
+func (b *EventBus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return
+	}
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			b.logger.Warn("event dropped: subscriber buffer is full", "type", event.Type, "comment_id", event.Comment.ID)
+		}
+	}
+}
+
+// Close закрывает каналы всех подписчиков; последующие события отбрасываются
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, ch := range b.subscribers {
+		close(ch)
+	}
+	b.subscribers = nil
+}
@@ -0,0 +1,110 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+func TestEventBusDeliversToEverySubscriber(t *testing.T) {
+	bus := NewEventBus(1, discardLogger)
+	first, second := bus.Subscribe(), bus.Subscribe()
+
+	bus.Publish(Event{Type: EventCreated, Comment: domain.Comment{ID: 7}})
+
+	for i, ch := range []<-chan Event{first, second} {
+		select {
+		case event := <-ch:
+			if event.Type != EventCreated || event.Comment.ID != 7 {
+				t.Errorf("subscriber %d got %+v, want %s for comment 7", i, event, EventCreated)
+			}
+		default:
+			t.Errorf("subscriber %d got no event", i)
+		}
+	}
+}
+
+func TestEventBusDropsWhenBufferIsFull(t *testing.T) {
+	bus := NewEventBus(1, discardLogger)
+	slow, fast := bus.Subscribe(), bus.Subscribe()
+
+	bus.Publish(Event{Type: EventCreated, Comment: domain.Comment{ID: 1}})
+	<-fast
+	// Буфер slow заполнен первым событием: второе для него отбрасывается, не блокируя Publish
+	bus.Publish(Event{Type: EventDeleted, Comment: domain.Comment{ID: 1}})
+
+	if event := <-slow; event.Type != EventCreated {
+		t.Errorf("slow subscriber got %s, want %s", event.Type, EventCreated)
+	}
+	select {
+	case event := <-slow:
+		t.Errorf("slow subscriber got dropped event %s", event.Type)
+	default:
+	}
+	if event := <-fast; event.Type != EventDeleted {
+		t.Errorf("fast subscriber got %s, want %s", event.Type, EventDeleted)
+	}
+}
+
+func TestEventBusClose(t *testing.T) {
+	bus := NewEventBus(1, discardLogger)
+	ch := bus.Subscribe()
+
+	bus.Close()
+	bus.Close()
+	bus.Publish(Event{Type: EventCreated})
+
+	if _, ok := <-ch; ok {
+		t.Error("subscriber channel is open after Close")
+	}
+	if _, ok := <-bus.Subscribe(); ok {
+		t.Error("Subscribe after Close returned an open channel")
+	}
+}
+
+func TestNilEventBusPublish(t *testing.T) {
+	var bus *EventBus
+	bus.Publish(Event{Type: EventCreated})
+}
+
+func TestCreatePublishesEvent(t *testing.T) {
+	tests := []struct {
+		name      string
+		createErr error
+		wantEvent bool
+	}{
+		{name: "created", wantEvent: true},
+		{name: "create failed", createErr: errors.New("db down")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := NewEventBus(1, discardLogger)
+			ch := bus.Subscribe()
+			repo := &stubRepository{
+				create: func(ctx context.Context, comment *domain.Comment) error {
+					comment.ID = 3
+					return tt.createErr
+				},
+			}
+
+			NewCommentUseCase(repo, Config{Events: bus}).Create(context.Background(), nil, "text", nil, "")
+
+			select {
+			case event := <-ch:
+				if !tt.wantEvent {
+					t.Fatalf("got event %s after a failed create", event.Type)
+				}
+				if event.Type != EventCreated || event.Comment.ID != 3 || event.OccurredAt.IsZero() {
+					t.Errorf("event = %+v, want %s for comment 3", event, EventCreated)
+				}
+			default:
+				if tt.wantEvent {
+					t.Error("no event published")
+				}
+			}
+		})
+	}
+}
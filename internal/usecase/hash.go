@@ -0,0 +1,30 @@
+package usecase
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// contentHash возвращает SHA-256 (hex) нормализованного текста: пробельные символы по краям
+// отбрасываются, подряд идущие сжимаются до одного пробела, регистр приводится к нижнему.
+// Нормализация совпадает с заполнением content_hash в миграции 008 для существующих комментариев
+func contentHash(content string) string {
+	normalized := strings.ToLower(strings.Join(strings.Fields(content), " "))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// isContentHash проверяет, что строка похожа на значение contentHash: 64 шестнадцатеричных символа
+// в нижнем регистре
+func isContentHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
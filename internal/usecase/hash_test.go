@@ -0,0 +1,57 @@
+package usecase
+
+import "testing"
+
+// helloWorldHash SHA-256 строки "hello world": с ним же совпадает заполнение content_hash
+// миграцией 008, поэтому нормализация здесь закреплена
+const helloWorldHash = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+
+func TestContentHashNormalization(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "already normalized", content: "hello world"},
+		{name: "case", content: "Hello WORLD"},
+		{name: "inner spaces", content: "hello    world"},
+		{name: "edge spaces", content: "  hello world  "},
+		{name: "edge newlines and tabs", content: "\n\thello world\t\n"},
+		{name: "inner newline and tab", content: "hello\n\t world"},
+		{name: "crlf", content: "\r\nhello\r\nworld\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contentHash(tt.content); got != helloWorldHash {
+				t.Errorf("contentHash(%q) = %s, want %s", tt.content, got, helloWorldHash)
+			}
+		})
+	}
+}
+
+func TestContentHashDistinguishesText(t *testing.T) {
+	if contentHash("hello world") == contentHash("helloworld") {
+		t.Error("contentHash must not drop whitespace between words")
+	}
+}
+
+func TestIsContentHash(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{value: helloWorldHash, want: true},
+		{value: contentHash("any text"), want: true},
+		{value: "B94D27B9934D3E08A52E52D7DA7DABFAC484EFE37A5380EE9088F7ACE2EFCDE9", want: false},
+		{value: helloWorldHash[:63], want: false},
+		{value: helloWorldHash + "0", want: false},
+		{value: "g" + helloWorldHash[1:], want: false},
+		{value: "", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isContentHash(tt.value); got != tt.want {
+			t.Errorf("isContentHash(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package usecase
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// ExpiryJanitor периодически удаляет комментарии с истекшим сроком жизни.
+// Чтение истекших комментариев отфильтровывается в запросах, поэтому janitor лишь освобождает место.
+// Он же забывает ID удаленных комментариев старше retention, чтобы deleted_ids не рос бесконечно
+type ExpiryJanitor struct {
+	repo      domain.CommentRepository
+	interval  time.Duration
+	retention time.Duration
+	logger    *slog.Logger
+}
+
+// NewExpiryJanitor создает новый экземпляр ExpiryJanitor. retention 0 хранит удаленные ID бессрочно
+func NewExpiryJanitor(repo domain.CommentRepository, interval, retention time.Duration, logger *slog.Logger) *ExpiryJanitor {
+	return &ExpiryJanitor{repo: repo, interval: interval, retention: retention, logger: logger}
+}
+
+// Run удаляет истекшие комментарии и старые удаленные ID каждые interval, пока не будет отменен ctx
+func (j *ExpiryJanitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := j.repo.DeleteExpired(ctx)
+			if err != nil {
+				j.logger.Error("failed to delete expired comments", "error", err)
+				continue
+			}
+			if deleted > 0 {
+				j.logger.Info("expired comments deleted", "count", deleted)
+			}
+			j.pruneDeletedIDs(ctx)
+		}
+	}
+}
+
+// pruneDeletedIDs забывает удаленные ID старше retention
+func (j *ExpiryJanitor) pruneDeletedIDs(ctx context.Context) {
+	if j.retention <= 0 {
+		return
+	}
+
+	pruned, err := j.repo.PruneDeletedIDs(ctx, j.retention)
+	if err != nil {
+		j.logger.Error("failed to prune deleted ids", "error", err)
+		return
+	}
+	if pruned > 0 {
+		j.logger.Info("deleted ids pruned", "count", pruned)
+	}
+}
+
+// OrphanJanitor периодически ищет ответы, родителя которых нет или срок жизни родителя истек.
+// Такие ответы не попадают в деревья, поэтому их число пишется в лог; при fix они удаляются
+type OrphanJanitor struct {
+	repo     domain.CommentRepository
+	interval time.Duration
+	fix      bool
+	logger   *slog.Logger
+}
+
+// NewOrphanJanitor создает новый экземпляр OrphanJanitor
+func NewOrphanJanitor(repo domain.CommentRepository, interval time.Duration, fix bool, logger *slog.Logger) *OrphanJanitor {
+	return &OrphanJanitor{repo: repo, interval: interval, fix: fix, logger: logger}
+}
+
+// Run проверяет ответы без родителя каждые interval, пока не будет отменен ctx
+func (j *OrphanJanitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count, err := j.repo.SweepOrphans(ctx, j.fix)
+			if err != nil {
+				j.logger.Error("failed to sweep orphan comments", "error", err)
+				continue
+			}
+			switch {
+			case count > 0 && j.fix:
+				j.logger.Warn("orphan comments deleted", "count", count)
+			case count > 0:
+				j.logger.Warn("orphan comments found", "count", count)
+			default:
+				j.logger.Debug("no orphan comments found")
+			}
+		}
+	}
+}
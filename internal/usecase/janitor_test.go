@@ -0,0 +1,145 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestExpiryJanitorPrunesDeletedIDs(t *testing.T) {
+	tests := []struct {
+		name       string
+		retention  time.Duration
+		deleteErr  error
+		wantPruned bool
+	}{
+		{name: "retention set", retention: time.Hour, wantPruned: true},
+		{name: "retention disabled", retention: 0, wantPruned: false},
+		{name: "expiry sweep failed", retention: time.Hour, deleteErr: errors.New("connection refused"), wantPruned: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			swept := make(chan struct{}, 1)
+			pruned := make(chan time.Duration, 1)
+			repo := &stubRepository{
+				deleteExpired: func(ctx context.Context) (int64, error) {
+					select {
+					case swept <- struct{}{}:
+					default:
+					}
+					return 0, tt.deleteErr
+				},
+				pruneDeletedIDs: func(ctx context.Context, retention time.Duration) (int64, error) {
+					select {
+					case pruned <- retention:
+					default:
+					}
+					return 0, nil
+				},
+			}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				NewExpiryJanitor(repo, time.Millisecond, tt.retention, discardLogger).Run(ctx)
+			}()
+
+			<-swept
+			// Второй проход гарантирует, что первый завершился целиком
+			<-swept
+			cancel()
+			<-done
+
+			select {
+			case retention := <-pruned:
+				if !tt.wantPruned {
+					t.Fatalf("PruneDeletedIDs called with %v, want no call", retention)
+				}
+				if retention != tt.retention {
+					t.Errorf("retention = %v, want %v", retention, tt.retention)
+				}
+			default:
+				if tt.wantPruned {
+					t.Fatal("PruneDeletedIDs was not called")
+				}
+			}
+		})
+	}
+}
+
+// captureLogger собирает записи лога для проверки уровней и сообщений
+type captureLogger struct {
+	records chan slog.Record
+}
+
+func (h *captureLogger) Enabled(context.Context, slog.Level) bool { return true }
+func (h *captureLogger) Handle(_ context.Context, r slog.Record) error {
+	select {
+	case h.records <- r:
+	default:
+	}
+	return nil
+}
+func (h *captureLogger) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *captureLogger) WithGroup(string) slog.Handler      { return h }
+
+func TestOrphanJanitor(t *testing.T) {
+	tests := []struct {
+		name      string
+		fix       bool
+		count     int64
+		err       error
+		wantLevel slog.Level
+		wantMsg   string
+	}{
+		{name: "report", fix: false, count: 3, wantLevel: slog.LevelWarn, wantMsg: "orphan comments found"},
+		{name: "fix", fix: true, count: 3, wantLevel: slog.LevelWarn, wantMsg: "orphan comments deleted"},
+		{name: "none", fix: true, count: 0, wantLevel: slog.LevelDebug, wantMsg: "no orphan comments found"},
+		{name: "failure", fix: false, err: errors.New("connection refused"), wantLevel: slog.LevelError, wantMsg: "failed to sweep orphan comments"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			fixes := make(chan bool, 1)
+			repo := &stubRepository{
+				sweepOrphans: func(ctx context.Context, fix bool) (int64, error) {
+					select {
+					case fixes <- fix:
+					default:
+					}
+					return tt.count, tt.err
+				},
+			}
+			handler := &captureLogger{records: make(chan slog.Record, 1)}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				NewOrphanJanitor(repo, time.Millisecond, tt.fix, slog.New(handler)).Run(ctx)
+			}()
+
+			if fix := <-fixes; fix != tt.fix {
+				t.Errorf("SweepOrphans fix = %v, want %v", fix, tt.fix)
+			}
+			record := <-handler.records
+			cancel()
+			<-done
+
+			if record.Level != tt.wantLevel || record.Message != tt.wantMsg {
+				t.Errorf("log = %s %q, want %s %q", record.Level, record.Message, tt.wantLevel, tt.wantMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package usecase
+
+import (
+	"regexp"
+	"strings"
+)
+
+// mentionPattern находит @username, перед которым нет буквы, цифры, '_', '.' или '@'.
+// Благодаря этому адреса вида user@example.com не считаются упоминаниями
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@])@([\p{L}\p{N}_]+)`)
+
+// extractMentions возвращает имена пользователей, упомянутых в тексте, без повторов и в порядке появления.
+// Повторы определяются без учета регистра; сохраняется написание первого упоминания
+func extractMentions(content string) []string {
+	matches := mentionPattern.FindAllStringSubmatch(content, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(matches))
+	mentions := make([]string, 0, len(matches))
+	for _, match := range matches {
+		username := match[1]
+		key := strings.ToLower(username)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		mentions = append(mentions, username)
+	}
+
+	return mentions
+}
@@ -0,0 +1,38 @@
+package usecase
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractMentions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{name: "none", content: "no mentions here", want: nil},
+		{name: "single", content: "hi @alice", want: []string{"alice"}},
+		{name: "start of text", content: "@alice hi", want: []string{"alice"}},
+		{name: "order of appearance", content: "@bob and @alice", want: []string{"bob", "alice"}},
+		{name: "punctuation around", content: "(@alice), @bob!", want: []string{"alice", "bob"}},
+		{name: "adjacent", content: "@alice,@bob", want: []string{"alice", "bob"}},
+		{name: "underscore and digits", content: "@user_42", want: []string{"user_42"}},
+		{name: "unicode", content: "привет @Пётр", want: []string{"Пётр"}},
+		{name: "duplicate", content: "@alice @alice", want: []string{"alice"}},
+		{name: "duplicate different case keeps first spelling", content: "@Alice @alice @ALICE", want: []string{"Alice"}},
+		{name: "email", content: "write to user@example.com", want: nil},
+		{name: "dotted prefix", content: "a.@alice", want: nil},
+		{name: "double at", content: "@@alice", want: nil},
+		{name: "bare at", content: "@ alice", want: nil},
+		{name: "newline before", content: "line\n@alice", want: []string{"alice"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractMentions(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractMentions(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// stubRepository подменяет отдельные методы репозитория в тестах use case.
+// Методы без заданной функции достаются от nil-интерфейса и паникуют при вызове
+type stubRepository struct {
+	domain.CommentRepository
+
+	getByID            func(ctx context.Context, id int64) (*domain.Comment, error)
+	getTree            func(ctx context.Context, parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error)
+	deleteExpired      func(ctx context.Context) (int64, error)
+	sweepOrphans       func(ctx context.Context, fix bool) (int64, error)
+	pruneDeletedIDs    func(ctx context.Context, retention time.Duration) (int64, error)
+	addViews           func(ctx context.Context, views map[int64]int64) error
+	getReplies         func(ctx context.Context, parentID *int64, limit, offset int) ([]domain.Comment, error)
+	count              func(ctx context.Context, filter domain.CommentFilter) (int, error)
+	create             func(ctx context.Context, comment *domain.Comment) error
+	hasRecentDuplicate func(ctx context.Context, parentID *int64, content string, since time.Time) (bool, error)
+	hasRecentSimilar   func(ctx context.Context, parentID *int64, content string, since time.Time, threshold float64) (bool, error)
+}
+
+func (r *stubRepository) GetByID(ctx context.Context, id int64) (*domain.Comment, error) {
+	return r.getByID(ctx, id)
+}
+
+func (r *stubRepository) GetTree(ctx context.Context, parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error) {
+	return r.getTree(ctx, parentID, filter)
+}
+
+func (r *stubRepository) GetReplies(ctx context.Context, parentID *int64, limit, offset int) ([]domain.Comment, error) {
+	return r.getReplies(ctx, parentID, limit, offset)
+}
+
+func (r *stubRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	return r.deleteExpired(ctx)
+}
+
+func (r *stubRepository) SweepOrphans(ctx context.Context, fix bool) (int64, error) {
+	return r.sweepOrphans(ctx, fix)
+}
+
+func (r *stubRepository) PruneDeletedIDs(ctx context.Context, retention time.Duration) (int64, error) {
+	return r.pruneDeletedIDs(ctx, retention)
+}
+
+func (r *stubRepository) AddViews(ctx context.Context, views map[int64]int64) error {
+	return r.addViews(ctx, views)
+}
+
+func (r *stubRepository) Count(ctx context.Context, filter domain.CommentFilter) (int, error) {
+	return r.count(ctx, filter)
+}
+
+func (r *stubRepository) Create(ctx context.Context, comment *domain.Comment) error {
+	return r.create(ctx, comment)
+}
+
+func (r *stubRepository) HasRecentDuplicate(ctx context.Context, parentID *int64, content string, since time.Time) (bool, error) {
+	return r.hasRecentDuplicate(ctx, parentID, content, since)
+}
+
+func (r *stubRepository) HasRecentSimilar(ctx context.Context, parentID *int64, content string, since time.Time, threshold float64) (bool, error) {
+	return r.hasRecentSimilar(ctx, parentID, content, since, threshold)
+}
@@ -0,0 +1,72 @@
+package usecase
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// slugMaxWords количество первых слов текста, из которых строится slug
+	slugMaxWords = 5
+	// slugMaxLength максимальная длина основы slug без суффикса ID
+	slugMaxLength = 50
+)
+
+// cyrillicTranslit таблица транслитерации кириллицы в латиницу
+var cyrillicTranslit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "h", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "sch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya",
+}
+
+// slugBase строит основу slug из первых слов текста: кириллица транслитерируется, диакритика
+// удаляется, остальные символы вне [a-z0-9] становятся разделителями. Может вернуть пустую строку;
+// окончательный slug с суффиксом ID формирует domain.PermalinkSlug
+func slugBase(content string) string {
+	stripMarks := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	content, _, err := transform.String(stripMarks, strings.ToLower(content))
+	if err != nil {
+		return ""
+	}
+
+	words := make([]string, 0, slugMaxWords)
+	for _, field := range strings.Fields(content) {
+		var word strings.Builder
+		for _, r := range field {
+			switch {
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+				word.WriteRune(r)
+			case r == '\'' || r == '’':
+				// Апострофы не разделяют слово: "don't" -> "dont"
+			default:
+				if translit, ok := cyrillicTranslit[r]; ok {
+					word.WriteString(translit)
+				} else if word.Len() > 0 {
+					// Остальные знаки внутри слова ("e-mail") делят его на части
+					words = append(words, word.String())
+					word.Reset()
+				}
+			}
+		}
+		if word.Len() > 0 {
+			words = append(words, word.String())
+		}
+		if len(words) >= slugMaxWords {
+			words = words[:slugMaxWords]
+			break
+		}
+	}
+
+	base := strings.Join(words, "-")
+	if len(base) > slugMaxLength {
+		base = strings.TrimRight(base[:slugMaxLength], "-")
+	}
+
+	return base
+}
@@ -0,0 +1,34 @@
+package usecase
+
+import "testing"
+
+func TestSlugBase(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "first five words", content: "Great point about recursive CTE queries in Postgres", want: "great-point-about-recursive-cte"},
+		{name: "punctuation separates words", content: "Hello, world! e-mail me: ok?", want: "hello-world-e-mail-me"},
+		{name: "apostrophes kept inside words", content: "Don't do that", want: "dont-do-that"},
+		{name: "diacritics removed", content: "Café naïve résumé", want: "cafe-naive-resume"},
+		{name: "cyrillic transliterated", content: "Привет, мир! Щука и ёж", want: "privet-mir-schuka-i-ezh"},
+		{name: "unicode without transliteration", content: "你好 world 🙂 ok", want: "world-ok"},
+		{name: "empty after stripping", content: "!!! ??? 🙂 —", want: ""},
+		{name: "empty content", content: "", want: ""},
+		{name: "truncated to 50 bytes", content: "Antidisestablishmentarianism floccinaucinihilipilification", want: "antidisestablishmentarianism-floccinaucinihilipili"},
+		{name: "no trailing separator after truncation", content: "abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvw more", want: "abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvw"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := slugBase(tt.content)
+			if got != tt.want {
+				t.Errorf("slugBase(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+			if len(got) > slugMaxLength {
+				t.Errorf("slugBase(%q) is %d bytes, want at most %d", tt.content, len(got), slugMaxLength)
+			}
+		})
+	}
+}
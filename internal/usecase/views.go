@@ -0,0 +1,83 @@
+package usecase
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+// ViewCounter накапливает просмотры веток в памяти и периодически записывает их в БД одним запросом,
+// чтобы чтение дерева не ждало записи. Просмотры, накопленные после последней записи, при аварийной
+// остановке процесса теряются; при штатной остановке Run записывает их перед выходом
+type ViewCounter struct {
+	repo     domain.CommentRepository
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	pending map[int64]int64
+}
+
+// NewViewCounter создает новый экземпляр ViewCounter
+func NewViewCounter(repo domain.CommentRepository, interval time.Duration, logger *slog.Logger) *ViewCounter {
+	return &ViewCounter{
+		repo:     repo,
+		interval: interval,
+		logger:   logger,
+		pending:  make(map[int64]int64),
+	}
+}
+
+// Record учитывает просмотр ветки комментария id. Вызов на nil ViewCounter ничего не делает
+func (v *ViewCounter) Record(id int64) {
+	if v == nil {
+		return
+	}
+
+	v.mu.Lock()
+	v.pending[id]++
+	v.mu.Unlock()
+}
+
+// Run записывает накопленные просмотры каждые interval, пока не будет отменен ctx,
+// после чего записывает остаток
+func (v *ViewCounter) Run(ctx context.Context) {
+	ticker := time.NewTicker(v.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx уже отменен, а остаток нужно записать до выхода
+			v.flush(context.WithoutCancel(ctx))
+			return
+		case <-ticker.C:
+			v.flush(ctx)
+		}
+	}
+}
+
+// flush записывает накопленные просмотры. При ошибке они возвращаются в очередь до следующей попытки
+func (v *ViewCounter) flush(ctx context.Context) {
+	v.mu.Lock()
+	views := v.pending
+	v.pending = make(map[int64]int64)
+	v.mu.Unlock()
+
+	if len(views) == 0 {
+		return
+	}
+
+	if err := v.repo.AddViews(ctx, views); err != nil {
+		v.logger.Error("failed to save views", "error", err, "comments", len(views))
+
+		v.mu.Lock()
+		for id, n := range views {
+			v.pending[id] += n
+		}
+		v.mu.Unlock()
+	}
+}
@@ -0,0 +1,84 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/oziev02/CommentTree/internal/domain"
+)
+
+func TestGetTreeRecordsViews(t *testing.T) {
+	const id = int64(7)
+	parentID := id
+	found := []domain.CommentTree{{Comment: domain.Comment{ID: id}}}
+
+	tests := []struct {
+		name      string
+		parentID  *int64
+		trees     []domain.CommentTree
+		err       error
+		wantViews int64
+	}{
+		{name: "subtree", parentID: &parentID, trees: found, wantViews: 1},
+		{name: "missing parent", parentID: &parentID, trees: []domain.CommentTree{}, wantViews: 0},
+		{name: "lookup failed", parentID: &parentID, err: errors.New("connection refused"), wantViews: 0},
+		{name: "root listing", parentID: nil, trees: found, wantViews: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &stubRepository{
+				getTree: func(ctx context.Context, parentID *int64, filter domain.CommentFilter) ([]domain.CommentTree, error) {
+					return tt.trees, tt.err
+				},
+			}
+			views := NewViewCounter(repo, 0, discardLogger)
+			uc := NewCommentUseCase(repo, Config{Views: views})
+
+			uc.GetTree(context.Background(), domain.CommentFilter{ParentID: tt.parentID})
+
+			if got := views.pending[id]; got != tt.wantViews {
+				t.Errorf("recorded views = %d, want %d", got, tt.wantViews)
+			}
+			if tt.wantViews == 0 && len(views.pending) != 0 {
+				t.Errorf("pending views = %v, want none", views.pending)
+			}
+		})
+	}
+}
+
+func TestViewCounterFlush(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantPending int64
+	}{
+		{name: "saved", wantPending: 0},
+		{name: "failed", err: errors.New("connection refused"), wantPending: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var saved map[int64]int64
+			repo := &stubRepository{
+				addViews: func(ctx context.Context, views map[int64]int64) error {
+					saved = views
+					return tt.err
+				},
+			}
+			views := NewViewCounter(repo, 0, discardLogger)
+			views.Record(1)
+			views.Record(1)
+
+			views.flush(context.Background())
+
+			if saved[1] != 2 {
+				t.Errorf("saved views = %v, want 2 for comment 1", saved)
+			}
+			if views.pending[1] != tt.wantPending {
+				t.Errorf("pending views = %d, want %d", views.pending[1], tt.wantPending)
+			}
+		})
+	}
+}